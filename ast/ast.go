@@ -5,6 +5,8 @@ package ast
 import (
 	"bytes"
 	"interpreter/token"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
@@ -16,6 +18,11 @@ type Node interface {
 
 	// 用于打印 AST，类似 toString()
 	String() string
+
+	// 节点主 token（即节点的 Token 字段）在源码中的开始和结束位置，
+	// 用于在报告错误时指出出错的地方
+	Pos() token.Position
+	End() token.Position
 }
 
 type Expression interface {
@@ -28,8 +35,15 @@ type Statement interface {
 	statementNode() // 无实际用途的方法，仅用于将 struct 分类
 }
 
+// 模式，用于 match 表达式的分支，比如 1、"a"、x、_、[a, ...rest]、{"k": v}
+type Pattern interface {
+	Node
+	patternNode() // 无实际用途的方法，仅用于将 struct 分类
+}
+
 type Program struct {
 	Statements []Statement // 注意这里 Statement 是接口，而不是结构体，所以可以装 *LetStatement
+	Resolved   bool        // 已经经过执行之前的解析（core.Resolve），执行引擎不需要再次解析
 }
 
 func (p *Program) TokenLiteral() string {
@@ -40,6 +54,20 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -51,9 +79,10 @@ func (p *Program) String() string {
 }
 
 type LetStatement struct {
-	Token token.Token // let 语句的开始 token，必定是 LET token
-	Name  *Identifier
-	Value Expression
+	Token    token.Token // let 语句的开始 token，LET 或者 CONST token
+	Name     Pattern     // 标识符或者解构模式，比如 x、[a, b]、{name, age}
+	Value    Expression
+	Constant bool // const 语句声明的标识符不能重新赋值
 }
 
 func (ls *LetStatement) statementNode() {
@@ -66,6 +95,9 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position { return ls.Token.End }
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -81,18 +113,40 @@ func (ls *LetStatement) String() string {
 type Identifier struct {
 	Token token.Token // the IDENT token
 	Value string
+
+	// 以下字段由执行之前的解析（core.Resolve）填写，执行时据此直接定位标识符，而不必按照名称逐层查找
+	Resolution Resolution
+	Depth      int  // 局部变量所在的环境：从当前环境往外第几层
+	Index      int  // 局部变量在环境里的槽位，或者内置函数的下标
+	Constant   bool // 局部变量是否使用 const 声明
 }
 
+// 标识符的解析结果
+type Resolution int
+
+const (
+	Unresolved Resolution = iota // 尚未解析，求值时按照名称逐层查找
+	Local                        // 局部变量，位于往外第 Depth 层环境的第 Index 个槽位
+	Global                       // 全局变量，按照名称在全局环境里查找，找不到时使用同名的内置函数
+	Builtin                      // 内置函数，Index 为内置函数的下标
+)
+
 func (i *Identifier) expressionNode() {
 	// 实现接口 Expression 的方法 expressionNode()
 	// 用于表明 Identifier 是一个 Expression
 	// 相当于 Rust 的 `#[derive]`` 或者 Java 的 `class X implements ISomeInterface`
 }
 
+// 标识符也是一种模式，匹配任意值并绑定到该名称，名称 "_" 表示通配符（不绑定）
+func (i *Identifier) patternNode() {}
+
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -104,6 +158,8 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position  { return rs.Token.End }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -114,6 +170,127 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// import "<path>" as <alias>;
+// import { <name>, <name> as <local>, ... } from "<path>";
+// import "<path>";
+type ImportStatement struct {
+	Token  token.Token // the 'import' token
+	Path   *StringLiteral
+	Alias  *Identifier   // 整个模块绑定的名称，没有时为 nil
+	Names  []*Identifier // 从模块导入的标识符
+	Locals []*Identifier // 导入的标识符在当前环境里的名称，跟 Names 一一对应
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImportStatement) End() token.Position  { return is.Token.End }
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("import ")
+
+	if len(is.Names) > 0 {
+		names := []string{}
+		for i, name := range is.Names {
+			if is.Locals[i].Value != name.Value {
+				names = append(names, name.String()+" as "+is.Locals[i].String())
+			} else {
+				names = append(names, name.String())
+			}
+		}
+		out.WriteString("{" + strings.Join(names, ", ") + "} from ")
+	}
+
+	out.WriteString(strconv.Quote(is.Path.Value))
+
+	if is.Alias != nil {
+		out.WriteString(" as " + is.Alias.String())
+	}
+
+	out.WriteString(";")
+	return out.String()
+}
+
+// export let <name> = <expression>;
+// export const <name> = <expression>;
+type ExportStatement struct {
+	Token     token.Token // the 'export' token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExportStatement) End() token.Position  { return es.Token.End }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// throw <expression>;
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) End() token.Position  { return ts.Token.End }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// while (<condition>) { <body> }
+type WhileStatement struct {
+	Token     token.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position  { return ws.Token.End }
+func (ws *WhileStatement) String() string {
+	return "while " + ws.Condition.String() + " " + ws.Body.String()
+}
+
+// for (<variable> in <iterable>) { <body> }
+type ForStatement struct {
+	Token    token.Token // the 'for' token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position  { return fs.Token.End }
+func (fs *ForStatement) String() string {
+	return "for " + fs.Variable.String() + " in " + fs.Iterable.String() + " " + fs.Body.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position  { return bs.Token.End }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position  { return cs.Token.End }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
 type ExpressionStatement struct {
 	Token      token.Token // 语句开始的第一个 token
 	Expression Expression
@@ -121,6 +298,8 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position  { return es.Token.End }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -131,12 +310,26 @@ func (es *ExpressionStatement) String() string {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // 超出 int64 范围的整数字面量，此时 Value 字段无意义
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position  { return il.Token.End }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 // 一元运算符
 type PrefixExpression struct {
 	Token    token.Token // 运算符, e.g. !, -, +
@@ -146,6 +339,8 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position  { return pe.Token.End }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -164,6 +359,8 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *InfixExpression) End() token.Position  { return ie.Token.End }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -182,6 +379,8 @@ type Boolean struct {
 
 func (il *Boolean) expressionNode()      {}
 func (il *Boolean) TokenLiteral() string { return il.Token.Literal }
+func (il *Boolean) Pos() token.Position  { return il.Token.Pos }
+func (il *Boolean) End() token.Position  { return il.Token.End }
 func (il *Boolean) String() string       { return il.Token.Literal }
 
 type IfExpression struct {
@@ -193,6 +392,8 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position  { return ie.Token.End }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if ")
@@ -213,10 +414,16 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+
+	// 语句块的环境所需的槽位数量，由求值之前的解析填写，为 0 时语句块不需要自己的环境。
+	// 对于函数体和 catch 语句块，还包括跟它们共用作用域的形参
+	Slots int
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position  { return bs.Token.End }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -237,34 +444,75 @@ func (bs *BlockStatement) String() string {
 // e.g. "fn(x, y) { x + y; }""
 type FunctionLiteral struct {
 	Token      token.Token     // The 'fn' token
-	Parameters []*Identifier   // 参数列表
+	Parameters []Pattern       // 参数列表，参数可以是标识符或者解构模式
+	Defaults   []Expression    // 参数的默认值，跟 Parameters 一一对应，没有默认值的参数对应 nil
+	Rest       *Identifier     // 剩余参数，比如 fn(head, ...tail) 里的 tail，没有剩余参数时为 nil
 	Body       *BlockStatement // 函数体
+	Name       string          // 函数名称，即 let 语句绑定的名称，匿名函数为空字符串
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position  { return fl.Token.End }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(FormatParameters(fl.Parameters, fl.Defaults, fl.Rest))
 	out.WriteString(") ")
 	out.WriteString(fl.Body.String())
 	return out.String()
 }
 
+// 将参数列表转换为字符串，比如 "x, step = 1, ...rest"
+func FormatParameters(parameters []Pattern, defaults []Expression, rest *Identifier) string {
+	params := []string{}
+	for i, p := range parameters {
+		if i < len(defaults) && defaults[i] != nil {
+			params = append(params, p.String()+" = "+defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+
+	if rest != nil {
+		params = append(params, "..."+rest.String())
+	}
+
+	return strings.Join(params, ", ")
+}
+
+// 赋值表达式，比如 x = 1、x += 1，表达式的值为赋值之后的值
+type AssignExpression struct {
+	Token    token.Token // 赋值运算符, e.g. =, +=, -=
+	Target   Expression  // 被赋值的目标：标识符、索引表达式或者成员访问表达式
+	Operator string      // 赋值运算符的符号
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
+func (ae *AssignExpression) End() token.Position  { return ae.Token.End }
+func (ae *AssignExpression) String() string {
+	return ae.Target.String() + " " + ae.Operator + " " + ae.Value.String()
+}
+
 type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+
+	// 调用是否处于函数的尾部位置，由求值之前的解析填写，
+	// 尾调用在调用者的同一层 Go 调用里执行，见 evaluator 的 applyFunction
+	Tail bool
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
+func (ce *CallExpression) End() token.Position  { return ce.Token.End }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -285,8 +533,35 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// 插值字符串，比如 "n = ${n}, sum = ${sum(list)}"，
+// Parts 由字符串片段（*StringLiteral）和插值表达式交替组成，首尾都是字符串片段
+type InterpolatedString struct {
+	Token token.Token // the TEMPLATE_HEAD token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) End() token.Position  { return is.Parts[len(is.Parts)-1].End() }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	for _, part := range is.Parts {
+		if _, ok := part.(*StringLiteral); ok {
+			out.WriteString(part.String())
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
@@ -294,6 +569,8 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position  { return al.Token.End }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
@@ -315,6 +592,8 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IndexExpression) End() token.Position  { return ie.Token.End }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -325,6 +604,21 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// 成员访问，比如 h.key，对于映射表等同于 h["key"]
+type MemberExpression struct {
+	Token    token.Token // The . token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MemberExpression) End() token.Position  { return me.Property.End() }
+func (me *MemberExpression) String() string {
+	return "(" + me.Object.String() + "." + me.Property.String() + ")"
+}
+
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
@@ -332,6 +626,8 @@ type HashLiteral struct {
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position  { return hl.Token.End }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
@@ -343,3 +639,127 @@ func (hl *HashLiteral) String() string {
 	out.WriteString("}")
 	return out.String()
 }
+
+// match 表达式
+// e.g. "match (x) { 0 => "zero", [a, ...rest] => a, _ => "other" }"
+type MatchExpression struct {
+	Token   token.Token // The 'match' token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MatchExpression) End() token.Position  { return me.Token.End }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	return "match " + me.Subject.String() + " {" + strings.Join(arms, ", ") + "}"
+}
+
+// match 表达式的分支 pattern => body
+// 分支的 body 可以是语句块，也可以是单个表达式（解析为只有一条语句的语句块）
+type MatchArm struct {
+	Pattern Pattern
+	Body    *BlockStatement
+	Slots   int // 模式绑定的变量所需的槽位数量，由求值之前的解析填写
+}
+
+func (ma *MatchArm) String() string {
+	return ma.Pattern.String() + " => " + ma.Body.String()
+}
+
+// 字面量模式，比如 1、-2.5、"foo"、true，匹配跟字面量相等的值
+type LiteralPattern struct {
+	Token token.Token // 字面量的第一个 token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) Pos() token.Position  { return lp.Token.Pos }
+func (lp *LiteralPattern) End() token.Position  { return lp.Value.End() }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// 数组模式，比如 [a, 1, _] 和 [head, ...tail]
+// 没有剩余元素时只匹配长度相同的数组
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+	Rest     *Identifier // 剩余元素，没有时为 nil
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos }
+func (ap *ArrayPattern) End() token.Position  { return ap.Token.End }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// 映射表模式，比如 {"name": n, "age": 30} 和简写形式 {name, age}
+// 映射表必须包含模式里的所有 key，多余的 key 会被忽略
+type HashPattern struct {
+	Token  token.Token // the '{' token
+	Keys   []Expression
+	Values []Pattern // 跟 Keys 一一对应
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos }
+func (hp *HashPattern) End() token.Position  { return hp.Token.End }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+":"+hp.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// try 表达式
+// e.g. "try { risky() } catch (e) { e.message } finally { cleanup() }"
+//
+// catch 和 finally 至少要有一个，表达式的值为 try 语句块（或者捕获到错误时 catch 语句块）的值
+type TryExpression struct {
+	Token     token.Token // The 'try' token
+	Block     *BlockStatement
+	Parameter Pattern         // catch 的参数，可以为 nil，即 "catch { ... }"
+	Catch     *BlockStatement // 没有 catch 时为 nil
+	Finally   *BlockStatement // 没有 finally 时为 nil
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) End() token.Position  { return te.Token.End }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.Parameter != nil {
+			out.WriteString("(" + te.Parameter.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
@@ -37,3 +37,62 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. actual %q", program.String())
 	}
 }
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	// let f = fn(a) { a + b.c };
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []Pattern{ident("a")},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{
+								Expression: &InfixExpression{
+									Left:     ident("a"),
+									Operator: "+",
+									Right:    &MemberExpression{Object: ident("b"), Property: ident("c")},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	names := []string{}
+	Inspect(program, func(node Node) bool {
+		if identifier, ok := node.(*Identifier); ok {
+			names = append(names, identifier.Value)
+		}
+		return true
+	})
+
+	// 成员的名称 c 不是标识符的引用
+	expected := []string{"f", "a", "a", "b"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected identifiers %v, actual %v", expected, names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("identifier %d: expected %s, actual %s", i, name, names[i])
+		}
+	}
+
+	// 返回 false 时不访问子节点
+	count := 0
+	Inspect(program, func(node Node) bool {
+		count++
+		_, isFunction := node.(*FunctionLiteral)
+		return !isFunction
+	})
+	if count != 4 {
+		t.Errorf("expected 4 visited nodes, actual %d", count)
+	}
+}
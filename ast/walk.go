@@ -0,0 +1,149 @@
+package ast
+
+// 深度优先遍历 node 以及它的所有子节点，对每个节点调用 fn，
+// 如果 fn 返回 false，则不再访问该节点的子节点
+func Inspect(node Node, fn func(Node) bool) {
+	if !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, statement := range n.Statements {
+			Inspect(statement, fn)
+		}
+
+	case *BlockStatement:
+		for _, statement := range n.Statements {
+			Inspect(statement, fn)
+		}
+
+	case *ExpressionStatement:
+		Inspect(n.Expression, fn)
+
+	case *LetStatement:
+		Inspect(n.Name, fn)
+		Inspect(n.Value, fn)
+
+	case *ReturnStatement:
+		Inspect(n.ReturnValue, fn)
+
+	case *ImportStatement:
+		if n.Alias != nil {
+			Inspect(n.Alias, fn)
+		}
+		for _, local := range n.Locals {
+			Inspect(local, fn)
+		}
+
+	case *ExportStatement:
+		Inspect(n.Statement, fn)
+
+	case *ThrowStatement:
+		Inspect(n.Value, fn)
+
+	case *WhileStatement:
+		Inspect(n.Condition, fn)
+		Inspect(n.Body, fn)
+
+	case *ForStatement:
+		Inspect(n.Variable, fn)
+		Inspect(n.Iterable, fn)
+		Inspect(n.Body, fn)
+
+	case *PrefixExpression:
+		Inspect(n.Right, fn)
+
+	case *InfixExpression:
+		Inspect(n.Left, fn)
+		Inspect(n.Right, fn)
+
+	case *IfExpression:
+		Inspect(n.Condition, fn)
+		Inspect(n.Consequence, fn)
+		if n.Alternative != nil {
+			Inspect(n.Alternative, fn)
+		}
+
+	case *MatchExpression:
+		Inspect(n.Subject, fn)
+		for _, arm := range n.Arms {
+			Inspect(arm.Pattern, fn)
+			Inspect(arm.Body, fn)
+		}
+
+	case *TryExpression:
+		Inspect(n.Block, fn)
+		if n.Parameter != nil {
+			Inspect(n.Parameter, fn)
+		}
+		if n.Catch != nil {
+			Inspect(n.Catch, fn)
+		}
+		if n.Finally != nil {
+			Inspect(n.Finally, fn)
+		}
+
+	case *AssignExpression:
+		Inspect(n.Target, fn)
+		Inspect(n.Value, fn)
+
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			Inspect(param, fn)
+			if i < len(n.Defaults) && n.Defaults[i] != nil {
+				Inspect(n.Defaults[i], fn)
+			}
+		}
+		if n.Rest != nil {
+			Inspect(n.Rest, fn)
+		}
+		Inspect(n.Body, fn)
+
+	case *CallExpression:
+		Inspect(n.Function, fn)
+		for _, argument := range n.Arguments {
+			Inspect(argument, fn)
+		}
+
+	case *IndexExpression:
+		Inspect(n.Left, fn)
+		Inspect(n.Index, fn)
+
+	case *MemberExpression:
+		Inspect(n.Object, fn) // 成员的名称不是标识符的引用，所以不访问 Property
+
+	case *InterpolatedString:
+		for _, part := range n.Parts {
+			Inspect(part, fn)
+		}
+
+	case *ArrayLiteral:
+		for _, element := range n.Elements {
+			Inspect(element, fn)
+		}
+
+	case *HashLiteral:
+		for key, value := range n.Pairs {
+			Inspect(key, fn)
+			Inspect(value, fn)
+		}
+
+	case *LiteralPattern:
+		Inspect(n.Value, fn)
+
+	case *ArrayPattern:
+		for _, element := range n.Elements {
+			Inspect(element, fn)
+		}
+		if n.Rest != nil {
+			Inspect(n.Rest, fn)
+		}
+
+	case *HashPattern:
+		for i, key := range n.Keys {
+			Inspect(key, fn)
+			Inspect(n.Values[i], fn)
+		}
+	}
+}
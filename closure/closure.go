@@ -0,0 +1,1028 @@
+// 闭包编译引擎：在执行之前把每一个 AST 节点编译为一个 Go 闭包（code），
+// 标识符在编译时就解析为栈帧的槽位，执行时不再需要按照节点类型分派，也不需要按照名称查找环境。
+// 运算规则、内置函数和对象类型都跟树遍历求值器共用
+package closure
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/core"
+	"interpreter/object"
+	"sort"
+	"strings"
+)
+
+// 编译好的节点，在栈帧 f 里执行，返回值的约定跟 evaluator.Eval 相同
+type code func(f *frame) object.Object
+
+// 将值绑定到模式里的标识符
+type binder func(f *frame, value object.Object) *object.Error
+
+type compiler struct {
+	globals *Globals
+}
+
+// 编译好的程序
+type Program struct {
+	code code
+}
+
+// 闭包编译引擎创建的函数。call 以实参和方法调用的接收者（不是方法调用时为 nil）执行函数体，
+// 返回函数的返回值或者错误
+type Function struct {
+	*object.Function
+	call    func(args []object.Object, self object.Object) object.Object
+	runtime *object.Runtime // 定义函数的程序的运行配置，用于限制函数调用的层数
+}
+
+// 编译程序，全局变量声明在 globals 里。
+// 局部变量所在的栈帧和槽位使用 core.Resolve 解析的结果，栈帧跟树遍历求值器的环境一一对应
+func Compile(program *ast.Program, globals *Globals) *Program {
+	if !program.Resolved {
+		core.Resolve(program, globals.Declared) // 引用了不存在的标识符的错误在执行到它时才报告
+	}
+
+	c := &compiler{globals: globals}
+	return &Program{code: c.compileProgram(program)}
+}
+
+// 执行程序，返回最后一条语句的值（没有值时为 nil），或者未被捕获的错误
+func (p *Program) Run() object.Object {
+	return p.code(nil)
+}
+
+func (c *compiler) compileProgram(program *ast.Program) code {
+	statements := c.compileStatements(program.Statements)
+
+	return func(f *frame) object.Object {
+		var result object.Object
+		for _, statement := range statements {
+			result = statement(f)
+
+			switch r := result.(type) {
+			case *object.ReturnValue:
+				return r.Value
+			case *object.Error:
+				return r
+			}
+		}
+		return result
+	}
+}
+
+func (c *compiler) compileStatements(statements []ast.Statement) []code {
+	codes := make([]code, len(statements))
+	for i, statement := range statements {
+		codes[i] = c.compile(statement)
+	}
+	return codes
+}
+
+// 依次执行语句，遇到 return、break、continue 或者错误时提前结束，否则返回最后一条语句的值
+func runStatements(statements []code) code {
+	return func(f *frame) object.Object {
+		var result object.Object
+		for _, statement := range statements {
+			result = statement(f)
+
+			switch result.(type) {
+			case *object.ReturnValue, *object.Error, *object.Break, *object.Continue:
+				return result
+			}
+		}
+		return result
+	}
+}
+
+// 语句块有自己的作用域，只有声明了标识符的语句块才需要创建栈帧
+func (c *compiler) compileBlock(block *ast.BlockStatement) code {
+	run := runStatements(c.compileStatements(block.Statements))
+
+	size := block.Slots
+	if size == 0 {
+		return run
+	}
+	return func(f *frame) object.Object {
+		return run(&frame{slots: make([]object.Object, size), parent: f})
+	}
+}
+
+func (c *compiler) compile(n ast.Node) code {
+	switch node := n.(type) {
+
+	// 语句
+	case *ast.ExpressionStatement:
+		return c.compile(node.Expression)
+
+	case *ast.LetStatement:
+		value := c.compile(node.Value)
+		bind := c.compileBinding(node.Name, node.Constant)
+		return func(f *frame) object.Object {
+			val := value(f)
+			if core.IsAbrupt(val) {
+				return val
+			}
+			if err := bind(f, val); err != nil {
+				return core.Located(node, err)
+			}
+			return nil
+		}
+
+	case *ast.ExportStatement:
+		return c.compile(node.Statement)
+
+	case *ast.ReturnStatement:
+		value := c.compile(node.ReturnValue)
+		return func(f *frame) object.Object {
+			val := value(f)
+			if core.IsError(val) {
+				return val
+			}
+			return &object.ReturnValue{Value: val}
+		}
+
+	case *ast.ThrowStatement:
+		value := c.compile(node.Value)
+		return func(f *frame) object.Object {
+			val := value(f)
+			if core.IsError(val) {
+				return val
+			}
+			return core.Located(node, core.ThrowValue(val))
+		}
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		return func(f *frame) object.Object { return core.BREAK }
+
+	case *ast.ContinueStatement:
+		return func(f *frame) object.Object { return core.CONTINUE }
+
+	case *ast.ImportStatement:
+		return c.compileImportStatement(node)
+
+	// 表达式
+	case *ast.PrefixExpression:
+		right := c.compile(node.Right)
+		strict := c.globals.runtime.Strict
+		return func(f *frame) object.Object {
+			r := right(f)
+			if core.IsError(r) {
+				return r
+			}
+			return core.Located(node, core.CheckOverflow(core.PrefixOperation(node.Operator, r), strict))
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		left := c.compile(node.Left)
+		right := c.compile(node.Right)
+		strict := c.globals.runtime.Strict
+		return func(f *frame) object.Object {
+			l := left(f)
+			if core.IsError(l) {
+				return l
+			}
+			r := right(f)
+			if core.IsError(r) {
+				return r
+			}
+			return core.Located(node, core.CheckOverflow(core.InfixOperation(node.Operator, l, r), strict))
+		}
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.CallExpression:
+		return c.compileCallExpression(node)
+
+	case *ast.IndexExpression:
+		left := c.compile(node.Left)
+		index := c.compile(node.Index)
+		return func(f *frame) object.Object {
+			l := left(f)
+			if core.IsError(l) {
+				return l
+			}
+			i := index(f)
+			if core.IsError(i) {
+				return i
+			}
+			return core.Located(node, core.Index(l, i))
+		}
+
+	case *ast.MemberExpression:
+		obj := c.compile(node.Object)
+		name := node.Property.Value
+		return func(f *frame) object.Object {
+			o := obj(f)
+			if core.IsError(o) {
+				return o
+			}
+			return core.Located(node, core.Member(o, name))
+		}
+
+	case *ast.Identifier:
+		if node.Value == "self" {
+			return c.compileSelf(node)
+		}
+		return c.compileLoad(node)
+
+	// 字面量，不可变的值只创建一次
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			integer := core.CheckOverflow(object.NewBigInteger(node.Big), c.globals.runtime.Strict)
+			return func(f *frame) object.Object {
+				return core.Located(node, integer)
+			}
+		}
+		integer := &object.Integer{Value: node.Value}
+		return func(f *frame) object.Object { return integer }
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		return func(f *frame) object.Object { return float }
+
+	case *ast.Boolean:
+		boolean := core.FALSE
+		if node.Value {
+			boolean = core.TRUE
+		}
+		return func(f *frame) object.Object { return boolean }
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		return func(f *frame) object.Object { return str }
+
+	case *ast.InterpolatedString:
+		parts := c.compileExpressions(node.Parts)
+		return func(f *frame) object.Object {
+			var out strings.Builder
+			for _, part := range parts {
+				value := part(f)
+				if core.IsError(value) {
+					return value
+				}
+				out.WriteString(value.Inspect())
+			}
+			return &object.String{Value: out.String()}
+		}
+
+	case *ast.ArrayLiteral:
+		elements := c.compileExpressions(node.Elements)
+		return func(f *frame) object.Object {
+			values, err := evalExpressions(f, elements)
+			if err != nil {
+				return err
+			}
+			return &object.Array{Elements: values}
+		}
+
+	case *ast.HashLiteral:
+		return c.compileHashLiteral(node)
+	}
+
+	return func(f *frame) object.Object {
+		return core.Located(n, &object.Error{Kind: object.INTERNAL_ERROR, Message: fmt.Sprintf("unsupported node: %T", n)})
+	}
+}
+
+func (c *compiler) compileExpressions(expressions []ast.Expression) []code {
+	codes := make([]code, len(expressions))
+	for i, expression := range expressions {
+		codes[i] = c.compile(expression)
+	}
+	return codes
+}
+
+// 依次对表达式求值，遇到错误时返回错误
+func evalExpressions(f *frame, expressions []code) ([]object.Object, object.Object) {
+	values := make([]object.Object, len(expressions))
+	for i, expression := range expressions {
+		value := expression(f)
+		if core.IsError(value) {
+			return nil, value
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// 按照解析的结果获取标识符的值，全局变量不存在时使用同名的内置函数
+func (c *compiler) compileLoad(node *ast.Identifier) code {
+	notFound := func() object.Object {
+		return core.NewErrorAt(node, object.NAME_ERROR, "identifier not found: %s", node.Value)
+	}
+
+	switch node.Resolution {
+	case ast.Local:
+	case ast.Builtin:
+		builtin := core.BuiltinAt(node.Index)
+		return func(f *frame) object.Object { return builtin }
+	default:
+		values := c.globals.values
+		index := c.globals.slot(node.Value)
+		builtin, isBuiltin := core.Builtins[node.Value]
+		return func(f *frame) object.Object {
+			if value := values.Values[index]; value != nil {
+				return value
+			}
+			if isBuiltin {
+				return builtin
+			}
+			return notFound()
+		}
+	}
+
+	depth, slot := node.Depth, node.Index
+
+	// 最常见的是当前栈帧以及外一层栈帧里的标识符
+	switch depth {
+	case 0:
+		return func(f *frame) object.Object {
+			if value := f.slots[slot]; value != nil {
+				return value
+			}
+			return notFound()
+		}
+	case 1:
+		return func(f *frame) object.Object {
+			if value := f.parent.slots[slot]; value != nil {
+				return value
+			}
+			return notFound()
+		}
+	default:
+		return func(f *frame) object.Object {
+			if value := up(f, depth).slots[slot]; value != nil {
+				return value
+			}
+			return notFound()
+		}
+	}
+}
+
+// 获取 self：方法调用时为方法所属的对象，否则依次使用外层函数的 self，
+// 直到遇到使用 let 或者形参声明的 self（只查找它所在的栈帧以内的函数），或者全局变量 self
+func (c *compiler) compileSelf(node *ast.Identifier) code {
+	depth := -1
+	if node.Resolution == ast.Local {
+		depth = node.Depth
+	}
+	load := c.compileLoad(node)
+
+	return func(f *frame) object.Object {
+		// 只有函数的栈帧才有接收者
+		for fr, d := f, depth; fr != nil && d != 0; fr, d = fr.parent, d-1 {
+			if fr.receiver != nil {
+				return fr.receiver
+			}
+		}
+		return load(f)
+	}
+}
+
+// 在当前作用域里声明标识符，返回给它赋值的 binder。全局变量是否重复声明在运行时才检查
+func (c *compiler) compileDeclare(name *ast.Identifier, constant bool) binder {
+	redeclared := func() *object.Error {
+		return core.Located(name, core.NewError(object.NAME_ERROR, "identifier %s has already been declared", name.Value)).(*object.Error)
+	}
+
+	if name.Resolution != ast.Local {
+		values := c.globals.values
+		index := c.globals.slot(name.Value)
+		return func(f *frame, value object.Object) *object.Error {
+			if values.Values[index] != nil {
+				return redeclared()
+			}
+			values.Values[index] = value
+			values.Constants[index] = constant
+			return nil
+		}
+	}
+
+	// 同一个作用域里同名的标识符解析到同一个槽位，槽位已经有值即是重复声明
+	slot := name.Index
+	return func(f *frame, value object.Object) *object.Error {
+		if f.slots[slot] != nil {
+			return redeclared()
+		}
+		f.slots[slot] = value
+		return nil
+	}
+}
+
+// 按照模式在当前作用域里声明标识符，返回解构并绑定值的 binder
+func (c *compiler) compileBinding(pattern ast.Pattern, constant bool) binder {
+	if identifier, ok := pattern.(*ast.Identifier); ok {
+		if identifier.Value == "_" {
+			return func(f *frame, value object.Object) *object.Error { return nil }
+		}
+		return c.compileDeclare(identifier, constant)
+	}
+
+	binders := map[*ast.Identifier]binder{}
+	ast.Inspect(pattern, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if node.Value != "_" {
+				binders[node] = c.compileDeclare(node, constant)
+			}
+		case *ast.LiteralPattern:
+			return false
+		}
+		return true
+	})
+
+	return func(f *frame, value object.Object) *object.Error {
+		return core.MatchPattern(pattern, value, func(name *ast.Identifier, value object.Object) *object.Error {
+			return binders[name](f, value)
+		})
+	}
+}
+
+// 逻辑运算 && 和 ||，短路求值，结果总是布尔值
+func (c *compiler) compileLogicalExpression(node *ast.InfixExpression) code {
+	left := c.compile(node.Left)
+	right := c.compile(node.Right)
+	and := node.Operator == "&&"
+
+	return func(f *frame) object.Object {
+		l := left(f)
+		if core.IsError(l) {
+			return l
+		}
+
+		leftValue := core.IsTruthy(l)
+		if and && !leftValue {
+			return core.FALSE
+		}
+		if !and && leftValue {
+			return core.TRUE
+		}
+
+		r := right(f)
+		if core.IsError(r) {
+			return r
+		}
+		return core.NativeBoolToBooleanObject(core.IsTruthy(r))
+	}
+}
+
+func (c *compiler) compileIfExpression(node *ast.IfExpression) code {
+	condition := c.compile(node.Condition)
+	consequence := c.compileBlock(node.Consequence)
+	var alternative code
+	if node.Alternative != nil {
+		alternative = c.compileBlock(node.Alternative)
+	}
+
+	return func(f *frame) object.Object {
+		cond := condition(f)
+		if core.IsError(cond) {
+			return cond
+		}
+
+		if core.IsTruthy(cond) {
+			return consequence(f)
+		} else if alternative != nil {
+			return alternative(f)
+		}
+		return core.NULL
+	}
+}
+
+func (c *compiler) compileWhileStatement(node *ast.WhileStatement) code {
+	condition := c.compile(node.Condition)
+	body := c.compileBlock(node.Body)
+
+	return func(f *frame) object.Object {
+		for {
+			cond := condition(f)
+			if core.IsError(cond) {
+				return cond
+			}
+			if !core.IsTruthy(cond) {
+				return core.NULL
+			}
+
+			if result, done := loopBody(body(f)); done {
+				return result
+			}
+		}
+	}
+}
+
+// for-in 循环，每一次迭代都在新的栈帧里绑定循环变量，
+// 因此在循环体里创建的闭包捕获的是当次迭代的值
+func (c *compiler) compileForStatement(node *ast.ForStatement) code {
+	iterable := c.compile(node.Iterable)
+
+	slot := node.Variable.Index // 迭代的栈帧只有循环变量一个槽位
+	body := c.compileBlock(node.Body)
+
+	return func(f *frame) object.Object {
+		value := iterable(f)
+		if core.IsError(value) {
+			return value
+		}
+
+		it, err := core.NewIterator(value)
+		if err != nil {
+			return core.Located(node, err)
+		}
+
+		for value, ok := it.Next(); ok; value, ok = it.Next() {
+			loopFrame := &frame{slots: make([]object.Object, 1), parent: f}
+			loopFrame.slots[slot] = value
+
+			if result, done := loopBody(body(loopFrame)); done {
+				return result
+			}
+		}
+		return core.NULL
+	}
+}
+
+// 处理循环体执行一次的结果，如果需要结束循环（遇到 break、return 或者错误），则 done 为 true，
+// 此时 result 为整个循环语句的值
+func loopBody(evaluated object.Object) (result object.Object, done bool) {
+	switch evaluated.(type) {
+	case *object.ReturnValue, *object.Error:
+		return evaluated, true
+	case *object.Break:
+		return core.NULL, true
+	default:
+		return nil, false
+	}
+}
+
+// 依次尝试各个分支的模式，执行第一个匹配的分支，没有分支匹配时返回 NULL
+func (c *compiler) compileMatchExpression(node *ast.MatchExpression) code {
+	type arm struct {
+		slots int // 存放模式绑定的变量的栈帧的槽位数量，没有绑定变量时不创建栈帧
+		bind  binder
+		body  code
+	}
+
+	subject := c.compile(node.Subject)
+	arms := []arm{}
+	for _, a := range node.Arms {
+		arms = append(arms, arm{slots: a.Slots, bind: c.compileBinding(a.Pattern, false), body: c.compileBlock(a.Body)})
+	}
+
+	return func(f *frame) object.Object {
+		value := subject(f)
+		if core.IsError(value) {
+			return value
+		}
+
+		for _, arm := range arms {
+			armFrame := f
+			if arm.slots > 0 {
+				armFrame = &frame{slots: make([]object.Object, arm.slots), parent: f}
+			}
+			if arm.bind(armFrame, value) == nil {
+				return arm.body(armFrame)
+			}
+		}
+		return core.NULL
+	}
+}
+
+// try 表达式，规则见 evaluator 的 evalTryExpression
+func (c *compiler) compileTryExpression(node *ast.TryExpression) code {
+	block := c.compileBlock(node.Block)
+
+	// catch 语句块跟参数共用同一个栈帧
+	var bind binder
+	var catch code
+	if node.Catch != nil {
+		if node.Parameter != nil {
+			bind = c.compileBinding(node.Parameter, false)
+		}
+		catch = runStatements(c.compileStatements(node.Catch.Statements))
+	}
+
+	var finally code
+	if node.Finally != nil {
+		finally = c.compileBlock(node.Finally)
+	}
+
+	return func(f *frame) object.Object {
+		result := block(f)
+
+		if err, ok := result.(*object.Error); ok && catch != nil {
+			catchFrame := f
+			if slots := node.Catch.Slots; slots > 0 {
+				catchFrame = &frame{slots: make([]object.Object, slots), parent: f}
+			}
+			if bind != nil {
+				if bindErr := bind(catchFrame, core.ErrorValue(err)); bindErr != nil {
+					return core.Located(node, bindErr)
+				}
+			}
+			result = catch(catchFrame)
+		}
+
+		if finally != nil {
+			switch finally := finally(f).(type) {
+			case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+				return finally
+			}
+		}
+
+		if result == nil {
+			return core.NULL
+		}
+		return result
+	}
+}
+
+// 赋值表达式，规则见 evaluator 的 evalAssignExpression
+func (c *compiler) compileAssignExpression(node *ast.AssignExpression) code {
+	operator := strings.TrimSuffix(node.Operator, "=")
+	value := c.compile(node.Value)
+	strict := c.globals.runtime.Strict
+
+	// 计算赋值表达式右侧的值，对于复合赋值，current 用于获取目标的当前值
+	assignedValue := func(f *frame, current func() object.Object) object.Object {
+		val := value(f)
+		if core.IsAbrupt(val) || node.Operator == "=" {
+			return val
+		}
+
+		left := current()
+		if core.IsError(left) {
+			return left
+		}
+		return core.CheckOverflow(core.InfixOperation(operator, left, val), strict)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return c.compileAssignIdentifier(node, target, assignedValue)
+
+	case *ast.IndexExpression:
+		left := c.compile(target.Left)
+		index := c.compile(target.Index)
+		return func(f *frame) object.Object {
+			l := left(f)
+			if core.IsError(l) {
+				return l
+			}
+			i := index(f)
+			if core.IsError(i) {
+				return i
+			}
+
+			val := assignedValue(f, func() object.Object {
+				return core.Index(l, i)
+			})
+			if core.IsAbrupt(val) {
+				return core.Located(node, val)
+			}
+			return core.Located(node, core.AssignIndex(l, i, val))
+		}
+
+	case *ast.MemberExpression:
+		obj := c.compile(target.Object)
+		name := &object.String{Value: target.Property.Value}
+		return func(f *frame) object.Object {
+			o := obj(f)
+			if core.IsError(o) {
+				return o
+			}
+			if _, ok := o.(*object.Hash); !ok {
+				return core.Located(node, core.NewError(object.TYPE_ERROR, "member assignment not supported: %s.%s", o.Type(), name.Value))
+			}
+
+			val := assignedValue(f, func() object.Object {
+				return core.Member(o, name.Value)
+			})
+			if core.IsAbrupt(val) {
+				return core.Located(node, val)
+			}
+			return core.Located(node, core.AssignIndex(o, name, val))
+		}
+
+	default:
+		return func(f *frame) object.Object {
+			return core.Located(node, core.NewError(object.TYPE_ERROR, "invalid assignment target: %s", node.Target.String()))
+		}
+	}
+}
+
+func (c *compiler) compileAssignIdentifier(node *ast.AssignExpression, target *ast.Identifier,
+	assignedValue func(*frame, func() object.Object) object.Object) code {
+
+	name := target.Value
+
+	// 获取和修改标识符的值所在的位置
+	var slot func(f *frame) (values []object.Object, index int)
+	var constant func() bool
+	if target.Resolution == ast.Local {
+		depth, index := target.Depth, target.Index
+		slot = func(f *frame) ([]object.Object, int) { return up(f, depth).slots, index }
+		constant = func() bool { return target.Constant }
+	} else {
+		values := c.globals.values
+		index := c.globals.slot(name)
+		slot = func(f *frame) ([]object.Object, int) { return values.Values, index }
+		constant = func() bool { return values.Constants[index] }
+	}
+
+	return func(f *frame) object.Object {
+		values, index := slot(f)
+		val := assignedValue(f, func() object.Object {
+			if current := values[index]; current != nil {
+				return current
+			}
+			return core.NewError(object.NAME_ERROR, "identifier not found: %s", name)
+		})
+		if core.IsAbrupt(val) {
+			return core.Located(node, val)
+		}
+
+		if constant() {
+			return core.Located(node, core.NewError(object.NAME_ERROR, "cannot assign to constant: %s", name))
+		}
+		if values[index] == nil {
+			return core.Located(node, core.NewError(object.NAME_ERROR, "cannot assign to undefined variable: %s", name))
+		}
+		values[index] = val
+		return val
+	}
+}
+
+func (c *compiler) compileFunctionLiteral(node *ast.FunctionLiteral) code {
+	type parameter struct {
+		defaultValue code
+		bind         binder
+	}
+
+	// 函数体跟形参共用同一个栈帧，即函数体里不能重新声明形参
+	size := node.Body.Slots
+
+	// 默认值在绑定前面的形参之后求值，因此可以引用前面的形参
+	params := []parameter{}
+	for i, param := range node.Parameters {
+		var defaultValue code
+		if i < len(node.Defaults) && node.Defaults[i] != nil {
+			defaultValue = c.compile(node.Defaults[i])
+		}
+		params = append(params, parameter{defaultValue: defaultValue, bind: c.compileBinding(param, false)})
+	}
+
+	// 剩余参数跟同名的形参共用槽位，即覆盖形参
+	restSlot := -1
+	if node.Rest != nil {
+		restSlot = node.Rest.Index
+	}
+
+	body := runStatements(c.compileStatements(node.Body.Statements))
+
+	runtime := c.globals.runtime
+
+	return func(f *frame) object.Object {
+		fn := &Function{Function: &object.Function{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Body:       node.Body,
+			Name:       node.Name,
+			Pos:        node.Pos(),
+			End:        node.End(),
+		}, runtime: runtime}
+
+		// 函数的栈帧的上一层是定义函数时的栈帧，即静态范围(static scope)
+		fn.call = func(args []object.Object, self object.Object) object.Object {
+			callFrame := &frame{slots: make([]object.Object, size), parent: f, receiver: self}
+
+			for i, param := range params {
+				var value object.Object
+				if i < len(args) {
+					value = args[i]
+				} else {
+					value = param.defaultValue(callFrame)
+					if core.IsError(value) {
+						return value
+					}
+				}
+
+				if err := param.bind(callFrame, value); err != nil {
+					return err
+				}
+			}
+
+			if restSlot >= 0 {
+				rest := []object.Object{}
+				if len(args) > len(params) {
+					rest = append(rest, args[len(params):]...)
+				}
+				callFrame.slots[restSlot] = &object.Array{Elements: rest}
+			}
+
+			result := body(callFrame)
+			if returnValue, ok := result.(*object.ReturnValue); ok {
+				return returnValue.Value
+			}
+			if result == nil {
+				return core.NULL // 函数体为空，或者最后一条语句是 let 语句
+			}
+			return result
+		}
+
+		return fn
+	}
+}
+
+func (c *compiler) compileCallExpression(node *ast.CallExpression) code {
+	arguments := c.compileExpressions(node.Arguments)
+	strict := c.globals.runtime.Strict
+	tail := node.Tail
+
+	// 方法调用 obj.method(args)：先对 obj 求值，然后以 self 的名义传给被调用的函数
+	var receiver code
+	var function code
+	var method string
+	if member, ok := node.Function.(*ast.MemberExpression); ok {
+		receiver = c.compile(member.Object)
+		method = member.Property.Value
+	} else {
+		function = c.compile(node.Function)
+	}
+
+	return func(f *frame) object.Object {
+		var self object.Object
+		var fn object.Object
+		if receiver != nil {
+			self = receiver(f)
+			if core.IsError(self) {
+				return self
+			}
+			fn = core.Member(self, method)
+
+			// 模块的成员函数 m.fn(args) 只是普通的函数调用
+			if _, ok := self.(*object.Module); ok {
+				self = nil
+			}
+		} else {
+			fn = function(f)
+		}
+
+		if core.IsError(fn) {
+			return core.Located(node, fn)
+		}
+
+		args, err := evalExpressions(f, arguments)
+		if err != nil {
+			return err
+		}
+
+		// 尾调用交给所在函数的调用者执行，见 applyFunction
+		if tail {
+			return &object.TailCall{Function: fn, Arguments: args, Self: self, Call: node}
+		}
+
+		result := applyFunction(fn, args, self)
+
+		// 错误从函数里向外传递时，逐层记录调用的位置，从而得到出错时的调用栈
+		if err, ok := result.(*object.Error); ok {
+			err.Trace = append(err.Trace, object.StackFrame{
+				Function: core.FunctionName(node, fn),
+				Pos:      node.Pos(),
+			})
+		}
+		return core.Located(node, core.CheckOverflow(result, strict))
+	}
+}
+
+// 调用函数，对于方法调用 obj.method(args)，self 为 obj，否则为 nil。
+// 函数返回的尾调用在这里循环地执行（见 core.RunTailCalls），因此尾递归不会增加 Go 的调用栈的深度
+func applyFunction(fn object.Object, args []object.Object, self object.Object) object.Object {
+	return core.RunTailCalls(callFunction(fn, args, self), callFunction)
+}
+
+// 执行一次函数调用，结果可能是函数在尾部位置的调用
+func callFunction(fn object.Object, args []object.Object, self object.Object) object.Object {
+	switch f := fn.(type) {
+	case *Function:
+		var result object.Object
+		if err := core.CheckArity(f.Function, len(args)); err != nil {
+			result = err
+		} else if err := core.EnterCall(f.runtime); err != nil {
+			return err
+		} else {
+			result = f.call(args, self)
+			core.LeaveCall(f.runtime)
+		}
+
+		if err, ok := result.(*object.Error); ok {
+			core.DefinedHere(err, f.Function)
+		}
+		return result
+
+	case *object.Builtin:
+		return f.Fn(args...)
+	}
+
+	return core.NewError(object.TYPE_ERROR, "not a function: %s", fn.Type())
+}
+
+func (c *compiler) compileHashLiteral(node *ast.HashLiteral) code {
+	// 按照源码里的顺序求值，使得求值的顺序是确定的
+	keyNodes := []ast.Expression{}
+	for key := range node.Pairs {
+		keyNodes = append(keyNodes, key)
+	}
+	sort.Slice(keyNodes, func(i, j int) bool {
+		return keyNodes[i].Pos().Offset < keyNodes[j].Pos().Offset
+	})
+
+	keys := c.compileExpressions(keyNodes)
+	values := []code{}
+	for _, key := range keyNodes {
+		values = append(values, c.compile(node.Pairs[key]))
+	}
+
+	return func(f *frame) object.Object {
+		pairs := make(map[object.HashKey]object.HashPair, len(keys))
+
+		for i, key := range keys {
+			k := key(f)
+			if core.IsError(k) {
+				return k
+			}
+
+			hashKey, err := core.HashKey(k)
+			if err != nil {
+				return core.Located(node, err)
+			}
+
+			v := values[i](f)
+			if core.IsError(v) {
+				return v
+			}
+
+			pairs[hashKey] = object.HashPair{Key: k, Value: v}
+		}
+		return &object.Hash{Pairs: pairs}
+	}
+}
+
+func (c *compiler) compileImportStatement(node *ast.ImportStatement) code {
+	var alias binder
+	if node.Alias != nil {
+		alias = c.compileDeclare(node.Alias, false)
+	}
+
+	locals := []binder{}
+	for _, local := range node.Locals {
+		locals = append(locals, c.compileDeclare(local, false))
+	}
+
+	return func(f *frame) object.Object {
+		module, err := core.LoadModule(c.globals.runtime, node, runModule)
+		if err != nil {
+			return err
+		}
+
+		if alias != nil {
+			if err := alias(f, module); err != nil {
+				return err
+			}
+		}
+
+		for i, name := range node.Names {
+			value, ok := module.Export(name.Value)
+			if !ok {
+				return core.Located(name, core.NewError(object.NAME_ERROR, "module %s has no exported member %s", module.Path, name.Value))
+			}
+			if err := locals[i](f, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,23 @@
+package closure
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// 编译并执行模块，模块有自己的全局变量。
+// 模块的顶层环境由执行完毕之后的全局变量构成，模块跟导入者使用同一个运行配置
+func runModule(program *ast.Program, runtime *object.Runtime) (*object.Environment, *object.Error) {
+	globals := NewGlobals(runtime)
+	if err, ok := Compile(program, globals).Run().(*object.Error); ok {
+		return nil, err
+	}
+
+	env := object.NewEnvironment()
+	for i, name := range globals.values.Names {
+		if value := globals.values.Values[i]; value != nil {
+			env.Declare(name, value, globals.values.Constants[i])
+		}
+	}
+	return env, nil
+}
@@ -0,0 +1,49 @@
+package closure
+
+import "interpreter/object"
+
+// 栈帧，对应一次函数调用或者一个声明了标识符的语句块，标识符按照编译时分配的槽位存放
+type frame struct {
+	slots    []object.Object // 尚未声明的标识符为 nil
+	parent   *frame          // 外层的栈帧，对于函数则是定义函数时的栈帧
+	receiver object.Object   // 方法调用的接收者，只用于函数的栈帧，不是方法调用时为 nil
+}
+
+// 全局作用域（主程序或者模块的顶层），全局变量按照名称分配槽位，REPL 的多次输入共用同一个全局作用域
+type Globals struct {
+	values  *object.Globals
+	symbols map[string]int
+	runtime *object.Runtime // 本次运行的配置，模块跟导入者使用同一个配置
+}
+
+func NewGlobals(runtime *object.Runtime) *Globals {
+	return &Globals{values: &object.Globals{}, symbols: map[string]int{}, runtime: runtime}
+}
+
+// 全局变量 name 是否已经声明
+func (g *Globals) Declared(name string) bool {
+	return g.values.Declared(name)
+}
+
+// 获取全局变量的槽位，第一次遇到的名称分配新的槽位。
+// 全局变量是否已经声明、是否常量在运行时才检查，所以引用后面才声明的全局变量不需要特殊处理
+func (g *Globals) slot(name string) int {
+	if index, ok := g.symbols[name]; ok {
+		return index
+	}
+
+	index := len(g.values.Names)
+	g.symbols[name] = index
+	g.values.Names = append(g.values.Names, name)
+	g.values.Values = append(g.values.Values, nil)
+	g.values.Constants = append(g.values.Constants, false)
+	return index
+}
+
+// 往外第 depth 层栈帧
+func up(f *frame, depth int) *frame {
+	for ; depth > 0; depth-- {
+		f = f.parent
+	}
+	return f
+}
@@ -0,0 +1,291 @@
+// original from https://compilerbook.com/
+
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// 字节码指令序列，每条指令由 1 个字节的操作码和若干个操作数组成，
+// 操作数按照大端字节序存放
+type Instructions []byte
+
+// 反汇编，每行一条指令，格式为 "偏移量 操作码名称 操作数..."，用于调试、测试
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(def.Name)
+	for _, operand := range operands {
+		fmt.Fprintf(&out, " %d", operand)
+	}
+	return out.String()
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // 压入常量池里的常量
+	OpNull
+	OpTrue
+	OpFalse
+
+	OpPop  // 弹出栈顶的值
+	OpDup  // 复制栈顶的值
+	OpSwap // 交换栈顶的两个值
+	OpPick // 复制栈顶往下第 n 个值（栈顶为第 0 个）到栈顶
+
+	// 中缀运算，弹出右操作数和左操作数，压入运算结果
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+
+	// 前缀运算
+	OpMinus
+	OpPlus
+	OpBang
+
+	OpJump           // 无条件跳转
+	OpJumpNotTruthy  // 弹出栈顶的值，如果为假则跳转
+	OpJumpTruthy     // 弹出栈顶的值，如果为真则跳转
+	OpJumpNotMissing // 如果栈顶的值存在（比如传入了实参）则跳转，否则弹出栈顶的值
+	OpError          // 抛出常量池里的错误（的副本），用于编译时就能确定的错误，比如给常量赋值
+	OpThrow          // 弹出栈顶的值，将它转换为错误并抛出
+	OpRethrow        // 弹出栈顶的错误，原样重新抛出，用于执行完 finally 语句块之后
+	OpErrorValue     // 将栈顶的错误转换为映射表，用于 catch 的参数
+	OpSetupLoop      // 进入循环，记录当前的栈顶位置，用于 break 和 continue
+	OpSetupTry       // 进入 try 语句块，操作数为发生错误时跳转的位置
+	OpPopBlock       // 离开循环或者 try 语句块
+	OpBreak          // 恢复循环开始时的栈顶位置，然后跳出循环
+	OpContinue       // 恢复循环开始时的栈顶位置，然后跳到下一次迭代
+	OpGetIterator    // 将栈顶的值转换为迭代器
+	OpIterNext       // 压入迭代器的下一个元素，迭代结束时跳转
+	OpGetGlobal      // 压入全局变量，全局变量不存在时使用同名的内置函数
+	OpDefineGlobal   // 弹出栈顶的值，声明全局变量，第二个操作数为 1 时声明为常量
+	OpSetGlobal      // 弹出栈顶的值，给已经声明的全局变量赋值
+	OpGetLocal       // 压入局部变量
+	OpSetLocal       // 弹出栈顶的值，赋值给局部变量
+	OpNewCell        // 在局部变量的槽位里创建新的 cell，用于被闭包捕获的局部变量
+	OpMakeCell       // 将局部变量的值包装为 cell
+	OpGetCell        // 压入局部变量的 cell 里的值
+	OpSetCell        // 弹出栈顶的值，存入局部变量的 cell
+	OpCheckDefined   // 栈顶的值不存在时报告 "标识符不存在" 的错误，操作数为常量池里的名称，用于后面才声明的标识符
+	OpGetFree        // 压入闭包捕获的变量
+	OpSetFree        // 弹出栈顶的值，赋值给闭包捕获的变量
+	OpCaptureLocal   // 压入局部变量的 cell 本身，用于创建闭包
+	OpCaptureFree    // 压入闭包捕获的 cell 本身，用于创建闭包
+	OpClosure        // 由常量池里的函数和栈顶的若干个 cell 创建闭包
+	OpReceiver       // 压入方法调用的接收者，即 self，不是方法调用时压入 "不存在"
+	OpDestructure    // 弹出栈顶的值，按照常量池里的模式解构并绑定标识符
+	OpMatch          // 按照常量池里的模式匹配栈顶的值（不弹出），不匹配时跳转
+	OpArray          // 由栈顶的 n 个值创建数组
+	OpHash           // 由栈顶的 n 对 key/value 创建映射表
+	OpInterpolate    // 由栈顶的 n 个值拼接插值字符串
+	OpIndex          // 索引运算 left[index]
+	OpSetIndex       // 弹出 value、index、left，执行 left[index] = value，压入 value
+	OpMember         // 成员访问 obj.name，操作数为常量池里的名称
+	OpMemberTarget   // 检查栈顶的值可以作为成员赋值的目标
+	OpCall           // 调用函数，操作数为实参的数量
+	OpCallMethod     // 调用方法，被调用的函数下面是接收者
+	OpTailCall       // 尾部位置的函数调用，被调用的函数复用当前函数的栈帧
+	OpTailCallMethod // 尾部位置的方法调用
+	OpReturnValue    // 从函数返回栈顶的值
+	OpReturn         // 从主程序返回，没有值
+	OpImport         // 加载 import 语句所指的模块，压入模块
+	OpImportName     // 压入栈顶的模块导出的名称，操作数为常量池里的名称
+)
+
+type Definition struct {
+	Name          string // 操作码的名称，用于调试
+	OperandWidths []int  // 每个操作数的字节数
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpNull:     {"OpNull", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+
+	OpPop:  {"OpPop", []int{}},
+	OpDup:  {"OpDup", []int{}},
+	OpSwap: {"OpSwap", []int{}},
+	OpPick: {"OpPick", []int{1}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpMod:         {"OpMod", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpPlus:  {"OpPlus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJump:           {"OpJump", []int{2}},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpJumpTruthy:     {"OpJumpTruthy", []int{2}},
+	OpJumpNotMissing: {"OpJumpNotMissing", []int{2}},
+	OpError:          {"OpError", []int{2}},
+	OpThrow:          {"OpThrow", []int{}},
+	OpRethrow:        {"OpRethrow", []int{}},
+	OpErrorValue:     {"OpErrorValue", []int{}},
+	OpSetupLoop:      {"OpSetupLoop", []int{}},
+	OpSetupTry:       {"OpSetupTry", []int{2}},
+	OpPopBlock:       {"OpPopBlock", []int{}},
+	OpBreak:          {"OpBreak", []int{2}},
+	OpContinue:       {"OpContinue", []int{2}},
+	OpGetIterator:    {"OpGetIterator", []int{}},
+	OpIterNext:       {"OpIterNext", []int{2}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpDefineGlobal:   {"OpDefineGlobal", []int{2, 1}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{2}},
+	OpSetLocal:       {"OpSetLocal", []int{2}},
+	OpNewCell:        {"OpNewCell", []int{2}},
+	OpMakeCell:       {"OpMakeCell", []int{2}},
+	OpGetCell:        {"OpGetCell", []int{2}},
+	OpSetCell:        {"OpSetCell", []int{2}},
+	OpCheckDefined:   {"OpCheckDefined", []int{2}},
+	OpGetFree:        {"OpGetFree", []int{2}},
+	OpSetFree:        {"OpSetFree", []int{2}},
+	OpCaptureLocal:   {"OpCaptureLocal", []int{2}},
+	OpCaptureFree:    {"OpCaptureFree", []int{2}},
+	OpClosure:        {"OpClosure", []int{2, 2}},
+	OpReceiver:       {"OpReceiver", []int{}},
+	OpDestructure:    {"OpDestructure", []int{2}},
+	OpMatch:          {"OpMatch", []int{2, 2}},
+	OpArray:          {"OpArray", []int{2}},
+	OpHash:           {"OpHash", []int{2}},
+	OpInterpolate:    {"OpInterpolate", []int{2}},
+	OpIndex:          {"OpIndex", []int{}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpMember:         {"OpMember", []int{2}},
+	OpMemberTarget:   {"OpMemberTarget", []int{2}},
+	OpCall:           {"OpCall", []int{1}},
+	OpCallMethod:     {"OpCallMethod", []int{1}},
+	OpTailCall:       {"OpTailCall", []int{1}},
+	OpTailCallMethod: {"OpTailCallMethod", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpImport:         {"OpImport", []int{}},
+	OpImportName:     {"OpImportName", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// 生成一条指令
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// 检查操作数是否超出了它在指令里占用的宽度（比如常量的索引、跳转的目标、数组元素的数量），
+// 超出时 Make 会把它截断
+func CheckOperands(op Opcode, operands ...int) error {
+	def, ok := definitions[op]
+	if !ok {
+		return fmt.Errorf("opcode %d undefined", op)
+	}
+
+	for i, o := range operands {
+		max := 1<<(8*def.OperandWidths[i]) - 1
+		if o < 0 || o > max {
+			return fmt.Errorf("operand of %s out of range: %d (maximum %d)", def.Name, o, max)
+		}
+	}
+	return nil
+}
+
+// 读取指令的操作数，返回操作数以及它们占用的字节数
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
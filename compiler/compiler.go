@@ -0,0 +1,1280 @@
+// original from https://compilerbook.com/
+
+package compiler
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/core"
+	"interpreter/object"
+	"sort"
+	"strings"
+)
+
+// 正在编译的函数（或者主程序）
+type CompilationScope struct {
+	instructions code.Instructions
+	nodes        []InstructionNode
+	numLocals    int
+	free         []Symbol        // 捕获的外层变量，即外层函数里的符号
+	captured     map[string]bool // 被内层函数引用的标识符名称，声明这些标识符时使用 cell
+	regions      []*region       // 当前所在的循环和 try 语句块，由外到内
+	parent       *CompilationScope
+}
+
+// 循环或者 try 语句块，break、continue 和 return 离开它们时需要做一些善后工作
+type region struct {
+	loop           bool
+	breaks         []int // 循环里的 OpBreak 指令的位置，循环结束时填入跳转的目标
+	continueTarget int
+
+	finally *ast.BlockStatement // try 语句的 finally 语句块，离开 try 语句块时需要执行
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	globals     *SymbolTable
+	symbolTable *SymbolTable // 当前作用域的符号表
+	scope       *CompilationScope
+
+	node ast.Node // 正在编译的节点，生成的指令对应这个节点，用于报告运行时错误的位置
+
+	// 第一个超出指令宽度的操作数（比如常量池里有太多常量，或者函数体太长使得跳转的目标超出范围），
+	// 生成指令时记录下来，编译每一条语句之后报告
+	operandErr error
+}
+
+// 编译的结果
+type Bytecode struct {
+	Main        *CompiledFunction
+	Constants   []object.Object
+	GlobalNames []string
+}
+
+// 解构模式，作为常量存放在常量池里，用于 let 语句、函数的形参、match 表达式的分支等
+type Pattern struct {
+	Pattern  ast.Pattern
+	Bindings map[*ast.Identifier]Binding // 模式里的每一个标识符绑定的目标
+}
+
+type Binding struct {
+	Symbol     Symbol
+	Redeclared bool // 标识符已经在同一个作用域里声明过，绑定时报告错误
+}
+
+const PATTERN_OBJ = "PATTERN"
+
+func (p *Pattern) Type() object.ObjectType { return PATTERN_OBJ }
+func (p *Pattern) Inspect() string         { return p.Pattern.String() }
+
+// 编译为字节码的函数（或者主程序）
+type CompiledFunction struct {
+	Instructions code.Instructions
+	NumLocals    int                  // 局部变量（包括形参）占用的槽位数量
+	Literal      *ast.FunctionLiteral // 函数字面量，主程序为 nil
+	Nodes        []InstructionNode    // 指令对应的 AST 节点，按照指令的偏移量排列
+	Constants    []object.Object      // 所在程序的常量池
+}
+
+// 指令跟生成它的 AST 节点的对应关系，用于报告错误的位置
+type InstructionNode struct {
+	Offset int
+	Node   ast.Node
+}
+
+const COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION" // 编译为字节码的函数，位于常量池里
+
+func (cf *CompiledFunction) Type() object.ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// 获取偏移量 offset 所在的指令对应的 AST 节点
+func (cf *CompiledFunction) NodeAt(offset int) ast.Node {
+	i := sort.Search(len(cf.Nodes), func(i int) bool {
+		return cf.Nodes[i].Offset > offset
+	})
+	if i == 0 {
+		return nil
+	}
+	return cf.Nodes[i-1].Node
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// 使用已有的全局符号表和常量池，用于 REPL：每一行输入都编译为新的主程序，
+// 但是它们共享全局变量
+func NewWithState(globals *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		globals:     globals,
+		symbolTable: globals,
+	}
+}
+
+func (c *Compiler) Compile(program *ast.Program) error {
+	// 局部变量按照解析的结果编译。没有经过解析的程序（比如测试里直接编译的程序）在这里解析，
+	// 引用了不存在的标识符时仍然编译为全局变量，在运行时报告错误
+	if !program.Resolved {
+		core.Resolve(program, nil)
+	}
+
+	c.scope = &CompilationScope{captured: capturedNames(program)}
+	c.node = program
+
+	for i, statement := range program.Statements {
+		value, err := c.compileStatement(statement)
+		if err == nil {
+			err = c.operandErr
+		}
+		if err != nil {
+			return err
+		}
+
+		// 程序的值是最后一条语句的值，let 语句等没有值
+		last := i == len(program.Statements)-1
+		switch {
+		case value && !last:
+			c.emit(code.OpPop)
+		case value && last:
+			c.emit(code.OpReturnValue)
+		case last:
+			c.emit(code.OpReturn)
+		}
+	}
+
+	if len(program.Statements) == 0 {
+		c.emit(code.OpReturn)
+	}
+
+	return c.operandErr
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	main := &CompiledFunction{
+		Instructions: c.scope.instructions,
+		NumLocals:    c.scope.numLocals,
+		Nodes:        c.scope.nodes,
+		Constants:    c.constants,
+	}
+
+	// 常量池在编译期间不断增长，编译完成之后才让每个函数引用最终的常量池。
+	// 常量池只会追加，所以 REPL 里先前编译的函数使用旧的常量池也没有问题
+	for _, constant := range c.constants {
+		if fn, ok := constant.(*CompiledFunction); ok {
+			fn.Constants = c.constants
+		}
+	}
+
+	return &Bytecode{
+		Main:        main,
+		Constants:   c.constants,
+		GlobalNames: c.globals.GlobalNames(),
+	}
+}
+
+// 编译语句，value 表示语句是否在栈顶留下一个值
+func (c *Compiler) compileStatement(statement ast.Statement) (value bool, err error) {
+	saved := c.node
+	c.node = statement
+	defer func() { c.node = saved }()
+
+	switch node := statement.(type) {
+	case *ast.ExpressionStatement:
+		return true, c.compile(node.Expression)
+
+	case *ast.LetStatement:
+		if err := c.compile(node.Value); err != nil {
+			return false, err
+		}
+		c.bindPattern(node.Name, node.Constant)
+
+	case *ast.ExportStatement:
+		return c.compileStatement(node.Statement)
+
+	case *ast.ReturnStatement:
+		if err := c.compile(node.ReturnValue); err != nil {
+			return false, err
+		}
+		// 离开 try 语句块之前先执行 finally 语句块
+		for i := len(c.scope.regions) - 1; i >= 0; i-- {
+			if !c.scope.regions[i].loop {
+				if err := c.leaveRegion(i); err != nil {
+					return false, err
+				}
+			}
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.ThrowStatement:
+		if err := c.compile(node.Value); err != nil {
+			return false, err
+		}
+		c.emit(code.OpThrow)
+
+	case *ast.WhileStatement:
+		return true, c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return true, c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		return false, c.compileLoopJump(true)
+
+	case *ast.ContinueStatement:
+		return false, c.compileLoopJump(false)
+
+	case *ast.ImportStatement:
+		c.compileImportStatement(node)
+
+	default:
+		return false, fmt.Errorf("unsupported statement: %T", statement)
+	}
+
+	return false, nil
+}
+
+// 编译表达式，表达式的值留在栈顶
+func (c *Compiler) compile(n ast.Node) error {
+	saved := c.node
+	c.node = n
+	defer func() { c.node = saved }()
+
+	switch node := n.(type) {
+	case *ast.PrefixExpression:
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		case "+":
+			c.emit(code.OpPlus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		return c.emitOperator(node.Operator)
+
+	case *ast.IfExpression:
+		if err := c.compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBlock(node.Consequence); err != nil {
+			return err
+		}
+		jump := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(jumpNotTruthy, len(c.scope.instructions))
+		if node.Alternative != nil {
+			if err := c.compileBlock(node.Alternative); err != nil {
+				return err
+			}
+		} else {
+			c.emit(code.OpNull)
+		}
+		c.changeOperand(jump, len(c.scope.instructions))
+
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.CallExpression:
+		// 方法调用 obj.method(args)：栈上依次为 obj、method 和实参
+		op, tailOp := code.OpCall, code.OpTailCall
+		if member, ok := node.Function.(*ast.MemberExpression); ok {
+			if err := c.compile(member.Object); err != nil {
+				return err
+			}
+			c.emit(code.OpDup)
+			c.emit(code.OpMember, c.addConstant(&object.String{Value: member.Property.Value}))
+			op, tailOp = code.OpCallMethod, code.OpTailCallMethod
+		} else if err := c.compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, argument := range node.Arguments {
+			if err := c.compile(argument); err != nil {
+				return err
+			}
+		}
+		if len(node.Arguments) > 255 {
+			return fmt.Errorf("too many arguments: %d", len(node.Arguments))
+		}
+
+		// 尾调用复用当前函数的栈帧
+		if node.Tail {
+			op = tailOp
+		}
+		c.emit(op, len(node.Arguments))
+
+	case *ast.IndexExpression:
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.MemberExpression:
+		if err := c.compile(node.Object); err != nil {
+			return err
+		}
+		c.emit(code.OpMember, c.addConstant(&object.String{Value: node.Property.Value}))
+
+	case *ast.Identifier:
+		return c.loadIdentifier(node)
+
+	case *ast.IntegerLiteral:
+		// 严格模式下超出 int64 范围的字面量是溢出错误，由虚拟机在加载常量时检查
+		if node.Big != nil {
+			c.emit(code.OpConstant, c.addConstant(object.NewBigInteger(node.Big)))
+			break
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			if err := c.compile(part); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Parts))
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			if err := c.compile(element); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		// 按照源码里的顺序编译，使得生成的指令是确定的
+		keys := []ast.Expression{}
+		for key := range node.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Pos().Offset < keys[j].Pos().Offset
+		})
+
+		for _, key := range keys {
+			if err := c.compile(key); err != nil {
+				return err
+			}
+			if err := c.compile(node.Pairs[key]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(keys))
+
+	default:
+		return fmt.Errorf("unsupported expression: %T", n)
+	}
+
+	return nil
+}
+
+func (c *Compiler) emitOperator(operator string) error {
+	switch operator {
+	case "+":
+		c.emit(code.OpAdd)
+	case "-":
+		c.emit(code.OpSub)
+	case "*":
+		c.emit(code.OpMul)
+	case "/":
+		c.emit(code.OpDiv)
+	case "%":
+		c.emit(code.OpMod)
+	case "==":
+		c.emit(code.OpEqual)
+	case "!=":
+		c.emit(code.OpNotEqual)
+	case ">":
+		c.emit(code.OpGreaterThan)
+	case "<":
+		c.emit(code.OpLessThan)
+	default:
+		return fmt.Errorf("unknown operator %s", operator)
+	}
+	return nil
+}
+
+// 逻辑运算 && 和 ||，短路求值，结果总是布尔值
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	jumpOp, result := code.OpJumpNotTruthy, code.OpTrue
+	if node.Operator == "||" {
+		jumpOp, result = code.OpJumpTruthy, code.OpFalse
+	}
+
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	shortCircuit := c.emit(jumpOp, 9999)
+
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+	rightShortCircuit := c.emit(jumpOp, 9999)
+
+	c.emit(result)
+	end := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(shortCircuit, len(c.scope.instructions))
+	c.changeOperand(rightShortCircuit, len(c.scope.instructions))
+	if result == code.OpTrue {
+		c.emit(code.OpFalse)
+	} else {
+		c.emit(code.OpTrue)
+	}
+	c.changeOperand(end, len(c.scope.instructions))
+
+	return nil
+}
+
+// 编译语句块，语句块有自己的作用域，语句块的值留在栈顶
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	c.enterBlockScope(block.Slots > 0)
+	defer c.leaveBlockScope()
+
+	return c.compileStatements(block.Statements)
+}
+
+// 在当前作用域里编译一组语句，最后一条语句的值留在栈顶，
+// 没有语句或者最后一条语句没有值（比如 let 语句）时为 NULL
+func (c *Compiler) compileStatements(statements []ast.Statement) error {
+	c.hoist(statements)
+
+	if len(statements) == 0 {
+		c.emit(code.OpNull)
+	}
+
+	for i, statement := range statements {
+		value, err := c.compileStatement(statement)
+		if err != nil {
+			return err
+		}
+
+		last := i == len(statements)-1
+		if value && !last {
+			c.emit(code.OpPop)
+		} else if !value && last {
+			c.emit(code.OpNull)
+		}
+	}
+
+	return nil
+}
+
+// 进入新的作用域，env 表示解析时是否为它创建了环境（即作用域里是否声明了标识符）
+func (c *Compiler) enterBlockScope(env bool) {
+	c.symbolTable = newEnclosedSymbolTable(c.symbolTable, c.scope, env)
+}
+
+func (c *Compiler) leaveBlockScope() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+// 为语句块里将要声明、而且被内层函数引用的标识符预先创建 cell（见 SymbolTable.pending）
+func (c *Compiler) hoist(statements []ast.Statement) {
+	table := c.symbolTable
+	if table.scope == nil {
+		return // 全局变量不需要预先创建
+	}
+
+	for _, statement := range statements {
+		names := []*ast.Identifier{}
+		constant := false
+
+		switch statement := statement.(type) {
+		case *ast.LetStatement:
+			names = patternIdentifiers(statement.Name)
+			constant = statement.Constant
+		case *ast.ImportStatement:
+			if statement.Alias != nil {
+				names = append(names, statement.Alias)
+			}
+			names = append(names, statement.Locals...)
+		}
+
+		for _, name := range names {
+			if !c.scope.captured[name.Value] {
+				continue
+			}
+			if _, ok := table.slots[name.Index]; ok {
+				continue
+			}
+			if _, ok := table.pending[name.Index]; ok {
+				continue
+			}
+
+			symbol := Symbol{Name: name.Value, Scope: LocalScope, Index: c.allocateLocal(), Constant: constant, Cell: true}
+			table.pending[name.Index] = symbol
+			c.emit(code.OpNewCell, symbol.Index)
+		}
+	}
+}
+
+func (c *Compiler) allocateLocal() int {
+	index := c.scope.numLocals
+	c.scope.numLocals++
+	return index
+}
+
+// 在当前作用域里声明标识符，如果标识符已经在当前作用域里声明过，则 redeclared 为 true。
+// 全局变量是否重复声明在运行时才检查
+func (c *Compiler) declare(name *ast.Identifier, constant bool) (symbol Symbol, redeclared bool) {
+	table := c.symbolTable
+	if table.scope == nil {
+		symbol = table.resolveGlobal(name.Value)
+		symbol.Constant = constant // 只用于声明，赋值时在运行时检查
+		return symbol, false
+	}
+
+	if symbol, ok := table.slots[name.Index]; ok {
+		return symbol, true
+	}
+
+	if symbol, ok := table.pending[name.Index]; ok {
+		delete(table.pending, name.Index)
+		symbol.Constant = constant
+		table.slots[name.Index] = symbol
+		return symbol, false
+	}
+
+	symbol = Symbol{Name: name.Value, Scope: LocalScope, Index: c.allocateLocal(), Constant: constant, Cell: c.scope.captured[name.Value]}
+	if symbol.Cell {
+		c.emit(code.OpNewCell, symbol.Index)
+	}
+	table.slots[name.Index] = symbol
+	return symbol, false
+}
+
+// 按照解析的结果查找标识符：局部变量位于往外第 Depth 个环境对应的符号表里，
+// 外层函数的局部变量会转换为当前函数的自由变量，其他标识符都视为全局变量。
+// pending 表示找到的是后面才声明的局部变量（见 SymbolTable.pending），使用之前需要检查它是否已经声明
+func (c *Compiler) resolve(node *ast.Identifier) (symbol Symbol, pending bool, err error) {
+	if node.Resolution != ast.Local {
+		return c.globals.resolveGlobal(node.Value), false, nil
+	}
+
+	table := c.symbolTable
+	for depth := node.Depth; table != nil && (!table.env || depth > 0); table = table.Outer {
+		if table.env {
+			depth--
+		}
+	}
+	if table == nil {
+		return Symbol{}, false, fmt.Errorf("unresolved local variable: %s", node.Value)
+	}
+
+	if symbol, ok := table.slots[node.Index]; ok {
+		return c.capture(c.scope, symbol, table.scope), false, nil
+	}
+	if symbol, ok := table.pending[node.Index]; ok {
+		return c.capture(c.scope, symbol, table.scope), true, nil
+	}
+	return Symbol{}, false, fmt.Errorf("unresolved local variable: %s", node.Value)
+}
+
+// 将 owner 函数的局部变量 symbol 转换为 scope 函数可以访问的符号，
+// 途经的每一层函数都捕获这个变量
+func (c *Compiler) capture(scope *CompilationScope, symbol Symbol, owner *CompilationScope) Symbol {
+	if scope == owner || symbol.Scope == GlobalScope {
+		return symbol
+	}
+
+	outer := c.capture(scope.parent, symbol, owner)
+
+	index := -1
+	for i, free := range scope.free {
+		if free.Scope == outer.Scope && free.Index == outer.Index {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		index = len(scope.free)
+		scope.free = append(scope.free, outer)
+	}
+
+	return Symbol{Name: symbol.Name, Scope: FreeScope, Index: index, Constant: symbol.Constant, Cell: true}
+}
+
+func (c *Compiler) loadSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		if symbol.Cell {
+			c.emit(code.OpGetCell, symbol.Index)
+		} else {
+			c.emit(code.OpGetLocal, symbol.Index)
+		}
+	case FreeScope:
+		c.emit(code.OpGetFree, symbol.Index)
+	}
+}
+
+// 将栈顶的值弹出并存入 symbol，define 表示这是声明而不是赋值
+func (c *Compiler) storeSymbol(symbol Symbol, define bool) {
+	switch symbol.Scope {
+	case GlobalScope:
+		if define {
+			constant := 0
+			if symbol.Constant {
+				constant = 1
+			}
+			c.emit(code.OpDefineGlobal, symbol.Index, constant)
+		} else {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		}
+	case LocalScope:
+		if symbol.Cell {
+			c.emit(code.OpSetCell, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	case FreeScope:
+		c.emit(code.OpSetFree, symbol.Index)
+	}
+}
+
+func (c *Compiler) loadIdentifier(node *ast.Identifier) error {
+	if node.Value == "self" {
+		return c.loadSelf(node)
+	}
+
+	symbol, pending, err := c.resolve(node)
+	if err != nil {
+		return err
+	}
+	c.loadSymbol(symbol)
+	if pending {
+		c.emit(code.OpCheckDefined, c.addConstant(&object.String{Value: node.Value}))
+	}
+	return nil
+}
+
+// 获取 self：方法调用时为方法所属的对象，否则依次使用外层函数的 self，
+// 直到遇到解析得到的普通的（即使用 let 或者形参声明的）self 或者全局变量 self
+func (c *Compiler) loadSelf(node *ast.Identifier) error {
+	ends := []int{}
+
+	// 途经的每一层函数隐含的 self 都位于解析得到的 self 的内层
+	depth := node.Depth
+	for table := c.symbolTable; table != nil; table = table.Outer {
+		if table.env && node.Resolution == ast.Local {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		if table.self != nil {
+			c.loadSymbol(c.capture(c.scope, *table.self, table.scope))
+			ends = append(ends, c.emit(code.OpJumpNotMissing, 9999))
+		}
+	}
+
+	symbol, pending, err := c.resolve(node)
+	if err != nil {
+		return err
+	}
+	c.loadSymbol(symbol)
+	if pending {
+		c.emit(code.OpCheckDefined, c.addConstant(&object.String{Value: "self"}))
+	}
+
+	for _, end := range ends {
+		c.changeOperand(end, len(c.scope.instructions))
+	}
+	return nil
+}
+
+// 弹出栈顶的值，按照模式 pattern 在当前作用域里声明标识符
+func (c *Compiler) bindPattern(pattern ast.Pattern, constant bool) {
+	saved := c.node
+	c.node = pattern
+	defer func() { c.node = saved }()
+
+	if identifier, ok := pattern.(*ast.Identifier); ok {
+		if identifier.Value == "_" {
+			c.emit(code.OpPop)
+			return
+		}
+
+		symbol, redeclared := c.declare(identifier, constant)
+		if redeclared {
+			c.emitError(identifier, object.NAME_ERROR, "identifier %s has already been declared", identifier.Value)
+			return
+		}
+		c.storeSymbol(symbol, true)
+		return
+	}
+
+	c.emit(code.OpDestructure, c.addConstant(c.newPattern(pattern, constant)))
+}
+
+// 声明模式里的标识符，生成作为常量的模式
+func (c *Compiler) newPattern(pattern ast.Pattern, constant bool) *Pattern {
+	bindings := map[*ast.Identifier]Binding{}
+	for _, identifier := range patternIdentifiers(pattern) {
+		symbol, redeclared := c.declare(identifier, constant)
+		bindings[identifier] = Binding{Symbol: symbol, Redeclared: redeclared}
+	}
+	return &Pattern{Pattern: pattern, Bindings: bindings}
+}
+
+// 模式里声明的所有标识符（不包括通配符 "_"）
+func patternIdentifiers(pattern ast.Pattern) []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+	ast.Inspect(pattern, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if node.Value != "_" {
+				identifiers = append(identifiers, node)
+			}
+		case *ast.LiteralPattern:
+			return false
+		}
+		return true
+	})
+	return identifiers
+}
+
+// 生成抛出固定错误的指令，用于编译时就能确定的错误
+func (c *Compiler) emitError(node ast.Node, kind object.ErrorKind, format string, a ...interface{}) {
+	err := &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...), Pos: node.Pos(), End: node.End()}
+	c.emit(code.OpError, c.addConstant(err))
+}
+
+// 赋值表达式，赋值的顺序跟树遍历求值器一致：先对目标里的子表达式求值，然后是右侧的值，
+// 对于复合赋值，最后才获取目标的当前值
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	operator := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+
+		symbol, pending, err := c.resolve(target)
+		if err != nil {
+			return err
+		}
+		if node.Operator != "=" {
+			c.loadSymbol(symbol)
+			if pending {
+				c.emit(code.OpCheckDefined, c.addConstant(&object.String{Value: target.Value}))
+			}
+			c.emit(code.OpSwap)
+			if err := c.emitOperator(operator); err != nil {
+				return err
+			}
+		}
+
+		if symbol.Constant {
+			c.emitError(node, object.NAME_ERROR, "cannot assign to constant: %s", target.Value)
+			return nil
+		}
+		c.emit(code.OpDup)
+		c.storeSymbol(symbol, false)
+		return nil
+
+	case *ast.IndexExpression:
+		if err := c.compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.compile(target.Index); err != nil {
+			return err
+		}
+
+	case *ast.MemberExpression:
+		if err := c.compile(target.Object); err != nil {
+			return err
+		}
+		name := c.addConstant(&object.String{Value: target.Property.Value})
+		c.emit(code.OpMemberTarget, name)
+		c.emit(code.OpConstant, name)
+
+	default:
+		c.emitError(node, object.TYPE_ERROR, "invalid assignment target: %s", node.Target.String())
+		return nil
+	}
+
+	// 栈上依次为容器和索引，然后是右侧的值
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+	if node.Operator != "=" {
+		c.emit(code.OpPick, 2)
+		c.emit(code.OpPick, 2)
+		c.emit(code.OpIndex)
+		c.emit(code.OpSwap)
+		if err := c.emitOperator(operator); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpSetIndex)
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	outer := c.symbolTable
+	scope := &CompilationScope{captured: capturedNames(node), parent: c.scope}
+
+	// 形参依次位于最前面的槽位，然后是剩余参数
+	scope.numLocals = len(node.Parameters)
+	if node.Rest != nil {
+		scope.numLocals++
+	}
+
+	c.scope = scope
+
+	// self 位于形参的外层作用域，因此可以被同名的形参遮蔽
+	c.symbolTable = newEnclosedSymbolTable(outer, scope, false)
+	if usesSelf(node) {
+		symbol := Symbol{Name: "self", Scope: LocalScope, Index: c.allocateLocal(), Cell: scope.captured["self"]}
+		c.symbolTable.self = &symbol
+		c.emit(code.OpReceiver)
+		if symbol.Cell {
+			c.emit(code.OpNewCell, symbol.Index)
+		}
+		c.storeSymbol(symbol, true)
+	}
+
+	// 函数体跟形参共用同一个作用域
+	c.enterBlockScope(true)
+	params := c.symbolTable
+
+	for i, param := range node.Parameters {
+		var defaultValue ast.Expression
+		if i < len(node.Defaults) {
+			defaultValue = node.Defaults[i]
+		}
+		if err := c.compileParameter(param, i, defaultValue); err != nil {
+			return err
+		}
+	}
+
+	if node.Rest != nil {
+		index := len(node.Parameters)
+		symbol := Symbol{Name: node.Rest.Value, Scope: LocalScope, Index: index, Cell: scope.captured[node.Rest.Value]}
+		params.slots[node.Rest.Index] = symbol
+		if symbol.Cell {
+			c.emit(code.OpMakeCell, index)
+		}
+	}
+
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	c.scope = scope.parent
+	c.symbolTable = outer
+
+	compiled := &CompiledFunction{
+		Instructions: scope.instructions,
+		NumLocals:    scope.numLocals,
+		Literal:      node,
+		Nodes:        scope.nodes,
+	}
+
+	for _, free := range scope.free {
+		switch free.Scope {
+		case LocalScope:
+			if !free.Cell {
+				return fmt.Errorf("variable %s is captured but not stored in a cell", free.Name)
+			}
+			c.emit(code.OpCaptureLocal, free.Index)
+		case FreeScope:
+			c.emit(code.OpCaptureFree, free.Index)
+		}
+	}
+	c.emit(code.OpClosure, c.addConstant(compiled), len(scope.free))
+
+	return nil
+}
+
+// 绑定第 index 个形参，没有对应的实参时使用默认值，默认值可以引用前面的形参
+func (c *Compiler) compileParameter(param ast.Pattern, index int, defaultValue ast.Expression) error {
+	saved := c.node
+	c.node = param
+	defer func() { c.node = saved }()
+
+	identifier, isIdentifier := param.(*ast.Identifier)
+	if isIdentifier && defaultValue == nil {
+		if identifier.Value == "_" {
+			return nil
+		}
+		if _, ok := c.symbolTable.slots[identifier.Index]; ok {
+			c.emitError(identifier, object.NAME_ERROR, "identifier %s has already been declared", identifier.Value)
+			return nil
+		}
+
+		// 实参已经位于形参的槽位里
+		symbol := Symbol{Name: identifier.Value, Scope: LocalScope, Index: index, Cell: c.scope.captured[identifier.Value]}
+		c.symbolTable.slots[identifier.Index] = symbol
+		if symbol.Cell {
+			c.emit(code.OpMakeCell, index)
+		}
+		return nil
+	}
+
+	c.emit(code.OpGetLocal, index)
+	if defaultValue != nil {
+		jump := c.emit(code.OpJumpNotMissing, 9999)
+		if err := c.compile(defaultValue); err != nil {
+			return err
+		}
+		c.changeOperand(jump, len(c.scope.instructions))
+	}
+
+	c.bindPattern(param, false)
+	return nil
+}
+
+// 调用的函数是否可能用到 self（包括内层函数用到的 self）
+func usesSelf(node *ast.FunctionLiteral) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if identifier, ok := n.(*ast.Identifier); ok && identifier.Value == "self" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// 函数（或者主程序）里被内层函数引用的标识符名称。
+// 这里只按照名称判断，可能包括一些实际上并没有被捕获的标识符，它们只是多了一层 cell
+func capturedNames(node ast.Node) map[string]bool {
+	names := map[string]bool{}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == node {
+			return true
+		}
+
+		if function, ok := n.(*ast.FunctionLiteral); ok {
+			ast.Inspect(function, func(n ast.Node) bool {
+				if identifier, ok := n.(*ast.Identifier); ok {
+					names[identifier.Value] = true
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+
+	return names
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	c.emit(code.OpSetupLoop)
+
+	start := len(c.scope.instructions)
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	exit := c.emit(code.OpJumpNotTruthy, 9999)
+
+	loop := c.enterRegion(&region{loop: true, continueTarget: start})
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, start)
+
+	c.changeOperand(exit, c.leaveLoop(loop))
+	return nil
+}
+
+// for-in 循环，迭代器位于栈上，每一次迭代都在新的作用域里绑定循环变量
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpGetIterator)
+	c.emit(code.OpSetupLoop)
+
+	next := c.emit(code.OpIterNext, 9999)
+
+	c.enterBlockScope(true)
+	symbol, _ := c.declare(node.Variable, false)
+	c.storeSymbol(symbol, true)
+
+	loop := c.enterRegion(&region{loop: true, continueTarget: next})
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.leaveBlockScope()
+	c.emit(code.OpJump, next)
+
+	// 迭代结束时跳到 OpPopBlock，然后弹出迭代器
+	c.changeOperand(next, c.leaveLoop(loop))
+	c.emit(code.OpSwap)
+	c.emit(code.OpPop)
+	return nil
+}
+
+func (c *Compiler) enterRegion(r *region) *region {
+	c.scope.regions = append(c.scope.regions, r)
+	return r
+}
+
+func (c *Compiler) exitRegion() {
+	c.scope.regions = c.scope.regions[:len(c.scope.regions)-1]
+}
+
+// 循环结束：break 跳到这里，离开循环，循环语句的值为 NULL。返回循环出口的位置
+func (c *Compiler) leaveLoop(loop *region) int {
+	c.exitRegion()
+	exit := c.emit(code.OpPopBlock)
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, exit)
+	}
+	c.emit(code.OpNull)
+	return exit
+}
+
+// break 和 continue，先离开循环之内的 try 语句块（并执行 finally 语句块）
+func (c *Compiler) compileLoopJump(isBreak bool) error {
+	for i := len(c.scope.regions) - 1; i >= 0; i-- {
+		r := c.scope.regions[i]
+		if !r.loop {
+			if err := c.leaveRegion(i); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isBreak {
+			r.breaks = append(r.breaks, c.emit(code.OpBreak, 9999))
+		} else {
+			c.emit(code.OpContinue, r.continueTarget)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("break or continue outside of loop")
+}
+
+// 提前离开第 i 层 try 语句块，执行它的 finally 语句块（finally 语句块本身不在 try 语句块之内）
+func (c *Compiler) leaveRegion(i int) error {
+	r := c.scope.regions[i]
+	c.emit(code.OpPopBlock)
+	if r.finally == nil {
+		return nil
+	}
+
+	regions := c.scope.regions
+	c.scope.regions = regions[:i]
+	defer func() { c.scope.regions = regions }()
+
+	if err := c.compileBlock(r.finally); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	return nil
+}
+
+// try 表达式。finally 语句块在每一个出口都生成一份：正常结束时、发生错误时（然后重新抛出错误），
+// 以及 break、continue、return 离开 try 语句块时
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	var finallyHandler, catchHandler int
+	if node.Finally != nil {
+		finallyHandler = c.emit(code.OpSetupTry, 9999)
+		c.enterRegion(&region{finally: node.Finally})
+	}
+	if node.Catch != nil {
+		catchHandler = c.emit(code.OpSetupTry, 9999)
+		c.enterRegion(&region{})
+	}
+
+	if err := c.compileBlock(node.Block); err != nil {
+		return err
+	}
+
+	if node.Catch != nil {
+		c.exitRegion()
+		c.emit(code.OpPopBlock)
+		skip := c.emit(code.OpJump, 9999)
+
+		// 发生错误时，栈顶为错误
+		c.changeOperand(catchHandler, len(c.scope.instructions))
+		c.enterBlockScope(node.Catch.Slots > 0)
+		if node.Parameter != nil {
+			c.emit(code.OpErrorValue)
+			c.bindPattern(node.Parameter, false)
+		} else {
+			c.emit(code.OpPop)
+		}
+		// catch 语句块跟参数共用同一个作用域
+		if err := c.compileStatements(node.Catch.Statements); err != nil {
+			return err
+		}
+		c.leaveBlockScope()
+
+		c.changeOperand(skip, len(c.scope.instructions))
+	}
+
+	if node.Finally != nil {
+		c.exitRegion()
+		c.emit(code.OpPopBlock)
+		if err := c.compileBlock(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		end := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(finallyHandler, len(c.scope.instructions))
+		if err := c.compileBlock(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		c.emit(code.OpRethrow)
+
+		c.changeOperand(end, len(c.scope.instructions))
+	}
+
+	return nil
+}
+
+// match 表达式，匹配期间被匹配的值位于栈顶，每个分支都有自己的作用域
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.compile(node.Subject); err != nil {
+		return err
+	}
+
+	ends := []int{}
+	for _, arm := range node.Arms {
+		c.enterBlockScope(arm.Slots > 0)
+
+		pattern := c.addConstant(c.newPattern(arm.Pattern, false))
+		next := c.emit(code.OpMatch, pattern, 9999)
+		c.emit(code.OpPop)
+		if err := c.compileBlock(arm.Body); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(code.OpJump, 9999))
+
+		c.leaveBlockScope()
+		c.replaceInstruction(next, code.Make(code.OpMatch, pattern, len(c.scope.instructions)))
+	}
+
+	// 没有分支匹配
+	c.emit(code.OpPop)
+	c.emit(code.OpNull)
+
+	for _, end := range ends {
+		c.changeOperand(end, len(c.scope.instructions))
+	}
+	return nil
+}
+
+// import 语句，先声明模块的别名，然后依次声明导入的名称
+func (c *Compiler) compileImportStatement(node *ast.ImportStatement) {
+	c.emit(code.OpImport)
+
+	if node.Alias != nil {
+		c.emit(code.OpDup)
+		c.bindPattern(node.Alias, false)
+	}
+
+	for i, name := range node.Names {
+		c.emit(code.OpDup)
+		c.node = name
+		c.emit(code.OpImportName, c.addConstant(&object.String{Value: name.Value}))
+		c.node = node
+		c.bindPattern(node.Locals[i], false)
+	}
+
+	c.emit(code.OpPop)
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// 生成一条指令，返回指令的位置
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := len(c.scope.instructions)
+	c.scope.instructions = append(c.scope.instructions, ins...)
+
+	// 连续的多条指令对应同一个节点时只记录第一条
+	nodes := c.scope.nodes
+	if len(nodes) == 0 || nodes[len(nodes)-1].Node != c.node {
+		c.scope.nodes = append(nodes, InstructionNode{Offset: pos, Node: c.node})
+	}
+
+	return pos
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	copy(c.scope.instructions[pos:], newInstruction)
+}
+
+// 修改指令的（第一个）操作数，用于填入跳转的目标
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.scope.instructions[opPos])
+	c.checkOperands(op, operand)
+	c.replaceInstruction(opPos, code.Make(op, operand))
+}
+
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if err := code.CheckOperands(op, operands...); err != nil && c.operandErr == nil {
+		c.operandErr = err
+	}
+}
@@ -0,0 +1,74 @@
+// original from https://compilerbook.com/
+
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL" // 主程序顶层声明的标识符，以及找不到声明的标识符
+	LocalScope  SymbolScope = "LOCAL"  // 函数（或者主程序里的语句块）的局部变量，位于栈帧的槽位里
+	FreeScope   SymbolScope = "FREE"   // 闭包捕获的外层函数的局部变量
+)
+
+type Symbol struct {
+	Name     string
+	Scope    SymbolScope
+	Index    int  // 全局变量、局部变量或者自由变量的槽位
+	Constant bool // 使用 const 声明的标识符，不能重新赋值
+	Cell     bool // 被内层函数捕获的局部变量，槽位里存放的是 cell，自由变量总是 cell
+}
+
+// 符号表，对应一层作用域。全局符号表对应主程序的顶层，其他符号表对应函数或者语句块，
+// 它们声明的标识符位于所属函数的栈帧里（主程序里的语句块属于主程序的栈帧）。
+// 局部变量的作用域由执行之前的解析（core.Resolve）确定，符号表只记录每个槽位对应的符号
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store map[string]Symbol // 全局变量，只用于全局符号表
+	slots map[int]Symbol    // 已经声明的局部变量，以解析得到的槽位为下标
+	scope *CompilationScope // 所属的函数，全局符号表为 nil
+	env   bool              // 是否对应解析时的一个环境，标识符的 Depth 只计算这些符号表
+	self  *Symbol           // 函数隐含的 self，位于形参的外层，只用于函数最外层的符号表
+
+	// 后面才声明、而且被内层函数引用的局部变量，进入作用域时就创建了 cell（见 Compiler.hoist）
+	pending map[int]Symbol
+
+	numDefinitions int // 全局变量的数量，只用于全局符号表
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: map[string]Symbol{}}
+}
+
+func newEnclosedSymbolTable(outer *SymbolTable, scope *CompilationScope, env bool) *SymbolTable {
+	return &SymbolTable{
+		Outer:   outer,
+		slots:   map[int]Symbol{},
+		scope:   scope,
+		env:     env,
+		pending: map[int]Symbol{},
+	}
+}
+
+// 获取全局变量，第一次遇到的名称分配新的槽位。
+// 全局变量是否已经声明、是否常量在运行时才检查，所以引用后面才声明的全局变量（比如互相调用的函数）
+// 以及 REPL 里先前输入的全局变量都不需要特殊处理
+func (s *SymbolTable) resolveGlobal(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Scope: GlobalScope, Index: s.numDefinitions}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// 全局变量的名称，以槽位为下标，用于运行时的错误信息以及导出模块的标识符
+func (s *SymbolTable) GlobalNames() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		names[symbol.Index] = name
+	}
+	return names
+}
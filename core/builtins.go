@@ -0,0 +1,265 @@
+// original from https://interpreterbook.com/
+
+package core
+
+import (
+	"fmt"
+	"interpreter/object"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var Builtins = map[string]*object.Builtin{
+	"len": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `len` expected 1, actual %d", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+
+			case *object.String:
+				// 字符串的长度是字符（Unicode 码点）的数量，而不是字节数，
+				// 字节数可以通过 len(bytes(s)) 获得
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+
+			case *object.Range:
+				return object.NewBigInteger(new(big.Int).SetUint64(arg.Len()))
+
+			default:
+				return NewError(object.TYPE_ERROR, "argument type of `len` expected STRING, ARRAY or RANGE, actual %s", args[0].Type())
+			}
+		},
+	},
+
+	"first": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `len` expected 1, actual %d",
+					len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError(object.TYPE_ERROR, "argument type of `first` expected ARRAY, actual %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+			return NULL
+		},
+	},
+
+	"last": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `last` expected 1, actual %d",
+					len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError(object.TYPE_ERROR, "argument type of `last` expected ARRAY, actual %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+			return NULL
+		},
+	},
+
+	"rest": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `rest` expected 1, actual %d",
+					len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError(object.TYPE_ERROR, "argument type of `rest` expected ARRAY, actual %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+
+			if length > 0 {
+				newElements := make([]object.Object, length-1, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &object.Array{Elements: newElements}
+			}
+			return NULL
+		},
+	},
+
+	"push": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `push` expected 2, actual %d",
+					len(args))
+			}
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError(object.TYPE_ERROR, "argument type of `push` expected ARRAY, actual %s",
+					args[0].Type())
+			}
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+
+			newElements := make([]object.Object, length+1, length+1)
+			copy(newElements, arr.Elements)
+
+			newElements[length] = args[1]
+			return &object.Array{Elements: newElements}
+		},
+	},
+
+	"pop": {
+		// TODO
+		Fn: func(args ...object.Object) object.Object {
+			return NULL
+		},
+	},
+
+	// 返回字符串的 UTF-8 编码字节组成的数组
+	"bytes": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `bytes` expected 1, actual %d",
+					len(args))
+			}
+
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return NewError(object.TYPE_ERROR, "argument type of `bytes` expected STRING, actual %s",
+					args[0].Type())
+			}
+
+			elements := make([]object.Object, len(str.Value))
+			for i := 0; i < len(str.Value); i++ {
+				elements[i] = &object.Integer{Value: int64(str.Value[i])}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+
+	// 创建整数区间，用于 for-in 循环：
+	// range(end)、range(start, end)、range(start, end, step)，区间不包括 end
+	"range": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 3 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `range` expected 1 to 3, actual %d",
+					len(args))
+			}
+
+			values := []int64{}
+			for _, arg := range args {
+				integer, ok := arg.(*object.Integer)
+				if !ok {
+					return NewError(object.TYPE_ERROR, "argument type of `range` expected INTEGER, actual %s",
+						arg.Type())
+				}
+				if integer.Big != nil {
+					return NewError(object.VALUE_ERROR, "argument of `range` is out of the range of 64-bit integers: %s",
+						integer.Inspect())
+				}
+				values = append(values, integer.Value)
+			}
+
+			r := &object.Range{Step: 1}
+			switch len(values) {
+			case 1:
+				r.End = values[0]
+			case 2:
+				r.Start, r.End = values[0], values[1]
+			case 3:
+				r.Start, r.End, r.Step = values[0], values[1], values[2]
+			}
+
+			if r.Step == 0 {
+				return NewError(object.VALUE_ERROR, "step of `range` must not be zero")
+			}
+			return r
+		},
+	},
+
+	// 转换为整数，浮点数向零取整，字符串按照整数字面量的格式解析
+	"int": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `int` expected 1, actual %d",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+
+			case *object.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return NewError(object.VALUE_ERROR, "cannot convert %s to INTEGER", arg.Inspect())
+				}
+				value, _ := big.NewFloat(arg.Value).Int(nil) // 向零取整
+				return object.NewBigInteger(value)
+
+			case *object.String:
+				value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 0)
+				if !ok {
+					return NewError(object.VALUE_ERROR, "could not parse %q as integer", arg.Value)
+				}
+				return object.NewBigInteger(value)
+
+			default:
+				return NewError(object.TYPE_ERROR, "argument type of `int` expected INTEGER, FLOAT or STRING, actual %s",
+					args[0].Type())
+			}
+		},
+	},
+
+	// 转换为浮点数，字符串按照浮点数字面量的格式解析
+	"float": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError(object.TYPE_ERROR, "number of arguments for `float` expected 1, actual %d",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return &object.Float{Value: toFloat(arg)}
+
+			case *object.Float:
+				return arg
+
+			case *object.String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return NewError(object.VALUE_ERROR, "could not parse %q as float", arg.Value)
+				}
+				return &object.Float{Value: value}
+
+			default:
+				return NewError(object.TYPE_ERROR, "argument type of `float` expected INTEGER, FLOAT or STRING, actual %s",
+					args[0].Type())
+			}
+		},
+	},
+
+	"puts": {
+		Fn: func(args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+			return NULL
+		},
+	},
+}
@@ -0,0 +1,89 @@
+// original from https://interpreterbook.com/
+
+// core 包含各个执行引擎（树遍历求值器、字节码虚拟机、闭包编译引擎）共用的语言语义：
+// 运算符、索引、迭代、模式匹配、内置函数、错误以及模块的加载，
+// 以保证各个执行引擎的运算规则、内置函数和错误信息完全一致
+package core
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+var (
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+	NULL  = &object.Null{}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+)
+
+func NativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	} else {
+		return FALSE
+	}
+}
+
+// 为还没有位置信息的错误填入节点的位置，返回 obj 本身。
+// 错误是由内向外传递的，所以记录下来的是最内层（即出错的）节点的位置
+func Located(node ast.Node, obj object.Object) object.Object {
+	if err, ok := obj.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+		err.End = node.End()
+	}
+	return obj
+}
+
+// 创建位于 node 的错误
+func NewErrorAt(node ast.Node, kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	err := NewError(kind, format, a...)
+	err.Pos = node.Pos()
+	err.End = node.End()
+	return err
+}
+
+// NULL 和 FALSE 视为 false，其他视为 true
+func IsTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case FALSE:
+		return false
+	case TRUE:
+		return true
+	default:
+		return true
+	}
+}
+
+// 创建错误，错误的位置由执行引擎填入
+func NewError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// 用在 "调用 Eval(...) 之后还需进一步执行其他运算" 的场合，用于提早返回
+// 比如在调用 InfixOperation 之前需要先对 left node 和 right node
+// 求值，如果任意一个返回 Error，都应该提前返回 Error，而不是继续执行 InfixOperation
+func IsError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	} else {
+		return false
+	}
+}
+
+// 是否为中断语句执行的值：错误、return、break 或者 continue。
+// 作为表达式的 if 和 match 里的语句块可能产生这些值，比如 let x = if (c) { break };
+// 这时 let 语句和赋值表达式不绑定这个值，而是继续向外传递
+func IsAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		return true
+	default:
+		return false
+	}
+}
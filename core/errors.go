@@ -0,0 +1,86 @@
+package core
+
+import (
+	"fmt"
+	"interpreter/object"
+)
+
+// 将 throw 语句的值转换为错误：
+//
+//   - 字符串：作为错误信息，错误的种类为 Error
+//   - 映射表：使用 "message" 和 "kind"（可选）作为错误信息和种类，
+//     因此 catch 到的错误可以原样重新抛出
+func ThrowValue(value object.Object) object.Object {
+	switch value := value.(type) {
+	case *object.String:
+		return NewError(object.ERROR, "%s", value.Value)
+
+	case *object.Hash:
+		message, ok := hashStringValue(value, "message")
+		if !ok {
+			return NewError(object.TYPE_ERROR, "thrown HASH expected a STRING \"message\"")
+		}
+
+		kind, ok := hashStringValue(value, "kind")
+		if !ok {
+			kind = string(object.ERROR)
+		}
+		return NewError(object.ErrorKind(kind), "%s", message)
+
+	default:
+		return NewError(object.TYPE_ERROR, "throw expected STRING or HASH, actual %s", value.Type())
+	}
+}
+
+// 获取映射表里以字符串 key 对应的字符串值
+func hashStringValue(hash *object.Hash, key string) (string, bool) {
+	pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+	if !ok {
+		return "", false
+	}
+
+	str, ok := pair.Value.(*object.String)
+	if !ok {
+		return "", false
+	}
+	return str.Value, true
+}
+
+// 将错误转换为映射表，包括：
+//
+//	message   错误信息
+//	kind      错误的种类，比如 "TypeError"
+//	position  出错的位置，比如 "demo.toy:2:5"，没有位置信息时为 null
+//	trace     从出错的位置到 try 表达式之间的调用栈，最内层的调用在前，比如 ["fold (demo.toy:15:5)"]
+func ErrorValue(err *object.Error) *object.Hash {
+	var position object.Object = NULL
+	if err.Pos.IsValid() {
+		position = &object.String{Value: err.Pos.String()}
+	}
+
+	trace := []object.Object{}
+	for _, frame := range err.Trace {
+		trace = append(trace, &object.String{Value: fmt.Sprintf("%s (%s)", frame.Function, frame.Pos)})
+	}
+
+	kind := err.Kind
+	if kind == "" {
+		kind = object.ERROR
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, field := range []struct {
+		key   string
+		value object.Object
+	}{
+		{"message", &object.String{Value: err.Message}},
+		{"kind", &object.String{Value: string(kind)}},
+		{"position", position},
+		{"trace", &object.Array{Elements: trace}},
+	} {
+		key := &object.String{Value: field.key}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: field.value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// 获取被调用函数的名称，用于调用栈。
+// 优先使用定义函数时 let 语句（或者映射表字面量）绑定的名称，其次使用调用表达式里的标识符
+func FunctionName(call *ast.CallExpression, fn object.Object) string {
+	if f, ok := fn.(object.FunctionObject); ok && f.Definition().Name != "" {
+		return f.Definition().Name
+	}
+
+	if identifier, ok := call.Function.(*ast.Identifier); ok {
+		return identifier.Value
+	}
+
+	if member, ok := call.Function.(*ast.MemberExpression); ok {
+		return member.Property.Value
+	}
+
+	return "<anonymous>"
+}
+
+// 函数调用的最大层数，各个执行引擎超出时都报告 RecursionError
+const MaxCallDepth = 10000
+
+// 进入一层函数调用，调用层数超出 MaxCallDepth 时返回错误，此时不需要 LeaveCall。
+// 树遍历求值器和闭包引擎的函数调用占用 Go 的调用栈，如果不限制层数，无限递归会令 Go 的调用栈溢出，整个进程直接退出
+func EnterCall(runtime *object.Runtime) *object.Error {
+	if runtime.CallDepth >= MaxCallDepth {
+		return NewError(object.RECURSION_ERROR, "maximum call depth of %d exceeded", MaxCallDepth)
+	}
+	runtime.CallDepth++
+	return nil
+}
+
+// 从函数调用返回
+func LeaveCall(runtime *object.Runtime) {
+	runtime.CallDepth--
+}
+
+// 检查实参的数量是否跟函数的形参相符
+func CheckArity(fn *object.Function, count int) *object.Error {
+	min, max := fn.Arity()
+	if count >= min && (max < 0 || count <= max) {
+		return nil
+	}
+
+	var expected string
+	switch {
+	case max < 0:
+		expected = fmt.Sprintf("at least %d", min)
+	case min == max:
+		expected = fmt.Sprintf("%d", min)
+	default:
+		expected = fmt.Sprintf("%d to %d", min, max)
+	}
+
+	name := "anonymous function"
+	if fn.Name != "" {
+		name = "`" + fn.Name + "`"
+	}
+	return NewError(object.TYPE_ERROR, "wrong number of arguments for %s: expected %s, actual %d", name, expected, count)
+}
+
+// 为在函数体内（以及参数检查时）发生的错误附上函数的定义位置，只记录最内层的函数
+func DefinedHere(err *object.Error, fn *object.Function) {
+	if len(err.Labels) == 0 {
+		err.Labels = append(err.Labels, object.ErrorLabel{Pos: fn.Pos, End: fn.End, Message: "function defined here"})
+	}
+}
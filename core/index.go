@@ -0,0 +1,155 @@
+// original from https://interpreterbook.com/
+
+package core
+
+import (
+	"interpreter/object"
+	"math"
+)
+
+// 索引运算 left[index]
+func Index(left object.Object, index object.Object) object.Object {
+	// 	array, ok := left.(*object.Array)
+	// 	if !ok {
+	// 		return newError("expected Array")
+	// 	}
+	//
+	// 	i, ok := index.(*object.Integer)
+	// 	if !ok {
+	// 		return newError("expected Integer")
+	// 	}
+	//
+	// 	if i.Value < 0 || i.Value >= int64(len(array.Elements)) {
+	// 		//return newError("out of index")
+	// 		return NULL
+	// 	}
+	// 	fmt.Printf("\nIDX: %+v\n", array.Elements[i.Value])
+	// 	return array.Elements[i.Value]
+
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return NewError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
+	}
+}
+
+func evalArrayIndexExpression(array object.Object, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx, ok := arrayIndex(arrayObject, index.(*object.Integer))
+	if !ok {
+		return indexOutOfRangeError(arrayObject, index)
+	}
+	return arrayObject.Elements[idx]
+}
+
+// 检查数组的索引是否在范围之内
+func arrayIndex(array *object.Array, index *object.Integer) (int64, bool) {
+	if index.Big != nil || index.Value < 0 || index.Value >= int64(len(array.Elements)) {
+		return 0, false
+	}
+	return index.Value, true
+}
+
+func indexOutOfRangeError(array *object.Array, index object.Object) *object.Error {
+	return NewError(object.INDEX_ERROR, "index out of range: %s (array length %d)", index.Inspect(), len(array.Elements))
+}
+
+// 成员访问 h.key，对于映射表等同于 h["key"]，对于模块则是访问模块导出的名称
+func Member(obj object.Object, name string) object.Object {
+	if module, ok := obj.(*object.Module); ok {
+		value, ok := module.Export(name)
+		if !ok {
+			return NewError(object.NAME_ERROR, "module %s has no exported member %s", module.Path, name)
+		}
+		return value
+	}
+
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		return NewError(object.TYPE_ERROR, "member access not supported: %s.%s", obj.Type(), name)
+	}
+
+	return evalHashIndexExpression(hash, &object.String{Value: name})
+}
+
+// 字符串按字符（Unicode 码点）索引，返回只包含一个字符的字符串
+func evalStringIndexExpression(str object.Object, index object.Object) object.Object {
+	value := str.(*object.String).Value
+	idx := index.(*object.Integer).Value
+	if index.(*object.Integer).Big != nil || idx < 0 {
+		return NULL
+	}
+
+	for _, ch := range value {
+		if idx == 0 {
+			return &object.String{Value: string(ch)}
+		}
+		idx -= 1
+	}
+
+	return NULL // 索引超出范围时，返回 NULL
+}
+
+func evalHashIndexExpression(hash object.Object, key object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	hashKey, err := HashKey(key)
+	if err != nil {
+		return err
+	}
+
+	pair, ok := hashObject.Pairs[hashKey]
+	if !ok {
+		return NULL // 不存在指定的 key 时，返回 NULL
+	}
+
+	return pair.Value
+}
+
+// 修改数组的元素或者映射表的键值对
+func AssignIndex(left object.Object, index object.Object, value object.Object) object.Object {
+	switch container := left.(type) {
+	case *object.Array:
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return NewError(object.TYPE_ERROR, "index of ARRAY expected INTEGER, actual %s", index.Type())
+		}
+
+		idx, ok := arrayIndex(container, integer)
+		if !ok {
+			return indexOutOfRangeError(container, index)
+		}
+		container.Elements[idx] = value
+
+	case *object.Hash:
+		hashKey, err := HashKey(index)
+		if err != nil {
+			return err
+		}
+		container.Pairs[hashKey] = object.HashPair{Key: index, Value: value}
+
+	default:
+		return NewError(object.TYPE_ERROR, "index assignment not supported: %s", left.Type())
+	}
+
+	return value
+}
+
+// 获取 Map 的 key，如果对象不能作为 key 则返回错误
+func HashKey(key object.Object) (object.HashKey, *object.Error) {
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return object.HashKey{}, NewError(object.TYPE_ERROR, "unsupported type for hash key: %s", key.Type())
+	}
+
+	if f, ok := key.(*object.Float); ok && math.IsNaN(f.Value) {
+		return object.HashKey{}, NewError(object.VALUE_ERROR, "NaN cannot be used as hash key")
+	}
+
+	return hashable.HashKey(), nil
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"interpreter/object"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 迭代器，用于 for-in 循环
+type Iterator struct {
+	next func() (object.Object, bool)
+}
+
+// 创建迭代器，iterable 不能迭代时返回错误。各种值迭代的元素分别为：
+//
+//   - 数组：每一个元素，迭代的是开始迭代时的数组元素
+//   - 映射表：每一个 key，按照 key 排序
+//   - 字符串：每一个字符（Unicode 码点）
+//   - 区间：每一个整数
+func NewIterator(iterable object.Object) (*Iterator, *object.Error) {
+	var next func() (object.Object, bool)
+
+	switch it := iterable.(type) {
+	case *object.Array:
+		elements := it.Elements
+		i := 0
+		next = func() (object.Object, bool) {
+			if i >= len(elements) {
+				return nil, false
+			}
+			i++
+			return elements[i-1], true
+		}
+
+	case *object.Hash:
+		pairs := sortedHashPairs(it)
+		i := 0
+		next = func() (object.Object, bool) {
+			if i >= len(pairs) {
+				return nil, false
+			}
+			i++
+			return pairs[i-1].Key, true
+		}
+
+	case *object.String:
+		str := it.Value
+		next = func() (object.Object, bool) {
+			if len(str) == 0 {
+				return nil, false
+			}
+			ch, size := utf8.DecodeRuneInString(str)
+			str = str[size:]
+			return &object.String{Value: string(ch)}, true
+		}
+
+	case *object.Range:
+		i, n := uint64(0), it.Len()
+		next = func() (object.Object, bool) {
+			if i >= n {
+				return nil, false
+			}
+			i++
+			return &object.Integer{Value: it.At(i - 1)}, true
+		}
+
+	default:
+		return nil, NewError(object.TYPE_ERROR, "%s is not iterable", iterable.Type())
+	}
+
+	return &Iterator{next: next}, nil
+}
+
+// 返回下一个元素，迭代结束时 ok 为 false
+func (it *Iterator) Next() (value object.Object, ok bool) {
+	return it.next()
+}
+
+// 按照 key 排序映射表的键值对：先按 key 的类型排序，同类型的 key 再按值排序
+func sortedHashPairs(hash *object.Hash) []object.HashPair {
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return compareHashKeys(pairs[i].Key, pairs[j].Key) < 0
+	})
+	return pairs
+}
+
+func compareHashKeys(a object.Object, b object.Object) int {
+	switch {
+	case isNumber(a) && isNumber(b):
+		if cmp := compareNumbers(a, b); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(string(a.Type()), string(b.Type()))
+
+	case a.Type() != b.Type():
+		return strings.Compare(string(a.Type()), string(b.Type()))
+
+	case a.Type() == object.STRING_OBJ:
+		return strings.Compare(a.(*object.String).Value, b.(*object.String).Value)
+
+	case a.Type() == object.BOOLEAN_OBJ:
+		if a == b {
+			return 0
+		} else if a == FALSE {
+			return -1
+		}
+		return 1
+
+	default:
+		return 0
+	}
+}
+
+// 比较两个数值的大小。整数跟浮点数按照它们的精确值比较，而不是先把整数转换为浮点数（可能丢失精度），
+// 因此比较的结果跟映射表的 key 一致（见 object.Float.HashKey）。NaN 跟任何数值比较的结果都为 0
+func compareNumbers(a object.Object, b object.Object) int {
+	ai, aok := a.(*object.Integer)
+	bi, bok := b.(*object.Integer)
+	if aok && bok {
+		return ai.BigValue().Cmp(bi.BigValue())
+	}
+
+	af, bf := toFloat(a), toFloat(b)
+	switch {
+	case math.IsNaN(af) || math.IsNaN(bf):
+		return 0
+	case aok || bok:
+		return toBigFloat(a).Cmp(toBigFloat(b))
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 执行模块的方式，返回模块的顶层环境。模块跟导入者使用同一个 runtime
+type ModuleRunner func(program *ast.Program, runtime *object.Runtime) (*object.Environment, *object.Error)
+
+// 加载 import 语句所指的模块：查找模块文件、检测循环导入，并把加载的模块缓存在 runtime 里。
+// 如果模块已经加载过，则直接返回缓存的模块，否则使用 run 执行模块
+func LoadModule(runtime *object.Runtime, node *ast.ImportStatement, run ModuleRunner) (*object.Module, *object.Error) {
+	importer := node.Token.Pos.File
+
+	file, ok := resolveModulePath(node.Path.Value, importer, runtime.SearchPath)
+	if !ok {
+		return nil, NewErrorAt(node.Path, object.IMPORT_ERROR, "module not found: %q", node.Path.Value)
+	}
+
+	key, _ := filepath.Abs(file)
+	if module, ok := runtime.Modules[key]; ok {
+		return module, nil
+	}
+
+	// 第一层的导入者是主脚本，它不在模块缓存里，所以把它也放进导入链，
+	// 以便检测到 "模块导入主脚本" 的循环
+	if len(runtime.Loading) == 0 && importer != "" {
+		if root, err := filepath.Abs(importer); err == nil {
+			runtime.Loading = append(runtime.Loading, root)
+			defer func() { runtime.Loading = nil }()
+		}
+	}
+
+	for i, path := range runtime.Loading {
+		if path == key {
+			cycle := []string{}
+			for _, p := range append(runtime.Loading[i:], key) {
+				cycle = append(cycle, displayPath(p))
+			}
+			return nil, NewErrorAt(node.Path, object.IMPORT_ERROR, "circular import: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	content, readErr := os.ReadFile(file)
+	if readErr != nil {
+		return nil, NewErrorAt(node.Path, object.IMPORT_ERROR, "cannot read module %q: %s", node.Path.Value, readErr)
+	}
+
+	p := parser.New(lexer.NewWithFile(file, string(content)))
+	program := p.ParseProgram()
+
+	// 语法错误位于模块的源码里，第一个语法错误作为错误本身，其余的语法错误作为附加标签，
+	// 另外附上 import 语句的位置
+	if errors := p.Errors(); len(errors) != 0 {
+		err := NewError(object.IMPORT_ERROR, "%s", errors[0].Message)
+		err.Pos = errors[0].Span.Start
+		err.End = errors[0].Span.End
+		for _, e := range errors[1:] {
+			err.Labels = append(err.Labels, object.ErrorLabel{Pos: e.Span.Start, End: e.Span.End, Message: e.Message})
+		}
+		return nil, importedHere(err, node)
+	}
+
+	// 模块引用了不存在的标识符时，不执行模块里的任何语句
+	if err := Resolve(program, nil); err != nil {
+		return nil, importedHere(err, node)
+	}
+
+	runtime.Loading = append(runtime.Loading, key)
+	env, err := run(program, runtime)
+	runtime.Loading = runtime.Loading[:len(runtime.Loading)-1]
+
+	if err != nil {
+		return nil, importedHere(err, node)
+	}
+
+	module := &object.Module{Path: file, Env: env, Exports: map[string]bool{}}
+	for _, statement := range program.Statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			for _, name := range PatternNames(export.Statement.Name) {
+				module.Exports[name] = true
+			}
+		}
+	}
+
+	runtime.Modules[key] = module
+	return module, nil
+}
+
+// 为模块里发生的错误附上 import 语句的位置
+func importedHere(err *object.Error, node *ast.ImportStatement) *object.Error {
+	err.Labels = append(err.Labels, object.ErrorLabel{
+		Pos:     node.Path.Pos(),
+		End:     node.Path.End(),
+		Message: "imported here",
+	})
+	return err
+}
+
+// 查找模块文件：绝对路径直接使用，相对路径首先相对于导入者所在的目录查找，
+// 然后依次在 searchPath 的各个目录里查找
+func resolveModulePath(path string, importer string, searchPath []string) (string, bool) {
+	candidates := []string{}
+	if filepath.IsAbs(path) {
+		candidates = append(candidates, path)
+	} else {
+		// 导入者为空字符串（比如 REPL）时，相对于当前目录查找
+		candidates = append(candidates, filepath.Join(filepath.Dir(importer), path))
+		for _, dir := range searchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+// 用于错误信息的路径，尽量显示为相对于当前目录的路径
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
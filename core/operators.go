@@ -0,0 +1,307 @@
+// original from https://interpreterbook.com/
+
+package core
+
+import (
+	"interpreter/object"
+	"math"
+	"math/big"
+)
+
+// 前缀运算 !、- 和 +
+func PrefixOperation(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "+":
+		return evalPlusPrefixOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	default:
+		// return NULL
+		return NewError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE // 所有非 false, null 的值都视为 true
+	}
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Big != nil || right.Value == math.MinInt64 {
+			return object.NewBigInteger(new(big.Int).Neg(right.BigValue()))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		// return NULL
+		return NewError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
+	}
+}
+
+func evalPlusPrefixOperatorExpression(right object.Object) object.Object {
+	if !isNumber(right) {
+		// return NULL
+		return NewError(object.TYPE_ERROR, "unknown operator: +%s", right.Type())
+	}
+
+	return right
+}
+
+// 中缀运算，不包括短路求值的 && 和 ||
+func InfixOperation(operator string, left object.Object, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ &&
+		right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+
+	// 整数和浮点数混合运算时，整数先转换为浮点数
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+
+	case left.Type() == object.STRING_OBJ &&
+		right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+
+	case operator == "==":
+		return NativeBoolToBooleanObject(left == right)
+
+	case operator == "!=":
+		return NativeBoolToBooleanObject(left != right)
+
+	case left.Type() != right.Type():
+		return NewError(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+
+	default:
+		// return NULL
+		return NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftInt := left.(*object.Integer)
+	rightInt := right.(*object.Integer)
+
+	// 两个整数都在 int64 范围之内，并且运算结果没有溢出时，直接使用 int64 运算
+	if leftInt.Big == nil && rightInt.Big == nil {
+		if result, ok := evalInt64InfixExpression(operator, leftInt.Value, rightInt.Value); ok {
+			return result
+		}
+	}
+
+	// 否则使用大整数运算，运算结果在 int64 范围之内时自动转回 int64 表示
+	leftValue := leftInt.BigValue()
+	rightValue := rightInt.BigValue()
+
+	switch operator {
+	case "+":
+		return object.NewBigInteger(new(big.Int).Add(leftValue, rightValue))
+	case "-":
+		return object.NewBigInteger(new(big.Int).Sub(leftValue, rightValue))
+	case "*":
+		return object.NewBigInteger(new(big.Int).Mul(leftValue, rightValue))
+
+	// 跟 int64 一样向零取整，余数的符号跟被除数相同
+	case "/":
+		if rightValue.Sign() == 0 {
+			return NewError(object.ARITHMETIC_ERROR, "division by zero")
+		}
+		return object.NewBigInteger(new(big.Int).Quo(leftValue, rightValue))
+	case "%":
+		if rightValue.Sign() == 0 {
+			return NewError(object.ARITHMETIC_ERROR, "modulo by zero")
+		}
+		return object.NewBigInteger(new(big.Int).Rem(leftValue, rightValue))
+
+	case "<":
+		return NativeBoolToBooleanObject(leftValue.Cmp(rightValue) < 0)
+	case ">":
+		return NativeBoolToBooleanObject(leftValue.Cmp(rightValue) > 0)
+	case "==":
+		return NativeBoolToBooleanObject(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return NativeBoolToBooleanObject(leftValue.Cmp(rightValue) != 0)
+
+	default:
+		// return NULL
+		return NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// 严格模式（见 object.Runtime）下，超出 int64 范围的整数视为溢出错误，其他值原样返回。
+// 执行引擎对整数字面量、运算以及函数调用的结果进行这项检查
+func CheckOverflow(obj object.Object, strict bool) object.Object {
+	if integer, ok := obj.(*object.Integer); ok && strict && integer.Big != nil {
+		return NewError(object.ARITHMETIC_ERROR, "integer overflow: %s is out of the range of 64-bit integers", integer.Big.String())
+	}
+	return obj
+}
+
+// int64 的运算，如果运算结果溢出则 ok 为 false
+func evalInt64InfixExpression(operator string, leftValue int64, rightValue int64) (result object.Object, ok bool) {
+	switch operator {
+	case "+":
+		sum := leftValue + rightValue
+		if (leftValue >= 0) == (rightValue >= 0) && (sum >= 0) != (leftValue >= 0) {
+			return nil, false
+		}
+		return &object.Integer{Value: sum}, true
+	case "-":
+		diff := leftValue - rightValue
+		if (leftValue >= 0) != (rightValue >= 0) && (diff >= 0) != (leftValue >= 0) {
+			return nil, false
+		}
+		return &object.Integer{Value: diff}, true
+	case "*":
+		if leftValue == 0 || rightValue == 0 {
+			return &object.Integer{Value: 0}, true
+		}
+		product := leftValue * rightValue
+		if product/rightValue != leftValue ||
+			leftValue == -1 && rightValue == math.MinInt64 ||
+			rightValue == -1 && leftValue == math.MinInt64 {
+			return nil, false
+		}
+		return &object.Integer{Value: product}, true
+	case "/":
+		if rightValue == 0 {
+			return NewError(object.ARITHMETIC_ERROR, "division by zero"), true
+		}
+		if leftValue == math.MinInt64 && rightValue == -1 {
+			return nil, false
+		}
+		return &object.Integer{Value: leftValue / rightValue}, true
+	case "%":
+		if rightValue == 0 {
+			return NewError(object.ARITHMETIC_ERROR, "modulo by zero"), true
+		}
+		if rightValue == -1 {
+			return &object.Integer{Value: 0}, true // 避免 math.MinInt64 % -1 溢出
+		}
+		return &object.Integer{Value: leftValue % rightValue}, true
+
+	case "<":
+		return NativeBoolToBooleanObject(leftValue < rightValue), true
+	case ">":
+		return NativeBoolToBooleanObject(leftValue > rightValue), true
+	case "==":
+		return NativeBoolToBooleanObject(leftValue == rightValue), true
+	case "!=":
+		return NativeBoolToBooleanObject(leftValue != rightValue), true
+
+	default:
+		return nil, false
+	}
+}
+
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		if rightValue == 0 {
+			return NewError(object.ARITHMETIC_ERROR, "division by zero")
+		}
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		if rightValue == 0 {
+			return NewError(object.ARITHMETIC_ERROR, "modulo by zero")
+		}
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
+
+	// 比较的是精确值（见 compareNumbers），NaN 跟任何数值（包括自身）都不相等
+	case "<", ">", "==", "!=":
+		if math.IsNaN(leftValue) || math.IsNaN(rightValue) {
+			return NativeBoolToBooleanObject(operator == "!=")
+		}
+		cmp := compareNumbers(left, right)
+		switch operator {
+		case "<":
+			return NativeBoolToBooleanObject(cmp < 0)
+		case ">":
+			return NativeBoolToBooleanObject(cmp > 0)
+		case "==":
+			return NativeBoolToBooleanObject(cmp == 0)
+		default:
+			return NativeBoolToBooleanObject(cmp != 0)
+		}
+
+	default:
+		return NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// 是否为数值（整数或者浮点数）
+func isNumber(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.Float:
+		return true
+	default:
+		return false
+	}
+}
+
+// 将数值转换为浮点数
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		if obj.Big != nil {
+			f, _ := new(big.Float).SetInt(obj.Big).Float64()
+			return f
+		}
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+// 将数值精确地转换为 big.Float，数值不能是 NaN
+func toBigFloat(obj object.Object) *big.Float {
+	if i, ok := obj.(*object.Integer); ok {
+		return new(big.Float).SetInt(i.BigValue())
+	}
+	return big.NewFloat(toFloat(obj))
+}
+
+func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftValue + rightValue}
+
+	case "<":
+		return NativeBoolToBooleanObject(leftValue < rightValue)
+	case ">":
+		return NativeBoolToBooleanObject(leftValue > rightValue)
+	case "==":
+		return NativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return NativeBoolToBooleanObject(leftValue != rightValue)
+
+	default:
+		return NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// 按照模式 pattern 匹配 value，模式里的每一个标识符（不包括通配符 "_"）连同对应的值传给 bind，
+// bind 返回的错误会中止匹配并原样返回。值跟模式不匹配时返回位于对应模式的错误
+func MatchPattern(pattern ast.Pattern, value object.Object, bind func(*ast.Identifier, object.Object) *object.Error) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			return bind(pattern, value)
+		}
+		return nil
+
+	case *ast.LiteralPattern:
+		literal := literalValue(pattern.Value)
+		if InfixOperation("==", literal, value) != TRUE {
+			return NewErrorAt(pattern, object.VALUE_ERROR, "value %s does not match pattern %s", value.Inspect(), pattern.String())
+		}
+		return nil
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return NewErrorAt(pattern, object.TYPE_ERROR, "cannot destructure %s as array", value.Type())
+		}
+
+		count := len(pattern.Elements)
+		if pattern.Rest == nil && len(array.Elements) != count {
+			return NewErrorAt(pattern, object.VALUE_ERROR, "expected array of length %d, actual %d", count, len(array.Elements))
+		}
+		if len(array.Elements) < count {
+			return NewErrorAt(pattern, object.VALUE_ERROR, "expected array of length at least %d, actual %d", count, len(array.Elements))
+		}
+
+		for i, element := range pattern.Elements {
+			if err := MatchPattern(element, array.Elements[i], bind); err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := make([]object.Object, len(array.Elements)-count)
+			copy(rest, array.Elements[count:])
+			return bind(pattern.Rest, &object.Array{Elements: rest})
+		}
+		return nil
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return NewErrorAt(pattern, object.TYPE_ERROR, "cannot destructure %s as hash", value.Type())
+		}
+
+		for i, keyNode := range pattern.Keys {
+			key := literalValue(keyNode)
+			hashKey, err := HashKey(key)
+			if err != nil {
+				return err
+			}
+
+			pair, ok := hash.Pairs[hashKey]
+			if !ok {
+				return NewErrorAt(keyNode, object.KEY_ERROR, "missing key %s in hash", key.Inspect())
+			}
+
+			if err := MatchPattern(pattern.Values[i], pair.Value, bind); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return NewError(object.INTERNAL_ERROR, "unsupported pattern: %s", pattern.String())
+	}
+}
+
+// 字面量模式以及映射表模式的 key 的值，它们只能是数值、字符串、布尔值以及负数
+func literalValue(node ast.Expression) object.Object {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return object.NewBigInteger(node.Big)
+		}
+		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return NativeBoolToBooleanObject(node.Value)
+	case *ast.PrefixExpression:
+		return PrefixOperation(node.Operator, literalValue(node.Right))
+	default:
+		return NewErrorAt(node, object.INTERNAL_ERROR, "unsupported literal in pattern: %s", node.String())
+	}
+}
+
+// 模式里声明的所有标识符（不包括通配符 "_"）
+func PatternNames(pattern ast.Pattern) []string {
+	names := []string{}
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			names = append(names, pattern.Value)
+		}
+
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			names = append(names, PatternNames(element)...)
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			names = append(names, pattern.Rest.Value)
+		}
+
+	case *ast.HashPattern:
+		for _, value := range pattern.Values {
+			names = append(names, PatternNames(value)...)
+		}
+	}
+
+	return names
+}
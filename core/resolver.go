@@ -0,0 +1,485 @@
+package core
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+	"sort"
+)
+
+// 执行之前的解析：为每一个标识符确定它是局部变量（位于往外第几层环境的第几个槽位）、
+// 全局变量还是内置函数，并把结果记录在 ast.Identifier 里，树遍历求值器求值时不再需要按照名称逐层查找环境。
+// 解析的同时检查引用了不存在的标识符的错误，各个执行引擎都在执行之前进行这项检查
+// （主程序见 executor.SafeRun，模块见 LoadModule，REPL 的输入见 ResolveInteractive）。
+//
+// 解析的作用域规则跟求值时创建环境的规则一一对应：
+//
+//	函数      形参和函数体共用一个环境，方法调用的接收者 self 也记录在这个环境里
+//	语句块    每一个语句块都有自己的环境，没有声明任何标识符的语句块不需要环境
+//	for 循环  每一次迭代都有一个只包含循环变量的环境，循环体是另外一个语句块
+//	catch     catch 语句块跟参数共用一个环境
+//	match     每一个分支都有一个存放模式绑定的变量的环境，分支的 body 是另外一个语句块
+//
+// 全局变量（主程序或者模块的顶层声明的标识符）仍然按照名称存放在全局环境里，
+// 以便 REPL 的多次输入共用全局变量，以及模块按照名称导出标识符
+
+type resolver struct {
+	scope       *scope                 // 当前的作用域，全局作用域为 nil
+	defined     func(name string) bool // 全局变量是否已经由先前执行的程序声明，可以为 nil
+	globals     map[string]bool        // 程序的顶层声明的标识符
+	interactive bool                   // 函数体里不存在的标识符留到调用时检查，见 ResolveInteractive
+	err         *object.Error          // 源码里位置最靠前的错误
+}
+
+// 解析时的作用域，对应求值时的一个环境（或者不需要环境的语句块）
+type scope struct {
+	outer    *scope
+	function bool // 函数的作用域
+	env      bool // 求值时是否创建环境
+
+	names     map[string]int  // 已经声明的标识符的槽位
+	constants map[string]bool // 使用 const 声明的标识符
+	size      int             // 环境的槽位数量
+
+	// 语句块里后面才声明的标识符，进入语句块时就分配好槽位，
+	// 使得在声明之前创建的闭包（比如互相调用的两个函数）也能访问它们
+	pending map[string]int
+}
+
+// 内置函数按照名称排序之后的列表，解析得到的内置函数的下标即是该列表的下标
+var builtinList, builtinIndexes = sortBuiltins()
+
+// 解析得到的下标为 index 的内置函数
+func BuiltinAt(index int) *object.Builtin {
+	return builtinList[index]
+}
+
+func sortBuiltins() ([]*object.Builtin, map[string]int) {
+	names := []string{}
+	for name := range Builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []*object.Builtin{}
+	indexes := map[string]int{}
+	for i, name := range names {
+		list = append(list, Builtins[name])
+		indexes[name] = i
+	}
+	return list, indexes
+}
+
+// 解析程序，defined 判断全局变量是否已经由先前执行的程序（比如 REPL 的上一行输入）声明，
+// 没有先前执行的程序时为 nil。如果程序引用了不存在的标识符，则返回位于源码最前面的那一个错误
+func Resolve(program *ast.Program, defined func(name string) bool) *object.Error {
+	return resolveProgram(&resolver{defined: defined}, program)
+}
+
+// 解析 REPL 的一行输入。函数引用的全局变量可能在后面的输入里才声明（比如分两行输入的互相调用的两个函数），
+// 因此函数体里不存在的标识符不报告错误，而是跟没有经过解析一样，在执行到它时才报告
+func ResolveInteractive(program *ast.Program, defined func(name string) bool) *object.Error {
+	return resolveProgram(&resolver{defined: defined, interactive: true}, program)
+}
+
+func resolveProgram(r *resolver, program *ast.Program) *object.Error {
+	r.globals = map[string]bool{}
+	for _, name := range DeclaredNames(program.Statements) {
+		r.globals[name] = true
+	}
+
+	r.statements(program.Statements)
+	program.Resolved = true
+	return r.err
+}
+
+func (r *resolver) statements(statements []ast.Statement) {
+	for _, statement := range statements {
+		r.resolve(statement)
+	}
+}
+
+func (r *resolver) expressions(expressions []ast.Expression) {
+	for _, expression := range expressions {
+		r.resolve(expression)
+	}
+}
+
+func (r *resolver) resolve(n ast.Node) {
+	switch node := n.(type) {
+
+	// 语句
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+
+	case *ast.LetStatement:
+		// 先解析值，因此 let x = x 里右侧的 x 是外层的 x
+		r.resolve(node.Value)
+		r.declarePattern(node.Name, node.Constant)
+
+	case *ast.ExportStatement:
+		r.resolve(node.Statement)
+
+	case *ast.ImportStatement:
+		if node.Alias != nil {
+			r.declare(node.Alias, false)
+		}
+		for _, local := range node.Locals {
+			r.declare(local, false)
+		}
+
+	case *ast.ReturnStatement:
+		r.resolve(node.ReturnValue)
+
+	case *ast.ThrowStatement:
+		r.resolve(node.Value)
+
+	case *ast.WhileStatement:
+		r.resolve(node.Condition)
+		r.block(node.Body)
+
+	case *ast.ForStatement:
+		r.resolve(node.Iterable)
+		r.enter(false, true)
+		r.declare(node.Variable, false)
+		r.block(node.Body)
+		r.leave()
+
+	case *ast.BlockStatement:
+		r.block(node)
+
+	// 表达式
+	case *ast.Identifier:
+		r.use(node)
+
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.block(node.Consequence)
+		if node.Alternative != nil {
+			r.block(node.Alternative)
+		}
+
+	case *ast.MatchExpression:
+		r.resolve(node.Subject)
+		for _, arm := range node.Arms {
+			r.enter(false, len(PatternNames(arm.Pattern)) > 0)
+			r.declarePattern(arm.Pattern, false)
+			arm.Slots = r.scope.size
+			r.block(arm.Body)
+			r.leave()
+		}
+
+	case *ast.TryExpression:
+		r.block(node.Block)
+		if node.Catch != nil {
+			// catch 语句块跟参数共用同一个作用域
+			names := DeclaredNames(node.Catch.Statements)
+			if node.Parameter != nil {
+				names = append(names, PatternNames(node.Parameter)...)
+			}
+
+			r.enter(false, len(names) > 0)
+			if node.Parameter != nil {
+				r.declarePattern(node.Parameter, false)
+			}
+			r.scope.hoist(node.Catch.Statements)
+			r.statements(node.Catch.Statements)
+			node.Catch.Slots = r.scope.size
+			r.leave()
+		}
+		if node.Finally != nil {
+			r.block(node.Finally)
+		}
+
+	case *ast.AssignExpression:
+		r.resolve(node.Value)
+		switch target := node.Target.(type) {
+		case *ast.Identifier:
+			r.assign(node, target)
+		case *ast.IndexExpression:
+			r.resolve(target.Left)
+			r.resolve(target.Index)
+		case *ast.MemberExpression:
+			r.resolve(target.Object)
+		}
+
+	case *ast.FunctionLiteral:
+		r.function(node)
+
+	case *ast.CallExpression:
+		r.resolve(node.Function)
+		r.expressions(node.Arguments)
+
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+
+	case *ast.MemberExpression:
+		r.resolve(node.Object) // 成员的名称不是标识符引用
+
+	case *ast.InterpolatedString:
+		r.expressions(node.Parts)
+
+	case *ast.ArrayLiteral:
+		r.expressions(node.Elements)
+
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			r.resolve(key)
+			r.resolve(value)
+		}
+	}
+}
+
+// 语句块有自己的作用域，只有声明了标识符的语句块才需要环境
+func (r *resolver) block(block *ast.BlockStatement) {
+	r.enter(false, len(DeclaredNames(block.Statements)) > 0)
+	r.scope.hoist(block.Statements)
+	r.statements(block.Statements)
+	block.Slots = r.scope.size
+	r.leave()
+}
+
+// 函数的形参跟函数体共用同一个作用域，即函数体里不能重新声明形参
+func (r *resolver) function(node *ast.FunctionLiteral) {
+	s := r.enter(true, true)
+
+	// 默认值在绑定前面的形参之后求值，因此可以引用前面的形参
+	for i, param := range node.Parameters {
+		if i < len(node.Defaults) && node.Defaults[i] != nil {
+			r.resolve(node.Defaults[i])
+		}
+		r.declarePattern(param, false)
+	}
+
+	// 剩余参数跟同名的形参共用槽位，即覆盖形参
+	if node.Rest != nil {
+		if slot, ok := s.names[node.Rest.Value]; ok {
+			annotateLocal(node.Rest, 0, slot, false)
+		} else {
+			r.declare(node.Rest, false)
+		}
+	}
+
+	s.hoist(node.Body.Statements)
+	r.statements(node.Body.Statements)
+	node.Body.Slots = s.size
+	r.leave()
+
+	markTailCalls(node.Body)
+}
+
+func (r *resolver) enter(function bool, env bool) *scope {
+	r.scope = &scope{
+		outer:     r.scope,
+		function:  function,
+		env:       env,
+		names:     map[string]int{},
+		constants: map[string]bool{},
+		pending:   map[string]int{},
+	}
+	return r.scope
+}
+
+func (r *resolver) leave() {
+	r.scope = r.scope.outer
+}
+
+// 在当前作用域里声明标识符。重复声明在求值时才报告（同名的标识符分配到同一个槽位，
+// 求值时发现槽位已经有值），使得它跟其他运行时错误一样可以被 try 捕获
+func (r *resolver) declare(name *ast.Identifier, constant bool) {
+	if r.scope == nil {
+		name.Resolution = ast.Global
+		return
+	}
+
+	slot, ok := r.scope.names[name.Value]
+	if !ok {
+		slot, ok = r.scope.pending[name.Value]
+		if ok {
+			delete(r.scope.pending, name.Value)
+		} else {
+			slot = r.scope.size
+			r.scope.size++
+		}
+
+		r.scope.names[name.Value] = slot
+		r.scope.constants[name.Value] = constant
+	}
+
+	annotateLocal(name, 0, slot, constant)
+}
+
+// 声明模式里的所有标识符（不包括通配符 "_"）
+func (r *resolver) declarePattern(pattern ast.Pattern, constant bool) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			r.declare(pattern, constant)
+		}
+
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			r.declarePattern(element, constant)
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			r.declare(pattern.Rest, constant)
+		}
+
+	case *ast.HashPattern:
+		for _, value := range pattern.Values {
+			r.declarePattern(value, constant)
+		}
+	}
+}
+
+// 解析引用标识符的表达式
+func (r *resolver) use(node *ast.Identifier) {
+	if r.lookup(node) {
+		return
+	}
+
+	// self 在方法调用时才有值，只能在求值时检查
+	if node.Value != "self" {
+		r.report(node, "identifier not found: %s", node.Value)
+	}
+}
+
+// 解析赋值表达式的目标，对于复合赋值，目标的当前值也参与运算
+func (r *resolver) assign(node *ast.AssignExpression, target *ast.Identifier) {
+	if r.lookup(target) {
+		return
+	}
+
+	if node.Operator == "=" {
+		r.report(node, "cannot assign to undefined variable: %s", target.Value)
+	} else {
+		r.report(node, "identifier not found: %s", target.Value)
+	}
+}
+
+// 由内向外查找声明标识符的作用域，找不到时依次尝试全局变量和内置函数，都找不到时返回 false。
+//
+// 同一个函数里，后面才声明的标识符在声明之前不可见（此时引用的是外层的同名标识符），
+// 而内层函数可以看到外层函数后面才声明的标识符（调用时再检查它是否已经声明）
+func (r *resolver) lookup(node *ast.Identifier) bool {
+	depth := 0
+	crossed := false // 是否已经离开了当前函数
+
+	for s := r.scope; s != nil; s = s.outer {
+		if slot, ok := s.names[node.Value]; ok {
+			annotateLocal(node, depth, slot, s.constants[node.Value])
+			return true
+		}
+		if slot, ok := s.pending[node.Value]; ok && crossed {
+			annotateLocal(node, depth, slot, s.constants[node.Value])
+			return true
+		}
+
+		if s.env {
+			depth++
+		}
+		if s.function {
+			crossed = true
+		}
+	}
+
+	if r.globals[node.Value] {
+		node.Resolution = ast.Global
+		return true
+	}
+	if r.defined != nil && r.defined(node.Value) {
+		node.Resolution = ast.Global
+		return true
+	}
+
+	if index, ok := builtinIndexes[node.Value]; ok {
+		node.Resolution = ast.Builtin
+		node.Index = index
+		return true
+	}
+
+	node.Resolution = ast.Global // 求值时仍然按照名称查找，并报告同样的错误
+	return false
+}
+
+// 记录错误，只保留源码里位置最靠前的错误
+func (r *resolver) report(node ast.Node, format string, a ...interface{}) {
+	if r.interactive && r.inFunction() {
+		return
+	}
+	if r.err != nil && r.err.Pos.Offset <= node.Pos().Offset {
+		return
+	}
+	r.err = NewErrorAt(node, object.NAME_ERROR, format, a...)
+}
+
+// 当前是否位于函数里
+func (r *resolver) inFunction() bool {
+	for s := r.scope; s != nil; s = s.outer {
+		if s.function {
+			return true
+		}
+	}
+	return false
+}
+
+func annotateLocal(node *ast.Identifier, depth int, slot int, constant bool) {
+	node.Resolution = ast.Local
+	node.Depth = depth
+	node.Index = slot
+	node.Constant = constant
+}
+
+// 为语句里将要声明的标识符预先分配槽位，
+// 同时记录它们是否常量，以便内层函数在声明之前就引用它们时也能检查赋值
+func (s *scope) hoist(statements []ast.Statement) {
+	for _, statement := range statements {
+		constant := false
+		switch statement := statement.(type) {
+		case *ast.LetStatement:
+			constant = statement.Constant
+		case *ast.ExportStatement:
+			constant = statement.Statement.Constant
+		}
+
+		for _, name := range DeclaredNames([]ast.Statement{statement}) {
+			if _, ok := s.names[name]; ok {
+				continue
+			}
+			if _, ok := s.pending[name]; ok {
+				continue
+			}
+			s.pending[name] = s.size
+			s.constants[name] = constant
+			s.size++
+		}
+	}
+}
+
+// 语句直接声明的所有标识符（不包括内层语句块里的声明）
+func DeclaredNames(statements []ast.Statement) []string {
+	names := []string{}
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.LetStatement:
+			names = append(names, PatternNames(statement.Name)...)
+		case *ast.ExportStatement:
+			names = append(names, PatternNames(statement.Statement.Name)...)
+		case *ast.ImportStatement:
+			if statement.Alias != nil {
+				names = append(names, statement.Alias.Value)
+			}
+			for _, local := range statement.Locals {
+				names = append(names, local.Value)
+			}
+		}
+	}
+	return names
+}
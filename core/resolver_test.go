@@ -0,0 +1,151 @@
+package core
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+func testParse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	return p.ParseProgram()
+}
+
+// 解析结果的文本形式：局部变量为 "name@depth.index"，全局变量为 "name@G"，内置函数为 "name@B"
+func resolutionString(node *ast.Identifier) string {
+	switch node.Resolution {
+	case ast.Local:
+		return fmt.Sprintf("%s@%d.%d", node.Value, node.Depth, node.Index)
+	case ast.Global:
+		return node.Value + "@G"
+	case ast.Builtin:
+		return node.Value + "@B"
+	default:
+		return node.Value + "@?"
+	}
+}
+
+func TestResolveIdentifiers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // 按照源码顺序排列的所有标识符的解析结果
+	}{
+		{
+			"let x = 1; x + len([])",
+			"x@G x@G len@B",
+		},
+		{
+			"let f = fn(a, b) { let c = a; fn() { a + c + f } }",
+			"f@G a@0.0 b@0.1 c@0.2 a@0.0 a@1.0 c@1.2 f@G",
+		},
+		{
+			// 没有声明标识符的语句块不需要环境
+			"let f = fn(a) { if (a) { a } else { let b = a; b } }",
+			"f@G a@0.0 a@0.0 a@0.0 b@0.0 a@1.0 b@0.0",
+		},
+		{
+			// 循环变量位于每次迭代的环境里，循环体是另外一个语句块
+			"fn() { for (x in [1]) { let y = x; y } }",
+			"x@0.0 y@0.0 x@1.0 y@0.0",
+		},
+		{
+			// 互相调用的函数：内层函数可以引用外层后面才声明的标识符
+			"fn() { let even = fn(n) { odd(n) }; let odd = fn(n) { even(n) } }",
+			"even@0.0 n@0.0 odd@1.1 n@0.0 odd@0.1 n@0.0 even@1.0 n@0.0",
+		},
+		{
+			// 同一个函数里，声明之前引用的是外层的同名标识符
+			"let x = 1; fn() { let y = x; let x = 2 }",
+			"x@G y@0.0 x@G x@0.1",
+		},
+		{
+			// 剩余参数覆盖同名的形参，catch 语句块跟参数共用环境
+			"fn(a, ...a) { try { a } catch ([e]) { let m = e; m } }",
+			"a@0.0 a@0.0 a@0.0 e@0.0 m@0.1 e@0.0 m@0.1",
+		},
+		{
+			// match 分支的模式绑定位于分支的环境里，分支的 body 是另外一个语句块
+			"fn(v) { match (v) { [h, ...t] => { let n = h; t }, _ => v } }",
+			"v@0.0 v@0.0 h@0.0 t@0.1 n@0.0 h@1.0 t@1.1 _@? v@0.0",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParse(tt.input)
+		if err := Resolve(program, nil); err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.input, err.Message)
+			continue
+		}
+
+		actual := []string{}
+		ast.Inspect(program, func(node ast.Node) bool {
+			if identifier, ok := node.(*ast.Identifier); ok {
+				actual = append(actual, resolutionString(identifier))
+			}
+			return true
+		})
+
+		if strings.Join(actual, " ") != tt.expected {
+			t.Errorf("%q: expected %q, actual %q", tt.input, tt.expected, strings.Join(actual, " "))
+		}
+	}
+}
+
+func TestResolveUndefinedIdentifiers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // 错误信息和位置，没有错误时为空字符串
+	}{
+		{"let f = fn() { missing }; 1", "identifier not found: missing at 1:16"},
+		{"if (false) { puts(a) }; puts(b)", "identifier not found: a at 1:19"},
+		{"if (true) { x; let x = 1 }", "identifier not found: x at 1:13"},
+		{"fn() { y = 1 }", "cannot assign to undefined variable: y at 1:10"},
+		{"fn() { y += 1 }", "identifier not found: y at 1:10"},
+		{"let f = fn() { g() }; let g = fn() { 1 }", ""},
+		{"fn() { self }", ""}, // self 在方法调用时才有值
+		{"let x = 1; puts(x); len = 1", ""},
+	}
+
+	for _, tt := range tests {
+		err := Resolve(testParse(tt.input), nil)
+
+		actual := ""
+		if err != nil {
+			actual = fmt.Sprintf("%s at %s", err.Message, err.Pos)
+		}
+		if actual != tt.expected {
+			t.Errorf("%q: expected %q, actual %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+// REPL 的输入里，函数体里不存在的标识符留到调用时检查，函数体之外的仍然在执行之前报告
+func TestResolveInteractive(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let even = fn(n) { odd(n - 1) }", ""},
+		{"let f = fn() { later = 1; later += 1 }", ""},
+		{"let f = fn(x = missing) { x }", ""},
+		{"let f = fn() { 1 }; missing", "identifier not found: missing at 1:21"},
+		{"if (true) { fn() { a }; b }", "identifier not found: b at 1:25"},
+	}
+
+	for _, tt := range tests {
+		err := ResolveInteractive(testParse(tt.input), nil)
+
+		actual := ""
+		if err != nil {
+			actual = fmt.Sprintf("%s at %s", err.Message, err.Pos)
+		}
+		if actual != tt.expected {
+			t.Errorf("%q: expected %q, actual %q", tt.input, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// 标记函数体里处于尾部位置的调用，即调用的结果直接作为函数的返回值：
+//
+//   - 函数体的最后一条语句
+//   - 尾部位置的 if 表达式（以及 match 表达式）的每一个分支的最后一条语句
+//   - return 语句的值
+//
+// try 表达式里的调用不是尾调用，因为被调用的函数发生的错误需要由 try 捕获，而且 finally 语句块需要在调用之后执行。
+// 执行之前的解析（Resolve）在解析函数字面量时调用，各个执行引擎只需要检查 ast.CallExpression.Tail
+func markTailCalls(body *ast.BlockStatement) {
+	markTailBlock(body)
+
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral, *ast.TryExpression:
+			return false // 内层函数另外标记
+		case *ast.ReturnStatement:
+			markTailExpression(node.ReturnValue)
+		}
+		return true
+	})
+}
+
+func markTailBlock(block *ast.BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		return
+	}
+
+	if statement, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement); ok {
+		markTailExpression(statement.Expression)
+	}
+}
+
+func markTailExpression(expression ast.Expression) {
+	switch expression := expression.(type) {
+	case *ast.CallExpression:
+		expression.Tail = true
+
+	case *ast.IfExpression:
+		markTailBlock(expression.Consequence)
+		markTailBlock(expression.Alternative)
+
+	case *ast.MatchExpression:
+		for _, arm := range expression.Arms {
+			markTailBlock(arm.Body)
+		}
+	}
+}
+
+// 尾调用的调用栈最多保留的层数，更外层的尾调用不再记录，以免深度的尾递归占用过多的内存
+const MaxTailFrames = 100
+
+// 循环地执行函数返回的尾调用（见 object.TailCall），直到得到最终的结果（trampoline），
+// 因此尾递归（包括互相调用的函数）不会增加 Go 的调用栈的深度。call 执行一次函数调用，
+// 返回函数的结果，或者函数在尾部位置的调用
+func RunTailCalls(result object.Object, call func(fn object.Object, args []object.Object, self object.Object) object.Object) object.Object {
+	var tailFrames []object.StackFrame
+	for {
+		tail, ok := result.(*object.TailCall)
+		if !ok {
+			break
+		}
+
+		tailFrames = AppendTailFrame(tailFrames, tail.Call, tail.Function)
+		result = call(tail.Function, tail.Arguments, tail.Self)
+
+		// 没有位置信息的错误（比如参数数量不对）位于尾调用的位置
+		Located(tail.Call, result)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		AppendTailTrace(err, tailFrames)
+	}
+	return result
+}
+
+// 记录一层尾调用，超出 MaxTailFrames 的两倍时丢弃更外层的记录
+func AppendTailFrame(frames []object.StackFrame, call *ast.CallExpression, fn object.Object) []object.StackFrame {
+	if len(frames) == 2*MaxTailFrames {
+		frames = append(frames[:0], frames[MaxTailFrames:]...)
+	}
+	return append(frames, object.StackFrame{Function: FunctionName(call, fn), Pos: call.Pos()})
+}
+
+// 为从尾调用里传出来的错误补上每一层尾调用（最内层的 MaxTailFrames 层）的调用栈，
+// 跟没有尾调用优化时一样
+func AppendTailTrace(err *object.Error, frames []object.StackFrame) {
+	if len(frames) > MaxTailFrames {
+		frames = frames[len(frames)-MaxTailFrames:]
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		err.Trace = append(err.Trace, frames[i])
+	}
+}
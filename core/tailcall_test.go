@@ -0,0 +1,48 @@
+package core
+
+import (
+	"interpreter/ast"
+	"strings"
+	"testing"
+)
+
+func TestMarkTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // 被标记为尾调用的调用表达式，以 "; " 分隔
+	}{
+		{"fn(x) { f(x) }", "f(x)"},
+		{"fn(x) { f(x); g(x) }", "g(x)"},
+		{"fn(x) { g(f(x)) }", "g(f(x))"},
+		{"fn(x) { f(x) + 1 }", ""},
+		{"fn(x) { let y = f(x) }", ""},
+		{"fn(x) { if (x) { f(x) } else { g(x) } }", "f(x); g(x)"},
+		{"fn(x) { if (x) { f(x) } else { let y = g(x) }; 1 }", ""},
+		{"fn(x) { if (x) { return f(x) }; g(x) }", "f(x); g(x)"},
+		{"fn(x) { while (x) { return f(x) } }", "f(x)"},
+		{"fn(x) { match (x) { 1 => f(x), _ => g(x) } }", "f(x); g(x)"},
+		{"fn(x) { try { f(x) } catch (e) { g(x) } }", ""},
+		{"fn(x) { try { return f(x) } finally { 1 } }", ""},
+		{"fn(x) { fn() { f(x) }; g(x) }", "f(x); g(x)"},
+		{"f(1)", ""}, // 顶层的调用不在函数里
+	}
+
+	for _, tt := range tests {
+		program := testParse(tt.input)
+		if err := Resolve(program, nil); err != nil && !strings.HasPrefix(err.Message, "identifier not found") {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err.Message)
+		}
+
+		tails := []string{}
+		ast.Inspect(program, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpression); ok && call.Tail {
+				tails = append(tails, call.String())
+			}
+			return true
+		})
+
+		if strings.Join(tails, "; ") != tt.expected {
+			t.Errorf("%q: expected %q, actual %q", tt.input, tt.expected, strings.Join(tails, "; "))
+		}
+	}
+}
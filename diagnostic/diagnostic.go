@@ -0,0 +1,91 @@
+package diagnostic
+
+import (
+	"fmt"
+	"interpreter/object"
+	"interpreter/token"
+)
+
+// 诊断信息的严重程度
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// 源码中的一段区间，包括 Start，不包括 End
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// 返回 token 在源码中所占的区间
+func TokenSpan(tk token.Token) Span {
+	return Span{Start: tk.Pos, End: tk.End}
+}
+
+// 诊断信息的附加标签，用于指出跟问题相关的其他位置
+type Label struct {
+	Span    Span
+	Message string
+}
+
+// 调用栈中的一帧
+type Frame struct {
+	Function string
+	Pos      token.Position
+}
+
+// 诊断信息，用于报告在解析和运行源码过程中发现的问题
+type Diagnostic struct {
+	Severity Severity
+	Code     string // 错误的种类，比如运行时错误的 "TypeError"，为空表示没有
+	Span     Span
+	Message  string
+	Expected []token.TokenType // 期望出现的 token 类型，为空表示不适用
+	Labels   []Label
+	Trace    []Frame // 运行时错误的调用栈，最内层的调用在前
+}
+
+// 将运行时错误转换为诊断信息
+func FromError(err *object.Error) Diagnostic {
+	d := Diagnostic{
+		Severity: Error,
+		Code:     string(err.Kind),
+		Span:     Span{Start: err.Pos, End: err.End},
+		Message:  err.Message,
+	}
+
+	for _, label := range err.Labels {
+		d.Labels = append(d.Labels, Label{
+			Span:    Span{Start: label.Pos, End: label.End},
+			Message: label.Message,
+		})
+	}
+
+	for _, frame := range err.Trace {
+		d.Trace = append(d.Trace, Frame{Function: frame.Function, Pos: frame.Pos})
+	}
+
+	return d
+}
+
+// 返回 "file:line:col: error: message" 格式的字符串
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Span.Start, d.Severity, d.Message)
+}
@@ -0,0 +1,318 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ANSI 颜色代码
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[1;31m"
+	colorYellow = "\x1b[1;33m"
+	colorGreen  = "\x1b[1;32m"
+	colorBlue   = "\x1b[1;34m"
+)
+
+// 以类似 Rust 编译器的格式输出诊断信息，比如：
+//
+//	error: type mismatch: INTEGER + STRING
+//	 --> demo.toy:2:7
+//	  |
+//	1 | let f = fn(x) {
+//	  |         -- function defined here
+//	2 |     x + "s"
+//	  |       ^
+//
+// 诊断信息的主区间用 "^" 标出，附加标签的区间用 "-" 标出。
+type Renderer struct {
+	Color bool // 是否使用 ANSI 颜色输出
+
+	sources map[string]string // 文件名 -> 源码
+}
+
+func NewRenderer(color bool) *Renderer {
+	return &Renderer{
+		Color:   color,
+		sources: make(map[string]string),
+	}
+}
+
+// 登记源码，用于输出出错的源码行。
+// 对于从 REPL 输入的源码，文件名是 "<repl:N>" 形式的伪文件名，N 为输入的序号。
+func (r *Renderer) AddSource(file string, text string) {
+	r.sources[file] = text
+}
+
+// 获取文件的源码，如果文件没有登记，则尝试从磁盘读取
+func (r *Renderer) source(file string) (string, bool) {
+	if text, ok := r.sources[file]; ok {
+		return text, true
+	}
+
+	if file == "" {
+		return "", false
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+
+	text := string(content)
+	r.sources[file] = text
+	return text, true
+}
+
+// 需要在源码行下方标出的区间
+type annotation struct {
+	span    Span
+	message string
+	primary bool
+}
+
+func (r *Renderer) Render(w io.Writer, d Diagnostic) {
+	// 标题，比如 "error: expected an expression" 或者 "error[TypeError]: type mismatch: INTEGER + STRING"
+	severity := d.Severity.String()
+	if d.Code != "" {
+		severity += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(w, "%s: %s\n",
+		r.paint(severityColor(d.Severity), severity),
+		r.paint(colorBold, d.Message))
+
+	if d.Span.Start.IsValid() {
+		r.renderSpans(w, d)
+	}
+
+	r.renderTrace(w, d.Trace)
+}
+
+// 输出调用栈，比如：
+//
+//	stack trace:
+//	  at iter (demo.toy:12:13)
+//	  at fold (demo.toy:15:5)
+//
+// 调用栈很深时（比如超出调用层数的递归）只输出最内层和最外层的各 traceEdge 层，省略中间的部分
+func (r *Renderer) renderTrace(w io.Writer, trace []Frame) {
+	if len(trace) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, r.paint(colorBold, "stack trace:"))
+	for i, frame := range trace {
+		if len(trace) > 2*traceEdge && i >= traceEdge && i < len(trace)-traceEdge {
+			if i == traceEdge {
+				fmt.Fprintf(w, "  ... %d more frames ...\n", len(trace)-2*traceEdge)
+			}
+			continue
+		}
+		fmt.Fprintf(w, "  at %s (%s)\n", frame.Function, frame.Pos)
+	}
+}
+
+// 调用栈很深时，最内层和最外层各自输出的层数
+const traceEdge = 10
+
+func (r *Renderer) renderSpans(w io.Writer, d Diagnostic) {
+	// 按文件将区间分组，主区间所在的文件排在最前面
+	annotations := []annotation{{span: d.Span, primary: true}}
+	for _, label := range d.Labels {
+		if label.Span.Start.IsValid() {
+			annotations = append(annotations, annotation{span: label.Span, message: label.Message})
+		}
+	}
+
+	files := []string{}
+	groups := map[string][]annotation{}
+	maxLine := 0
+	for _, a := range annotations {
+		file := a.span.Start.File
+		if _, ok := groups[file]; !ok {
+			files = append(files, file)
+		}
+		groups[file] = append(groups[file], a)
+
+		if a.span.Start.Line > maxLine {
+			maxLine = a.span.Start.Line
+		}
+	}
+
+	// 行号栏的宽度
+	width := len(strconv.Itoa(maxLine))
+	indent := strings.Repeat(" ", width)
+
+	for idx, file := range files {
+		group := groups[file]
+
+		// 第一组显示 "-->"，其余（位于其他文件的）显示 ":::"
+		arrow := "-->"
+		if idx > 0 {
+			arrow = ":::"
+		}
+		fmt.Fprintf(w, "%s%s %s\n", indent, r.paint(colorBlue, arrow), group[0].span.Start)
+
+		text, ok := r.source(file)
+		if !ok {
+			continue
+		}
+		r.renderSnippet(w, text, group, width)
+	}
+}
+
+// 输出源码片段以及区间的标记
+func (r *Renderer) renderSnippet(w io.Writer, text string, group []annotation, width int) {
+	lines := strings.Split(text, "\n")
+
+	// 每一行的开始位置（字节偏移量）
+	lineStarts := make([]int, len(lines))
+	offset := 0
+	for i, line := range lines {
+		lineStarts[i] = offset
+		offset += len(line) + 1
+	}
+
+	sort.SliceStable(group, func(i, j int) bool {
+		a, b := group[i].span.Start, group[j].span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	gutter := r.paint(colorBlue, strings.Repeat(" ", width)+" |")
+	fmt.Fprintln(w, gutter)
+
+	lastLine := 0
+	for _, a := range group {
+		lineNo := a.span.Start.Line
+		if lineNo > len(lines) {
+			continue
+		}
+
+		if lineNo != lastLine {
+			if lastLine > 0 && lineNo > lastLine+1 {
+				fmt.Fprintln(w, r.paint(colorBlue, "..."))
+			}
+
+			line := strings.TrimRight(lines[lineNo-1], "\r")
+			fmt.Fprintf(w, "%s %s\n",
+				r.paint(colorBlue, fmt.Sprintf("%*d |", width, lineNo)),
+				line)
+			lastLine = lineNo
+		}
+
+		line := strings.TrimRight(lines[lineNo-1], "\r")
+		padding, length := markerRange(line, lineStarts[lineNo-1], a.span)
+
+		mark, color := "-", colorBlue
+		if a.primary {
+			mark, color = "^", colorRed
+		}
+
+		marker := strings.Repeat(mark, length)
+		if a.message != "" {
+			marker += " " + a.message
+		}
+		fmt.Fprintf(w, "%s %s%s\n", gutter, padding, r.paint(color, marker))
+	}
+}
+
+// 计算标记前面的填充字符以及标记的长度。
+// 填充字符保留源码行中的制表符，以便标记能够跟源码对齐。
+func markerRange(line string, lineStart int, span Span) (string, int) {
+	start := span.Start.Offset - lineStart
+	if start < 0 || start > len(line) {
+		// 偏移量跟源码不一致，退而使用列号
+		start = span.Start.Column - 1
+		if start < 0 || start > len(line) {
+			start = 0
+		}
+	}
+
+	var padding strings.Builder
+	for _, ch := range line[:start] {
+		if ch == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteString(strings.Repeat(" ", displayWidth(ch)))
+		}
+	}
+
+	// 标记的长度，跨越多行的区间只标记到第一行的末尾
+	end := span.End.Offset - lineStart
+	if !span.End.IsValid() || span.End.Line != span.Start.Line || end > len(line) {
+		end = len(line)
+		if !span.End.IsValid() {
+			end = start
+		}
+	}
+
+	length := 0
+	if end > start {
+		for _, ch := range line[start:end] {
+			length += displayWidth(ch)
+		}
+	}
+	if length == 0 {
+		length = 1
+	}
+
+	return padding.String(), length
+}
+
+// 字符在终端上显示的宽度，东亚宽字符（汉字、假名、全角符号等）占两列
+func displayWidth(ch rune) int {
+	switch {
+	case ch >= 0x1100 && ch <= 0x115F, // 谚文字母
+		ch >= 0x2E80 && ch <= 0xA4CF && ch != 0x303F, // CJK 部首、标点、假名、汉字等
+		ch >= 0xAC00 && ch <= 0xD7A3,                 // 谚文音节
+		ch >= 0xF900 && ch <= 0xFAFF,                 // CJK 兼容汉字
+		ch >= 0xFE30 && ch <= 0xFE4F,                 // CJK 兼容形式
+		ch >= 0xFF00 && ch <= 0xFF60,                 // 全角字符
+		ch >= 0xFFE0 && ch <= 0xFFE6,
+		ch >= 0x1F300 && ch <= 0x1F64F, // emoji
+		ch >= 0x1F900 && ch <= 0x1F9FF,
+		ch >= 0x20000 && ch <= 0x3FFFD: // CJK 扩展汉字
+		return 2
+	}
+	return 1
+}
+
+func severityColor(s Severity) string {
+	switch s {
+	case Warning:
+		return colorYellow
+	case Note:
+		return colorGreen
+	default:
+		return colorRed
+	}
+}
+
+func (r *Renderer) paint(color string, s string) string {
+	if !r.Color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// 判断是否应该向文件 f 输出颜色：f 是终端并且没有设置环境变量 NO_COLOR
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,213 @@
+package diagnostic
+
+import (
+	"bytes"
+	"interpreter/object"
+	"interpreter/token"
+	"strings"
+	"testing"
+)
+
+func TestRenderDiagnostic(t *testing.T) {
+	source := "let x = 1;\nlet y = x +;\n"
+
+	d := Diagnostic{
+		Severity: Error,
+		Span: Span{
+			Start: token.Position{File: "demo.toy", Line: 2, Column: 12, Offset: 22},
+			End:   token.Position{File: "demo.toy", Line: 2, Column: 13, Offset: 23},
+		},
+		Message: `expected an expression, actual ";"`,
+	}
+
+	expected := `error: expected an expression, actual ";"
+ --> demo.toy:2:12
+  |
+2 | let y = x +;
+  |            ^
+`
+
+	renderer := NewRenderer(false)
+	renderer.AddSource("demo.toy", source)
+
+	var out bytes.Buffer
+	renderer.Render(&out, d)
+
+	if out.String() != expected {
+		t.Errorf("expected\n%s\nactual\n%s", expected, out.String())
+	}
+}
+
+func TestRenderErrorWithLabel(t *testing.T) {
+	source := "let f = fn(x) {\n\tx + \"s\"\n};\n\n\nf(1);\n"
+
+	err := &object.Error{
+		Message: "type mismatch: INTEGER + STRING",
+		Pos:     token.Position{Line: 2, Column: 4, Offset: 19},
+		End:     token.Position{Line: 2, Column: 5, Offset: 20},
+		Labels: []object.ErrorLabel{
+			{
+				Pos:     token.Position{Line: 1, Column: 9, Offset: 8},
+				End:     token.Position{Line: 1, Column: 11, Offset: 10},
+				Message: "function defined here",
+			},
+			{
+				Pos:     token.Position{Line: 6, Column: 2, Offset: 31},
+				End:     token.Position{Line: 6, Column: 3, Offset: 32},
+				Message: "called here",
+			},
+		},
+	}
+
+	expected := `error: type mismatch: INTEGER + STRING
+ --> 2:4
+  |
+1 | let f = fn(x) {
+  |         -- function defined here
+2 | 	x + "s"
+  | 	  ^
+...
+6 | f(1);
+  |  - called here
+`
+
+	renderer := NewRenderer(false)
+	renderer.AddSource("", source)
+
+	var out bytes.Buffer
+	renderer.Render(&out, FromError(err))
+
+	if out.String() != expected {
+		t.Errorf("expected\n%s\nactual\n%s", expected, out.String())
+	}
+}
+
+func TestRenderErrorKind(t *testing.T) {
+	err := &object.Error{
+		Kind:    object.TYPE_ERROR,
+		Message: "type mismatch: INTEGER + STRING",
+		Pos:     token.Position{File: "demo.toy", Line: 1, Column: 3, Offset: 2},
+		End:     token.Position{File: "demo.toy", Line: 1, Column: 4, Offset: 3},
+	}
+
+	expected := `error[TypeError]: type mismatch: INTEGER + STRING
+ --> demo.toy:1:3
+  |
+1 | 1 + "s"
+  |   ^
+`
+
+	renderer := NewRenderer(false)
+	renderer.AddSource("demo.toy", "1 + \"s\"\n")
+
+	var out bytes.Buffer
+	renderer.Render(&out, FromError(err))
+
+	if out.String() != expected {
+		t.Errorf("expected\n%s\nactual\n%s", expected, out.String())
+	}
+}
+
+func TestRenderWithoutSource(t *testing.T) {
+	d := Diagnostic{
+		Severity: Error,
+		Span:     Span{Start: token.Position{File: "missing.toy", Line: 3, Column: 1}},
+		Message:  "something wrong",
+	}
+
+	expected := "error: something wrong\n --> missing.toy:3:1\n"
+
+	var out bytes.Buffer
+	NewRenderer(false).Render(&out, d)
+
+	if out.String() != expected {
+		t.Errorf("expected %q, actual %q", expected, out.String())
+	}
+}
+
+func TestRenderColor(t *testing.T) {
+	d := Diagnostic{Severity: Error, Message: "boom"}
+
+	var out bytes.Buffer
+	NewRenderer(true).Render(&out, d)
+
+	expected := colorRed + "error" + colorReset + ": " + colorBold + "boom" + colorReset + "\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, actual %q", expected, out.String())
+	}
+}
+
+func TestRenderTrace(t *testing.T) {
+	d := Diagnostic{
+		Severity: Error,
+		Message:  "boom",
+		Trace: []Frame{
+			{Function: "inner", Pos: token.Position{File: "demo.toy", Line: 2, Column: 5}},
+			{Function: "outer", Pos: token.Position{File: "demo.toy", Line: 4, Column: 6}},
+		},
+	}
+
+	expected := `error: boom
+stack trace:
+  at inner (demo.toy:2:5)
+  at outer (demo.toy:4:6)
+`
+
+	var out bytes.Buffer
+	NewRenderer(false).Render(&out, d)
+
+	if out.String() != expected {
+		t.Errorf("expected\n%s\nactual\n%s", expected, out.String())
+	}
+}
+
+func TestRenderDeepTrace(t *testing.T) {
+	d := Diagnostic{Severity: Error, Message: "boom"}
+	for i := 1; i <= 10000; i++ {
+		d.Trace = append(d.Trace, Frame{Function: "f", Pos: token.Position{File: "demo.toy", Line: i, Column: 1}})
+	}
+
+	var out bytes.Buffer
+	NewRenderer(false).Render(&out, d)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2+2*traceEdge+1 {
+		t.Fatalf("expected %d lines, actual %d:\n%s", 2+2*traceEdge+1, len(lines), out.String())
+	}
+	expected := []string{"  at f (demo.toy:10:1)", "  ... 9980 more frames ...", "  at f (demo.toy:9991:1)"}
+	for i, line := range expected {
+		if lines[2+traceEdge-1+i] != line {
+			t.Errorf("expected %q, actual %q", line, lines[2+traceEdge-1+i])
+		}
+	}
+}
+
+func TestRenderWideCharacters(t *testing.T) {
+	source := `let 名字 = "你好" + 1;`
+
+	d := Diagnostic{
+		Severity: Error,
+		Span: Span{
+			Start: token.Position{Line: 1, Column: 15, Offset: 22},
+			End:   token.Position{Line: 1, Column: 16, Offset: 23},
+		},
+		Message: "type mismatch: STRING + INTEGER",
+	}
+
+	// 每个汉字占两列，所以 "+" 前面有 18 列
+	expected := `error: type mismatch: STRING + INTEGER
+ --> 1:15
+  |
+1 | let 名字 = "你好" + 1;
+  | ` + strings.Repeat(" ", 18) + "^\n"
+
+	renderer := NewRenderer(false)
+	renderer.AddSource("", source)
+
+	var out bytes.Buffer
+	renderer.Render(&out, d)
+
+	if out.String() != expected {
+		t.Errorf("expected\n%s\nactual\n%s", expected, out.String())
+	}
+}
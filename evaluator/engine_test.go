@@ -0,0 +1,33 @@
+package evaluator_test
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/executor"
+	"interpreter/object"
+	"os"
+	"testing"
+)
+
+// 先用树遍历求值器运行所有的测试，然后依次换成其他执行引擎再运行一遍
+func TestMain(m *testing.M) {
+	if code := m.Run(); code != 0 {
+		os.Exit(code)
+	}
+
+	for _, name := range []string{"vm", "closure"} {
+		name := name
+		fmt.Println("--- engine: " + name)
+		evaluator.SetTestRun(func(program *ast.Program, runtime *object.Runtime) object.Object {
+			engine, err := executor.NewEngine(name, runtime)
+			if err != nil {
+				panic(err)
+			}
+			return engine.Run(program)
+		})
+		if code := m.Run(); code != 0 {
+			os.Exit(code)
+		}
+	}
+}
@@ -3,75 +3,139 @@
 package evaluator
 
 import (
-	"fmt"
 	"interpreter/ast"
+	"interpreter/core"
 	"interpreter/object"
+	"strings"
 )
 
-var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
-)
-
+// 对节点求值。在当前节点产生的错误（比如运算符、索引、函数调用的错误）使用 core.Located 填入当前节点的位置，
+// 子节点传递过来的错误已经有位置信息，因此记录下来的是最内层（即出错的）节点的位置
 func Eval(n ast.Node, env *object.Environment) object.Object {
 	switch node := n.(type) {
 
 	// 对语句求值
 	case *ast.Program:
-		return evalProgram(node, env)
+		return core.Located(node, evalProgram(node, env))
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		// 每一个语句块都有自己的作用域，语句块里声明的标识符在语句块之外不可见
+		return evalBlockStatement(node, enclosedEnvironment(env, node.Slots))
 
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if core.IsError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val} // 包裹待返回的 Object
 
+	case *ast.WhileStatement:
+		return core.Located(node, evalWhileStatement(node, env))
+
+	case *ast.ForStatement:
+		return core.Located(node, evalForStatement(node, env))
+
+	case *ast.BreakStatement:
+		return core.BREAK
+
+	case *ast.ContinueStatement:
+		return core.CONTINUE
+
+	case *ast.ThrowStatement:
+		value := Eval(node.Value, env)
+		if core.IsError(value) {
+			return value
+		}
+		return core.Located(node, core.ThrowValue(value))
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if core.IsAbrupt(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if err := destructure(node.Name, val, env, node.Constant); err != nil {
+			return core.Located(node, err)
+		}
+
+	case *ast.ImportStatement:
+		return core.Located(node, evalImportStatement(node, env))
+
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
 
 	// 对表达式求值
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if core.IsError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return core.Located(node, core.CheckOverflow(core.PrefixOperation(node.Operator, right), env.Runtime().Strict))
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return core.Located(node, evalLogicalExpression(node, env))
+		}
+
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if core.IsError(left) {
 			return left
 		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if core.IsError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return core.Located(node, core.CheckOverflow(core.InfixOperation(node.Operator, left, right), env.Runtime().Strict))
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return core.Located(node, evalIfExpression(node, env))
+
+	case *ast.MatchExpression:
+		return core.Located(node, evalMatchExpression(node, env))
+
+	case *ast.TryExpression:
+		return core.Located(node, evalTryExpression(node, env))
+
+	case *ast.AssignExpression:
+		return core.Located(node, evalAssignExpression(node, env))
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{
+			Parameters: params,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Body:       body,
+			Env:        env,
+			Name:       node.Name,
+			Pos:        node.Pos(),
+			End:        node.End(),
+		}
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
+		// 方法调用 obj.method(args)：先对 obj 求值，然后以 self 的名义传给被调用的函数
+		var self object.Object
+		var function object.Object
+		if member, ok := node.Function.(*ast.MemberExpression); ok {
+			self = Eval(member.Object, env)
+			if core.IsError(self) {
+				return self
+			}
+			function = core.Member(self, member.Property.Value)
+
+			// 模块的成员函数 m.fn(args) 只是普通的函数调用
+			if _, ok := self.(*object.Module); ok {
+				self = nil
+			}
+		} else {
+			function = Eval(node.Function, env)
+		}
+
+		if core.IsError(function) {
+			return core.Located(node, function)
 		}
 
 		// 先对每个实参求值
@@ -85,25 +149,50 @@ func Eval(n ast.Node, env *object.Environment) object.Object {
 
 		// 在上一步骤，如果有其中一个参数求值出错，则返回
 		// 单一个元素的 []object.Object，所以不需要逐个参数值检查
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && core.IsError(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		// 尾调用交给所在函数的调用者执行，见 applyFunction
+		if node.Tail {
+			return &object.TailCall{Function: function, Arguments: args, Self: self, Call: node}
+		}
+
+		result := applyFunction(function, args, self)
+
+		// 错误从函数里向外传递时，逐层记录调用的位置，从而得到出错时的调用栈
+		if err, ok := result.(*object.Error); ok {
+			err.Trace = append(err.Trace, object.StackFrame{
+				Function: core.FunctionName(node, function),
+				Pos:      node.Pos(),
+			})
+		}
+
+		// 内置函数的结果，包括在尾部位置调用的内置函数
+		return core.Located(node, core.CheckOverflow(result, env.Runtime().Strict))
 
 	// 对索引表达式求值
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if core.IsError(left) {
 			return left
 		}
 
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if core.IsError(index) {
 			return index
 		}
 
-		return evalIndexExpression(left, index)
+		return core.Located(node, core.Index(left, index))
+
+	// 对成员访问表达式求值
+	case *ast.MemberExpression:
+		obj := Eval(node.Object, env)
+		if core.IsError(obj) {
+			return obj
+		}
+
+		return core.Located(node, core.Member(obj, node.Property.Value))
 
 	// 对标识符求值
 	case *ast.Identifier:
@@ -116,14 +205,23 @@ func Eval(n ast.Node, env *object.Environment) object.Object {
 
 	// 对字面量求值
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return core.Located(node, core.CheckOverflow(object.NewBigInteger(node.Big), env.Runtime().Strict))
+		}
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
-		return nativeBoolToBooleanObject(node.Value)
+		return core.NativeBoolToBooleanObject(node.Value)
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.InterpolatedString:
+		return core.Located(node, evalInterpolatedString(node, env))
+
 	case *ast.ArrayLiteral:
 		// objs := []object.Object{}
 		// for _, element := range n.Elements {
@@ -134,7 +232,7 @@ func Eval(n ast.Node, env *object.Environment) object.Object {
 		// 	objs = append(objs, obj)
 		// }
 		objs := evalExpressions(node.Elements, env)
-		if len(objs) == 1 && isError(objs[0]) {
+		if len(objs) == 1 && core.IsError(objs[0]) {
 			return objs[0]
 		}
 
@@ -143,88 +241,105 @@ func Eval(n ast.Node, env *object.Environment) object.Object {
 		}
 
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return core.Located(node, evalHashLiteral(node, env))
 	}
 
 	return nil
 }
 
-func evalIndexExpression(left object.Object, index object.Object) object.Object {
-	// 	array, ok := left.(*object.Array)
-	// 	if !ok {
-	// 		return newError("expected Array")
-	// 	}
-	//
-	// 	i, ok := index.(*object.Integer)
-	// 	if !ok {
-	// 		return newError("expected Integer")
-	// 	}
-	//
-	// 	if i.Value < 0 || i.Value >= int64(len(array.Elements)) {
-	// 		//return newError("out of index")
-	// 		return NULL
-	// 	}
-	// 	fmt.Printf("\nIDX: %+v\n", array.Elements[i.Value])
-	// 	return array.Elements[i.Value]
-
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
-	default:
-		return newError("index operator not supported: %s", left.Type())
+// 按照解析的结果（见 Resolve）获取标识符的值
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	// 方法调用的接收者 self 位于函数的环境里，它会遮蔽更外层声明的 self
+	if node.Value == "self" {
+		depth := -1
+		if node.Resolution == ast.Local {
+			depth = node.Depth
+		}
+		if receiver, ok := env.Receiver(depth); ok {
+			return receiver
+		}
 	}
-}
 
-func evalArrayIndexExpression(array object.Object, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
-	if idx < 0 || idx > max {
-		// out of index
-		return NULL // 索引超出范围时，返回 NULL
+	if node.Resolution == ast.Builtin {
+		return core.BuiltinAt(node.Index)
 	}
-	return arrayObject.Elements[idx]
-}
-
-func evalHashIndexExpression(hash object.Object, key object.Object) object.Object {
-	hashObject := hash.(*object.Hash)
 
-	hashable, ok := key.(object.Hashable)
-	if !ok {
-		return newError("unsupported type for hash key: %s", key.Type())
+	if val, ok := lookupVariable(node, env); ok {
+		return val
 	}
 
-	pair, ok := hashObject.Pairs[hashable.HashKey()]
-	if !ok {
-		return NULL // 不存在指定的 key 时，返回 NULL
+	if node.Resolution != ast.Local {
+		if builtin, ok := core.Builtins[node.Value]; ok {
+			return builtin
+		}
 	}
 
-	return pair.Value
+	return core.NewErrorAt(node, object.NAME_ERROR, "identifier not found: %s", node.Value)
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(node.Value); ok {
-		return val
+// 获取变量的值（不包括内置函数）
+func lookupVariable(node *ast.Identifier, env *object.Environment) (object.Object, bool) {
+	switch node.Resolution {
+	case ast.Local:
+		return env.GetAt(node.Depth, node.Index)
+	case ast.Global, ast.Builtin:
+		return env.Global().Get(node.Value)
+	default:
+		return env.Get(node.Value)
 	}
+}
 
-	if builtin, ok := builtins[node.Value]; ok {
-		return builtin
+// 在当前环境里声明标识符，如果已经声明过则返回 false
+func declareVariable(node *ast.Identifier, value object.Object, env *object.Environment, constant bool) bool {
+	if node.Resolution == ast.Local {
+		return env.DeclareAt(node.Index, value)
 	}
+	return env.Declare(node.Value, value, constant)
+}
 
-	return newError("identifier not found: " + node.Value)
+// 更新变量的值，如果变量尚未声明则返回 false
+func assignVariable(node *ast.Identifier, value object.Object, env *object.Environment) bool {
+	switch node.Resolution {
+	case ast.Local:
+		return env.AssignAt(node.Depth, node.Index, value)
+	case ast.Global, ast.Builtin:
+		return env.Global().Assign(node.Value, value)
+	default:
+		return env.Assign(node.Value, value)
+	}
 }
 
-func nativeBoolToBooleanObject(input bool) *object.Boolean {
-	if input {
-		return TRUE
-	} else {
-		return FALSE
+// 判断变量是否常量
+func isConstant(node *ast.Identifier, env *object.Environment) bool {
+	switch node.Resolution {
+	case ast.Local:
+		return node.Constant
+	case ast.Global, ast.Builtin:
+		return env.Global().IsConstant(node.Value)
+	default:
+		return env.IsConstant(node.Value)
 	}
 }
 
+// 创建语句块（以及 catch 语句块和 match 分支）的环境，slots 为解析时分配的槽位数量，
+// 没有声明任何标识符的语句块直接使用外层的环境
+func enclosedEnvironment(env *object.Environment, slots int) *object.Environment {
+	if slots == 0 {
+		return env
+	}
+	return object.NewSlotEnvironment(env, slots)
+}
+
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	// 在执行之前解析所有的标识符（调用者已经解析过的程序不再重复解析，见 executor.SafeRun）。
+	// 引用了不存在的标识符的错误在这里忽略，求值时执行到该标识符才报告
+	if !program.Resolved {
+		core.Resolve(program, func(name string) bool {
+			_, ok := env.Get(name)
+			return ok
+		})
+	}
+
 	// evalProgram 跟 evalBlockStatement 很相似，但 BlockStatement 可以嵌套，当遇到
 	// return 语句时，需要跳到最外一层 block，所以无法重用 evalBlockStatement
 	var result object.Object
@@ -267,6 +382,11 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 			if result.Type() == object.ERROR_OBJ {
 				return result // 跳过剩余的语句
 			}
+
+			// break 和 continue 也跟 return 一样向外传递，直到所在的循环
+			if result.Type() == object.BREAK_OBJ || result.Type() == object.CONTINUE_OBJ {
+				return result // 跳过剩余的语句
+			}
 		}
 	}
 
@@ -274,183 +394,283 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
-	switch operator {
-	case "!":
-		return evalBangOperatorExpression(right)
-	case "+":
-		return evalPlusPrefixOperatorExpression(right)
-	case "-":
-		return evalMinusPrefixOperatorExpression(right)
-	default:
-		// return NULL
-		return newError("unknown operator: %s%s", operator, right.Type())
+// 逻辑运算 && 和 ||，操作数按照 core.IsTruthy 的规则（只有 false 和 null 视为假）判断真假。
+// 运算是短路的：当左操作数已经能决定结果时，不再对右操作数求值。
+// 运算结果总是布尔值，而不是操作数本身，比如 1 && "a" 的结果是 true
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if core.IsError(left) {
+		return left
 	}
-}
 
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE // 所有非 false, null 的值都视为 true
+	leftValue := core.IsTruthy(left)
+	if node.Operator == "&&" && !leftValue {
+		return core.FALSE
+	}
+	if node.Operator == "||" && leftValue {
+		return core.TRUE
 	}
-}
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		// return NULL
-		return newError("unknown operator: -%s", right.Type())
+	right := Eval(node.Right, env)
+	if core.IsError(right) {
+		return right
 	}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return core.NativeBoolToBooleanObject(core.IsTruthy(right))
 }
 
-func evalPlusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		// return NULL
-		return newError("unknown operator: +%s", right.Type())
+// 插值字符串，插值表达式的值按照 Inspect() 的格式转换为字符串
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		value := Eval(part, env)
+		if core.IsError(value) {
+			return value
+		}
+		out.WriteString(value.Inspect())
 	}
 
-	return right
+	return &object.String{Value: out.String()}
 }
 
-func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	switch {
-	case left.Type() == object.INTEGER_OBJ &&
-		right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if core.IsError(condition) {
+			return condition
+		}
 
-	case left.Type() == object.STRING_OBJ &&
-		right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
+		if !core.IsTruthy(condition) {
+			return core.NULL
+		}
 
-	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
 
-	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+// for-in 循环，每一次迭代都在新的环境里绑定循环变量，
+// 因此在循环体里创建的闭包捕获的是当次迭代的值
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if core.IsError(iterable) {
+		return iterable
+	}
 
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	var result object.Object = core.NULL
+	err := iterate(iterable, func(value object.Object) bool {
+		loopEnv := object.NewSlotEnvironment(env, 1)
+		declareVariable(node.Variable, value, loopEnv, false)
+
+		var done bool
+		result, done = evalLoopBody(node.Body, loopEnv)
+		return !done
+	})
+	if err != nil {
+		return err
+	}
 
-	case operator == "&&":
-		return nativeBoolToBooleanObject(
-			left.(*object.Boolean).Value &&
-				right.(*object.Boolean).Value)
+	return result
+}
 
-	case operator == "||":
-		return nativeBoolToBooleanObject(
-			left.(*object.Boolean).Value ||
-				right.(*object.Boolean).Value)
+// 执行一次循环体，如果需要结束循环（遇到 break、return 或者错误），则 done 为 true，
+// 此时 result 为整个循环语句的值
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (result object.Object, done bool) {
+	evaluated := Eval(body, env)
 
+	switch evaluated.(type) {
+	case *object.ReturnValue, *object.Error:
+		return evaluated, true // 继续向外传递
+	case *object.Break:
+		return core.NULL, true
 	default:
-		// return NULL
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return core.NULL, false // 包括 continue
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
-	switch operator {
-	case "+":
-		return &object.Integer{Value: leftValue + rightValue}
-	case "-":
-		return &object.Integer{Value: leftValue - rightValue}
-	case "*":
-		return &object.Integer{Value: leftValue * rightValue}
-	case "/":
-		return &object.Integer{Value: leftValue / rightValue}
-
-	case "<":
-		return nativeBoolToBooleanObject(leftValue < rightValue)
-	case ">":
-		return nativeBoolToBooleanObject(leftValue > rightValue)
-	case "==":
-		return nativeBoolToBooleanObject(leftValue == rightValue)
-	case "!=":
-		return nativeBoolToBooleanObject(leftValue != rightValue)
+// 依次以 iterable 的每一个元素调用 fn，直到 fn 返回 false，迭代的规则见 core.NewIterator
+func iterate(iterable object.Object, fn func(object.Object) bool) *object.Error {
+	it, err := core.NewIterator(iterable)
+	if err != nil {
+		return err
+	}
 
-	default:
-		// return NULL
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	for value, ok := it.Next(); ok && fn(value); value, ok = it.Next() {
 	}
+	return nil
 }
 
-func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftValue := left.(*object.String).Value
-	rightValue := right.(*object.String).Value
+// 赋值表达式，赋值的目标可以是：
+//
+//   - 标识符：更新最近一层环境里已经定义的标识符
+//   - 索引表达式 arr[i]、h[key]：修改数组的元素或者映射表的键值对
+//   - 成员访问表达式 h.key：修改映射表的键值对
+//
+// 数组和映射表是引用类型，绑定到多个标识符的同一个数组（或映射表）被修改时，
+// 通过所有标识符都能看到修改后的值。
+// 复合赋值 "x += 1" 等同于 "x = x + 1"，但目标里的子表达式（比如 arr[f()] 里的 f()）只求值一次
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		value := evalAssignedValue(node, env, func() object.Object {
+			current, ok := lookupVariable(target, env)
+			if !ok {
+				return core.NewError(object.NAME_ERROR, "identifier not found: %s", target.Value)
+			}
+			return current
+		})
+		if core.IsAbrupt(value) {
+			return value
+		}
+
+		if isConstant(target, env) {
+			return core.NewError(object.NAME_ERROR, "cannot assign to constant: %s", target.Value)
+		}
+		if !assignVariable(target, value, env) {
+			return core.NewError(object.NAME_ERROR, "cannot assign to undefined variable: %s", target.Value)
+		}
+		return value
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if core.IsError(left) {
+			return left
+		}
+
+		index := Eval(target.Index, env)
+		if core.IsError(index) {
+			return index
+		}
+
+		value := evalAssignedValue(node, env, func() object.Object {
+			return core.Index(left, index)
+		})
+		if core.IsAbrupt(value) {
+			return value
+		}
+		return core.AssignIndex(left, index, value)
+
+	case *ast.MemberExpression:
+		obj := Eval(target.Object, env)
+		if core.IsError(obj) {
+			return obj
+		}
 
-	switch operator {
-	case "+":
-		return &object.String{Value: leftValue + rightValue}
+		name := target.Property.Value
+		if _, ok := obj.(*object.Hash); !ok {
+			return core.NewError(object.TYPE_ERROR, "member assignment not supported: %s.%s", obj.Type(), name)
+		}
 
-	case "<":
-		return nativeBoolToBooleanObject(leftValue < rightValue)
-	case ">":
-		return nativeBoolToBooleanObject(leftValue > rightValue)
-	case "==":
-		return nativeBoolToBooleanObject(leftValue == rightValue)
-	case "!=":
-		return nativeBoolToBooleanObject(leftValue != rightValue)
+		value := evalAssignedValue(node, env, func() object.Object {
+			return core.Member(obj, name)
+		})
+		if core.IsAbrupt(value) {
+			return value
+		}
+		return core.AssignIndex(obj, &object.String{Value: name}, value)
 
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return core.NewError(object.TYPE_ERROR, "invalid assignment target: %s", node.Target.String())
 	}
 }
 
+// 计算赋值表达式右侧的值，对于复合赋值，current 用于获取目标的当前值
+func evalAssignedValue(node *ast.AssignExpression, env *object.Environment, current func() object.Object) object.Object {
+	value := Eval(node.Value, env)
+	if core.IsAbrupt(value) || node.Operator == "=" {
+		return value
+	}
+
+	left := current()
+	if core.IsError(left) {
+		return left
+	}
+
+	operator := strings.TrimSuffix(node.Operator, "=")
+	return core.CheckOverflow(core.InfixOperation(operator, left, value), env.Runtime().Strict)
+}
+
 func evalIfExpression(expression *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(expression.Condition, env)
 
-	if isError(condition) {
+	if core.IsError(condition) {
 		return condition
 	}
 
-	if isTruthy(condition) {
+	if core.IsTruthy(condition) {
 		return Eval(expression.Consequence, env)
 	} else if expression.Alternative != nil {
 		return Eval(expression.Alternative, env)
 	} else {
 		// Alternative 被选中但它不存在的情况，返回 NULL
-		return NULL
+		return core.NULL
 	}
 }
 
-// NULL 和 FALSE 视为 false，其他视为 true
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case FALSE:
-		return false
-	case TRUE:
-		return true
-	default:
-		return true
+// 执行 try 语句块，如果发生错误，则把错误转换为映射表（见 core.ErrorValue）绑定到 catch 的参数，
+// 然后执行 catch 语句块。无论是否发生错误，最后都会执行 finally 语句块。
+//
+// finally 语句块的值会被丢弃，除非它产生了错误、return、break 或者 continue，
+// 此时它们会取代 try 或者 catch 语句块的结果。
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(node.Block, env)
+
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := enclosedEnvironment(env, node.Catch.Slots)
+		if node.Parameter != nil {
+			if bindErr := destructure(node.Parameter, core.ErrorValue(err), catchEnv, false); bindErr != nil {
+				return bindErr
+			}
+		}
+		// catch 语句块跟参数共用同一个作用域，即不能在 catch 语句块里重新声明参数
+		result = evalBlockStatement(node.Catch, catchEnv)
 	}
-}
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	if node.Finally != nil {
+		switch finally := Eval(node.Finally, env).(type) {
+		case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+			return finally
+		}
+	}
+
+	if result == nil {
+		return core.NULL // 语句块为空，或者最后一条语句是 let 语句
+	}
+	return result
 }
 
-// 用在 "调用 Eval(...) 之后还需进一步执行其他运算" 的场合，用于提早返回
-// 比如在调用 evalInfixExpression 之前需要先对 left node 和 right node
-// 求值，如果任意一个返回 Error，都应该提前返回 Error，而不是继续执行 evalInfixExpression
-func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
-	} else {
-		return false
+// 依次尝试各个分支的模式，执行第一个匹配的分支，没有分支匹配时返回 NULL
+//
+// 每个分支使用独立的环境，模式绑定的变量只在该分支的 body 里可见
+func evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(node.Subject, env)
+	if core.IsError(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		armEnv := enclosedEnvironment(env, arm.Slots)
+		if destructure(arm.Pattern, subject, armEnv, false) == nil {
+			return Eval(arm.Body, armEnv)
+		}
 	}
+
+	return core.NULL
+}
+
+// 按照模式 pattern 解构 value，并在 env 里声明模式里的变量（constant 表示声明为常量），
+// 值跟模式不匹配（比如数组长度不同、映射表缺少 key）或者重复声明时返回位于对应模式的错误
+//
+// 解构失败时 env 里可能残留部分绑定，对于 match 表达式，每个分支都使用新的环境
+func destructure(pattern ast.Pattern, value object.Object, env *object.Environment, constant bool) *object.Error {
+	return core.MatchPattern(pattern, value, func(name *ast.Identifier, value object.Object) *object.Error {
+		if !declareVariable(name, value, env, constant) {
+			return core.NewErrorAt(name, object.NAME_ERROR, "identifier %s has already been declared", name.Value)
+		}
+		return nil
+	})
 }
 
 // 返回切片 []object.Object，如果其中一个表达式有错误，则返回
@@ -463,7 +683,7 @@ func evalExpressions(
 
 	for _, e := range expressions {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if core.IsError(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -472,7 +692,17 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// 调用函数，对于方法调用 obj.method(args)，self 为 obj，否则为 nil
+//
+// 如果函数返回的是尾调用（见 object.TailCall），则在这里循环地执行，直到得到最终的结果（见 core.RunTailCalls），
+// 因此尾递归（包括互相调用的函数）不会增加 Go 的调用栈的深度。
+// 发生错误时仍然为每一层尾调用补上调用栈，跟没有这项优化时一样
+func applyFunction(fn object.Object, args []object.Object, self object.Object) object.Object {
+	return core.RunTailCalls(callFunction(fn, args, self), callFunction)
+}
+
+// 调用一次函数，返回函数的结果，或者函数在尾部位置的调用
+func callFunction(fn object.Object, args []object.Object, self object.Object) object.Object {
 	// function, ok := fn.(*object.Function)
 	// if !ok {
 	// 	return newError("not a function: %s", fn.Type())
@@ -480,29 +710,84 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 
 	switch f := fn.(type) {
 	case *object.Function:
-		// 为函数的求值创造一个新的环境，该环境的上层环境为 "函数定义时" 的环境
-		// 即静态范围(static scope)
-		extendedEnv := extendFunctionEnv(f, args)
-		evaluated := Eval(f.Body, extendedEnv)
-		return unwrapReturnValue(evaluated) // 拆封 ReturnValue，避免一直往上传递
+		var evaluated object.Object
+		runtime := f.Env.Runtime()
+		if err := core.CheckArity(f, len(args)); err != nil {
+			evaluated = err
+		} else if err := core.EnterCall(runtime); err != nil {
+			return err
+		} else {
+			// 为函数的求值创造一个新的环境，该环境的上层环境为 "函数定义时" 的环境
+			// 即静态范围(static scope)
+			extendedEnv, err := extendFunctionEnv(f, args, self)
+			if err != nil {
+				evaluated = err
+			} else {
+				// 函数体跟形参共用同一个作用域，即函数体里不能重新声明形参
+				evaluated = evalBlockStatement(f.Body, extendedEnv)
+			}
+			core.LeaveCall(runtime)
+		}
+
+		if err, ok := evaluated.(*object.Error); ok {
+			core.DefinedHere(err, f)
+		}
+
+		result := unwrapReturnValue(evaluated) // 拆封 ReturnValue，避免一直往上传递
+		if result == nil {
+			return core.NULL // 函数体为空，或者最后一条语句是 let 语句
+		}
+		return result
 
 	case *object.Builtin:
 		return f.Fn(args...)
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return core.NewError(object.TYPE_ERROR, "not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+// 创建函数的执行环境，用实参填充形参。
+// 没有对应实参的形参使用默认值，默认值在新环境里求值，因此可以引用前面的参数。
+// 对于方法调用，self 绑定到方法所属的对象（同名的形参会遮蔽 self）
+func extendFunctionEnv(fn *object.Function, args []object.Object, self object.Object) (*object.Environment, *object.Error) {
+	env := object.NewSlotEnvironment(fn.Env, fn.Body.Slots)
+	if self != nil {
+		env.SetReceiver(self)
+	}
 
 	// 用实参填充每一个形参
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		var value object.Object
+		if paramIdx < len(args) {
+			value = args[paramIdx]
+		} else {
+			value = Eval(fn.Defaults[paramIdx], env)
+			if err, ok := value.(*object.Error); ok {
+				return nil, err
+			}
+		}
+
+		if err := destructure(param, value, env, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// 多出来的实参收集到剩余参数里
+	if fn.Rest != nil {
+		elements := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			elements = append(elements, args[len(fn.Parameters):]...)
+		}
+		rest := &object.Array{Elements: elements}
+		if fn.Rest.Resolution == ast.Local {
+			env.SetAt(fn.Rest.Index, rest)
+		} else {
+			env.Set(fn.Rest.Value, rest)
+		}
 	}
 
-	return env
+	return env, nil
 }
 
 // 拆封函数里 return 语句所包装的值（即 object.Return）给函数调用者
@@ -521,22 +806,21 @@ func evalHashLiteral(
 
 	for keyNode, valueNode := range node.Pairs {
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if core.IsError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unsupported type for hash key: %s", key.Type())
+		hashKey, err := core.HashKey(key)
+		if err != nil {
+			return err
 		}
 
 		value := Eval(valueNode, env)
-		if isError(value) {
+		if core.IsError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		pairs[hashKey] = object.HashPair{Key: key, Value: value}
 	}
 	return &object.Hash{Pairs: pairs}
 }
@@ -3,9 +3,15 @@
 package evaluator
 
 import (
+	"interpreter/ast"
+	"interpreter/core"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -35,6 +41,13 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+
+		// 取余，结果的符号跟被除数相同
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 * 5 % 3", 1},
+		{"(-9223372036854775807 - 1) % -1", 0},
 	}
 
 	for _, test := range tests {
@@ -44,13 +57,27 @@ func TestEvalIntegerExpression(t *testing.T) {
 }
 
 func testEval(input string) object.Object {
+	return testEvalWithRuntime(input, object.NewRuntime())
+}
+
+// 使用指定的运行配置执行测试程序
+func testEvalWithRuntime(input string, runtime *object.Runtime) object.Object {
+	program := testParse(input) // program is AST
+
+	return testRun(program, runtime)
+}
+
+// 执行测试程序的方式，默认使用树遍历求值器。
+// engine_test.go 会换成其他执行引擎再运行一遍所有的测试，以保证各个执行引擎的行为一致
+var testRun = func(program *ast.Program, runtime *object.Runtime) object.Object {
+	return Eval(program, object.NewEnvironmentWithRuntime(runtime))
+}
+
+func testParse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
 
-	program := p.ParseProgram() // program is AST
-	env := object.NewEnvironment()
-
-	return Eval(program, env)
+	return p.ParseProgram()
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -68,6 +95,173 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		big      bool // 结果是否使用大整数表示
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", true},
+		{"-9223372036854775807 - 2", "-9223372036854775809", true},
+		{"9223372036854775807 * 2", "18446744073709551614", true},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808", true},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808", true},
+		{"100000000000000000000 / 3", "33333333333333333333", true},
+		{"-100000000000000000000 / 3", "-33333333333333333333", true},
+		{"99999999999999999999", "99999999999999999999", true},
+
+		// 结果回到 int64 范围之内
+		{"9223372036854775808 - 1", "9223372036854775807", false},
+		{"100000000000000000000 / 100000000000000000000", "1", false},
+		{"let a = 9223372036854775807 + 10; a - a", "0", false},
+
+		{
+			"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25)",
+			"15511210043330985984000000", true,
+		},
+		{`int(1e19)`, "10000000000000000000", true},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890", true},
+		{`"${2 * 9223372036854775807}"`, "18446744073709551614", false},
+		{"100000000000000000000 % 7", "2", false},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%q: expected %s, actual %s", test.input, test.expected, evaluated.Inspect())
+			continue
+		}
+
+		if integer, ok := evaluated.(*object.Integer); ok && (integer.Big != nil) != test.big {
+			t.Errorf("%q: expected big representation %t, actual %t",
+				test.input, test.big, integer.Big != nil)
+		}
+	}
+}
+
+func TestStrictArithmetic(t *testing.T) {
+	runtime := object.NewRuntime()
+	runtime.Strict = true
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 1", -9223372036854775808},
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775808 is out of the range of 64-bit integers"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775809 is out of the range of 64-bit integers"},
+		{"4611686018427387904 * 2", "integer overflow: 9223372036854775808 is out of the range of 64-bit integers"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: 9223372036854775808 is out of the range of 64-bit integers"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: 9223372036854775808 is out of the range of 64-bit integers"},
+		{"99999999999999999999", "integer overflow: 99999999999999999999 is out of the range of 64-bit integers"},
+		{"int(1e19)", "integer overflow: 10000000000000000000 is out of the range of 64-bit integers"},
+		{"let f = fn() { int(1e19) }; f()", "integer overflow: 10000000000000000000 is out of the range of 64-bit integers"},
+		{"let x = 9223372036854775807; x += 1", "integer overflow: 9223372036854775808 is out of the range of 64-bit integers"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEvalWithRuntime(test.input, runtime)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: expected Error, actual %T %+v", test.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestBigIntegerComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"99999999999999999999 > 1", true},
+		{"99999999999999999999 < -99999999999999999999", false},
+		{"99999999999999999999 == 99999999999999999998 + 1", true},
+		{"9223372036854775808 - 1 == 9223372036854775807", true},
+		{"99999999999999999999 != 1", true},
+		{"100000000000000000000 == 1e20", true},
+		{"99999999999999999999 < 1e21", true},
+		{`{99999999999999999999: true}[99999999999999999998 + 1]`, true},
+		{`{1e20: true}[100000000000000000000]`, true},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		testBooleanObject(t, evaluated, test.expected)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e3", 1000},
+		{"2.5e-3", 0.0025},
+		{"-1.5", -1.5},
+		{"+1.5", 1.5},
+		{"0.1 + 0.2 * 2", 0.5},
+		{"7.0 / 2", 3.5},
+		{"1 + 0.5", 1.5},
+		{"3 * 1.5", 4.5},
+		{"1 / 4.0", 0.25},
+		{"(1 + 2) / 2.0", 1.5},
+		{"7.5 % 2", 1.5},
+		{"-7.5 % 2", -1.5},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		testFloatObject(t, evaluated, test.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("expected Float, actual %T, %+v", obj, obj)
+		return false
+	}
+
+	if math.Abs(result.Value-expected) > 1e-9 {
+		t.Errorf("expected %g, actual %g", expected, result.Value)
+		return false
+	}
+
+	return true
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5", "1.5"},
+		{"3.0", "3.0"},
+		{"1.0 * 2", "2.0"},
+		{"1e21", "1e+21"},
+		{"-0.25", "-0.25"},
+		{`float("inf")`, "+Inf"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -85,6 +279,26 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 == 2", false},
 		{"1 != 2", true},
 
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{`float("nan") == float("nan")`, false},
+		{`float("nan") != 1`, true},
+		{`1 < float("nan")`, false},
+		// 整数跟浮点数按照精确值比较，结果跟映射表的 key 一致
+		{"9007199254740993 == 9007199254740992.0", false},
+		{"9007199254740993 > 9007199254740992.0", true},
+		{"9007199254740992 == 9007199254740992.0", true},
+		{"9223372036854775807 == 9223372036854775807.0", false},
+		{"9223372036854775807 < 9223372036854775807.0", true},
+		{"100000000000000000000 == 1e20", true},
+		{`!{9007199254740993: 1}[9007199254740992.0]`, true},
+		{`{9007199254740992: 1}[9007199254740992.0] == 1`, true},
+		{`1 < float("inf")`, true},
+		{`-100000000000000000000 > float("-inf")`, true},
+
 		{"true == true", true},
 		{"false == false", true},
 		{"true == false", false},
@@ -102,6 +316,22 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"true || true", true},
 		{"true || false", true},
 		{"false || false", false},
+
+		// 非布尔值的操作数按照 IsTruthy 判断真假，结果总是布尔值
+		{"true && 1", true},
+		{"1 && 0", true},
+		{`"" || false`, true},
+		{"[] && {}", true},
+		{`if (false) { 1 } && true`, false},
+		{`let f = fn() {}; f() || false`, false},
+		{`let f = fn() { let a = 1; }; f() && true`, false},
+		{"!(1 && false)", true},
+		{"1 < 2 && 2 < 3 || false", true},
+
+		// 短路求值：右操作数不会被求值，因此不会报告错误
+		{"false && undefinedName", false},
+		{"true || 1 / 0", true},
+		{"let x = if (false) { 1 }; x && x > 0", false},
 	}
 
 	for _, test := range tests {
@@ -155,6 +385,10 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+		{"if (1 < 2) { 10 } else if (1 / 0) { 20 }", 10},
 	}
 	for _, test := range tests {
 		evaluated := testEval(test.input)
@@ -168,7 +402,7 @@ func TestIfElseExpressions(t *testing.T) {
 }
 
 func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
+	if obj != core.NULL {
 		t.Errorf("expected NULL, actual %T, %+v", obj, obj)
 		return false
 	}
@@ -258,6 +492,78 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unsupported type for hash key: FUNCTION",
 		},
+		{
+			`{float("nan"): 1}`,
+			"NaN cannot be used as hash key",
+		},
+
+		// 函数参数数量
+		{
+			"let add = fn(x, y) { x + y }; add(1)",
+			"wrong number of arguments for `add`: expected 2, actual 1",
+		},
+		{
+			"let add = fn(x, y) { x + y }; add(1, 2, 3)",
+			"wrong number of arguments for `add`: expected 2, actual 3",
+		},
+		{
+			"fn(x, y = 1) { x }()",
+			"wrong number of arguments for anonymous function: expected 1 to 2, actual 0",
+		},
+		{
+			"let f = fn(x, ...rest) { x }; f()",
+			"wrong number of arguments for `f`: expected at least 1, actual 0",
+		},
+		{
+			"let f = fn(x = y) { x }; f()",
+			"identifier not found: y",
+		},
+
+		// 逻辑运算的右操作数出错
+		{
+			"true && 1 / 0",
+			"division by zero",
+		},
+		{
+			"false || missing",
+			"identifier not found: missing",
+		},
+
+		// 除以零
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"let f = fn(x) { 10 % x }; f(0)",
+			"modulo by zero",
+		},
+		{
+			"100000000000000000000 / (1 - 1)",
+			"division by zero",
+		},
+		{
+			"100000000000000000000 % 0",
+			"modulo by zero",
+		},
+		{
+			"1.5 / 0",
+			"division by zero",
+		},
+		{
+			"1 % 0.0",
+			"modulo by zero",
+		},
+
+		// 浮点数运算
+		{
+			"-1.5 + true",
+			"type mismatch: FLOAT + BOOLEAN",
+		},
+		{
+			`1.5 + "a"`,
+			"type mismatch: FLOAT + STRING",
+		},
 	}
 	for idx, test := range tests {
 		evaluated := testEval(test.input)
@@ -276,57 +582,129 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
-func TestLetStatements(t *testing.T) {
+func TestTryExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected interface{}
 	}{
-		{"let a = 5; a;", 5},
-		{"let a = 5 * 5; a;", 25},
-		{"let a = 5; let b = a; b;", 5},
-		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		// 没有错误时，值为 try 语句块的值
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"let x = try { 1 + 1 } catch (e) { 0 }; x", 2},
+
+		// 捕获错误
+		{"try { 1 / 0 } catch (e) { 2 }", 2},
+		{"try { 1 / 0 } catch { 3 }", 3},
+		{"try { 1 / 0 } catch (e) { e.message }", "division by zero"},
+		{"try { 1 / 0 } catch (e) { e.kind }", "ArithmeticError"},
+		{"try { 1 + true } catch (e) { e.kind }", "TypeError"},
+		{"try { foo } catch (e) { e.kind }", "NameError"},
+		{"try { [1, 2][5] } catch (e) { e.kind }", "IndexError"},
+		{`try { let {a} = {}; } catch (e) { e.kind }`, "KeyError"},
+		{`try { int("abc") } catch (e) { e.kind }`, "ValueError"},
+		{"try { len(1) } catch (e) { e.kind }", "TypeError"},
+		{"try { {}[fn() {}] } catch (e) { e.kind }", "TypeError"},
+		{"try {\n  1 / 0\n} catch (e) { e.position }", "2:5"},
+		{"try { 1 / 0 } catch ({message, kind}) { kind + \": \" + message }", "ArithmeticError: division by zero"},
+		{"let f = fn(x) { x / 0 }; let g = fn() { f(1) }; try { g() } catch (e) { len(e.trace) }", 2},
+		{"let f = fn(x) { x / 0 }; try { f(1) } catch (e) { e.trace[0] }", "f (1:33)"},
+
+		// throw
+		{`try { throw "boom" } catch (e) { e.message }`, "boom"},
+		{`try { throw "boom" } catch (e) { e.kind }`, "Error"},
+		{`try { throw {"kind": "MyError", "message": "oops"} } catch (e) { e.kind + e.message }`, "MyErroroops"},
+		{`try { throw {"message": "oops"} } catch (e) { e.kind }`, "Error"},
+		{`try { try { 1 / 0 } catch (e) { throw e } } catch (e) { e.kind }`, "ArithmeticError"},
+		{`let f = fn() { throw "inner"; 1 }; try { f() } catch (e) { e.message }`, "inner"},
+		{`throw "uncaught"`, "uncaught"},
+		{`throw 1`, "throw expected STRING or HASH, actual INTEGER"},
+		{`throw {"kind": "X"}`, `thrown HASH expected a STRING "message"`},
+
+		// catch 语句块里的错误继续向外传递
+		{"try { 1 / 0 } catch (e) { e + 1 }", "type mismatch: HASH + INTEGER"},
+		{"try { 1 / 0 } catch (e) { let e = 1 }", "identifier e has already been declared"},
+
+		// finally
+		{"let n = 0; try { n = 1 } finally { n += 10 }; n", 11},
+		{"let n = 0; try { 1 / 0 } catch (e) { n = 1 } finally { n += 10 }; n", 11},
+		{"try { 1 / 0 } finally { 2 }", "division by zero"},
+		{"let n = 0; try { try { 1 / 0 } finally { n = 5 } } catch (e) { n += 1 }; n", 6},
+		{"try { 1 } finally { 2 }", 1},
+		{"try { 1 } finally { 1 / 0 }", "division by zero"},
+		{"let f = fn() { try { return 1 } finally { 2 } }; f()", 1},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"let f = fn() { try { 1 / 0 } catch (e) { return 3 } finally { } }; f()", 3},
+		{"let n = 0; let m = 0; while (true) { try { n += 1; if (n == 3) { break } } finally { m += 10 } }; m", 30},
+
+		// 语句块的作用域
+		{"let x = 1; try { let x = 2 } catch (e) { }; x", 1},
 	}
 
 	for _, test := range tests {
-		testIntegerObject(t, testEval(test.input), test.expected)
-	}
-}
-
-func TestFunctionObject(t *testing.T) {
-	input := "fn(x) { x + 2; };"
-	evaluated := testEval(input)
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("%q: error message expected %q, actual %q", test.input, expected, errObj.Message)
+				}
+				continue
+			}
 
-	fn, ok := evaluated.(*object.Function)
-	if !ok {
-		t.Fatalf("expected Function, actual %T %+v", evaluated, evaluated)
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: expected %q, actual %T %+v", test.input, expected, evaluated, evaluated)
+			}
+		}
 	}
+}
 
-	if len(fn.Parameters) != 1 {
-		t.Fatalf("expected 1 parameter, actual %+v",
-			fn.Parameters)
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedKind object.ErrorKind
+	}{
+		{"1 + true", object.TYPE_ERROR},
+		{"-true", object.TYPE_ERROR},
+		{"foo", object.NAME_ERROR},
+		{"x = 1", object.NAME_ERROR},
+		{"const x = 1; x = 2", object.NAME_ERROR},
+		{"[1][1]", object.INDEX_ERROR},
+		{"1 % 0", object.ARITHMETIC_ERROR},
+		{"1.5 / 0", object.ARITHMETIC_ERROR},
+		{`float("x")`, object.VALUE_ERROR},
+		{"range(1, 2, 0)", object.VALUE_ERROR},
+		{"1()", object.TYPE_ERROR},
+		{"fn(a) { a }()", object.TYPE_ERROR},
+		{"for (x in 1) { }", object.TYPE_ERROR},
+		{"let [a] = [1, 2]", object.VALUE_ERROR},
+		{`throw "x"`, object.ERROR},
 	}
 
-	if fn.Parameters[0].String() != "x" {
-		t.Fatalf("expected parameter 'x', actual %q", fn.Parameters[0])
-	}
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected error, actual %T %+v", test.input, evaluated, evaluated)
+			continue
+		}
 
-	expectedBody := "(x + 2)"
-	if fn.Body.String() != expectedBody {
-		t.Fatalf("expected body %q, actual %q", expectedBody, fn.Body.String())
+		if errObj.Kind != test.expectedKind {
+			t.Errorf("%q: kind expected %q, actual %q", test.input, test.expectedKind, errObj.Kind)
+		}
 	}
 }
 
-func TestFunctionApplication(t *testing.T) {
+func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected int64
 	}{
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
 	}
 
 	for _, test := range tests {
@@ -334,54 +712,49 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
-func TestClosures(t *testing.T) {
-	input := `
-	let newAdder = fn(x) {
-		fn(y) { x + y };
-	};
-	let addTwo = newAdder(2);
-	addTwo(2);`
-	testIntegerObject(t, testEval(input), 4)
-}
-
-func TestStringLiteral(t *testing.T) {
-	input := `"Hello World!"`
-	evaluated := testEval(input)
-
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("expected String, actual %T, %+v", evaluated, evaluated)
-	}
-
-	if str.Value != "Hello World!" {
-		t.Errorf("expected %q, actual %q", "Hello World!", str.Value)
-	}
-}
-
-func TestStringConcatenation(t *testing.T) {
-	input := `"Hello" + " " + "World!"`
-	evaluated := testEval(input)
-
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("expected String, actual %T, %+v", evaluated, evaluated)
-	}
-
-	if str.Value != "Hello World!" {
-		t.Errorf("expected %q, actual %q", "Hello World!", str.Value)
-	}
-}
-
-func TestBuiltinFunctions(t *testing.T) {
+func TestBlockScoping(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "argument type of `len` expected STRING or ARRAY, actual INTEGER"},
-		{`len("one", "two")`, "number of arguments for `len` expected 1, actual 2"},
+		// 语句块里声明的标识符不会泄漏到外层
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"if (true) { let y = 2; }; y", "identifier not found: y"},
+		{"let x = 1; while (x < 3) { let y = x; x += 1 }; y", "identifier not found: y"},
+		{"let x = 1; match (5) { n => { let x = n } }; x", 1},
+
+		// 内层可以读取和修改外层的标识符
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"let x = 1; if (true) { let y = x + 1; y }", 2},
+		{"let x = 1; if (true) { let x = 2; if (true) { x = 3 }; x }", 3},
+
+		// 循环体每次迭代都是新的作用域
+		{"let i = 0; let sum = 0; while (i < 3) { let v = i * 2; sum += v; i += 1 }; sum", 6},
+
+		// 函数体跟形参共用一个作用域，但可以遮蔽外层的标识符
+		{"let x = 1; let f = fn() { let x = 2; x }; f() + x", 3},
+		{"let f = fn(x) { let x = 2; x }; f(1)", "identifier x has already been declared"},
+		{"let f = fn(a, a) { a }; f(1, 2)", "identifier a has already been declared"},
+		{`let h = {"m": fn(self) { self }}; h.m(1)`, 1},
+
+		// 同一个作用域里重复声明
+		{"let x = 1; let x = 2;", "identifier x has already been declared"},
+		{"let x = 1; const x = 2;", "identifier x has already been declared"},
+		{"if (true) { let x = 1; let x = 2; }", "identifier x has already been declared"},
+		{"let [a, b] = [1, 2]; let {a} = {\"a\": 3};", "identifier a has already been declared"},
+		{"let [a, a] = [1, 2];", "identifier a has already been declared"},
+		{"let [a, ...a] = [1, 2];", "identifier a has already been declared"},
+
+		// const
+		{"const x = 1; x", 1},
+		{"const x = 1; x = 2;", "cannot assign to constant: x"},
+		{"const x = 1; x += 2;", "cannot assign to constant: x"},
+		{"const x = 1; let f = fn() { x = 2 }; f()", "cannot assign to constant: x"},
+		{"if (true) { let f = fn() { x = 2 }; const x = 1; f() }", "cannot assign to constant: x"},
+		{"const [a, b] = [1, 2]; b = 3;", "cannot assign to constant: b"},
+		{"const arr = [1, 2]; arr[0] = 5; arr[0]", 5},
+		{"const x = 1; if (true) { let x = 2; x = 3; x }", 3},
+		{"const x = 1; if (true) { let x = 2; }; x", 1},
 	}
 
 	for _, test := range tests {
@@ -392,48 +765,525 @@ func TestBuiltinFunctions(t *testing.T) {
 		case string:
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
-				t.Errorf("expected Error, actual %T %+v",
-					evaluated, evaluated)
+				t.Errorf("%q: expected error, actual %T %+v", test.input, evaluated, evaluated)
 				continue
 			}
 			if errObj.Message != expected {
-				t.Errorf("error message expected %q, actual %q",
-					expected, errObj.Message)
+				t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
 			}
 		}
 	}
 }
 
-func TestArrayLiterals(t *testing.T) {
-	input := "[1, 2 * 2, 3 + 3]"
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Array)
-
-	if !ok {
-		t.Fatalf("expected Array, actual %T, %+v", evaluated, evaluated)
-	}
-
-	if len(result.Elements) != 3 {
-		t.Fatalf("expected 3 elements, actual %d",
-			len(result.Elements))
-	}
-
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
-}
-
-func TestArrayIndexExpressions(t *testing.T) {
+func TestAssignExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let y = 0; x = y = 5; x + y", 10},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 5; x", 2},
+		{"let x = 10; x %= 4; x", 2},
+		{"let x = 1.5; x *= 2; x", 3.0},
+		{`let s = "a"; s += "b"; s`, "ab"},
+
+		// 更新外层环境的标识符
 		{
-			"[1, 2, 3][0]",
-			1,
+			"let count = 0; let inc = fn() { count += 1 }; inc(); inc(); count",
+			2,
 		},
 		{
-			"[1, 2, 3][1]",
+			`let counter = fn() { let n = 0; fn() { n = n + 1 } };
+			let c = counter(); c(); c(); c()`,
+			3,
+		},
+		// 函数参数遮蔽外层的同名标识符
+		{"let x = 1; let f = fn(x) { x = 100 }; f(5); x", 1},
+
+		{"y = 1", "cannot assign to undefined variable: y"},
+		{"y += 1", "identifier not found: y"},
+		{`let x = 1; x += "a"`, "type mismatch: INTEGER + STRING"},
+		{"let x = 1; x /= 0", "division by zero"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
+				}
+				continue
+			}
+
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: expected %q, actual %T %+v", test.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// let
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, ...rest] = [1, 2, 3]; len(rest)", 2},
+		{"let [a, ...rest] = [1]; len(rest)", 0},
+		{"let [[a, b], c] = [[1, 2], 3]; a + b + c", 6},
+		{"let [_, b, _] = [1, 2, 3]; b", 2},
+		{`let {name, age} = {"name": "a", "age": 30}; age`, 30},
+		{`let {"pos": [x, y]} = {"pos": [3, 4], "id": 1}; x * y`, 12},
+		{`let [a, 2] = [1, 2]; a`, 1},
+		{"let arr = [1, 2, 3]; let [a, ...rest] = arr; rest[0] = 9; arr[1]", 2},
+
+		// 函数参数
+		{"let f = fn([a, b]) { a + b }; f([1, 2])", 3},
+		{`let f = fn({x, y}, z) { x + y + z }; f({"x": 1, "y": 2}, 3)`, 6},
+		{"let f = fn([a, b] = [1, 2]) { a + b }; f()", 3},
+		{"let f = fn([head, ...tail]) { if (len(tail) == 0) { head } else { head + f(tail) } }; f([1, 2, 3])", 6},
+		{"let pairs = [[1, 2], [3, 4]]; let sum = 0; for (p in pairs) { let [a, b] = p; sum += a * b }; sum", 14},
+
+		// 错误
+		{"let [a, b] = [1];", "expected array of length 2, actual 1"},
+		{"let [a, b, ...c] = [1];", "expected array of length at least 2, actual 1"},
+		{"let [a] = 1;", "cannot destructure INTEGER as array"},
+		{`let {name} = {"age": 1};`, "missing key name in hash"},
+		{`let {1: a} = {};`, "missing key 1 in hash"},
+		{"let {name} = [1];", "cannot destructure ARRAY as hash"},
+		{"let [a, 2] = [1, 3];", "value 3 does not match pattern 2"},
+		{"let f = fn([a, b]) { a }; f([1, 2, 3])", "expected array of length 2, actual 3"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: expected error, actual %T %+v", test.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// while
+		{"let i = 0; while (i < 10) { i += 1 }; i", 10},
+		{"let i = 0; while (false) { i += 1 }; i", 0},
+		{"let i = 0; let sum = 0; while (i < 5) { i += 1; sum += i }; sum", 15},
+
+		// for-in
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", 6},
+		{"let sum = 0; for (x in range(5)) { sum += x }; sum", 10},
+		{"let sum = 0; for (x in range(1, 4)) { sum += x }; sum", 6},
+		{"let sum = 0; for (x in range(10, 0, -3)) { sum += x }; sum", 22},
+		{"let sum = 0; for (x in range(5, 1)) { sum += x }; sum", 0},
+		{`let s = ""; for (ch in "你好") { s = ch + s }; s`, "好你"},
+		{`let s = ""; for (k in {"b": 1, "a": 2, "c": 3}) { s += k }; s`, "abc"},
+		{`let s = ""; for (k in {10: 1, 9: 2, 1.5: 3}) { s += "${k};" }; s`, "1.5;9;10;"},
+
+		// break 和 continue
+		{"let i = 0; while (true) { i += 1; if (i == 5) { break } }; i", 5},
+		{"let sum = 0; for (x in range(10)) { if (x % 2 == 0) { continue } sum += x }; sum", 25},
+		{"let n = 0; for (x in range(3)) { for (y in range(3)) { if (y == 1) { break } n += 1 } }; n", 3},
+		{"let i = 0; let n = 0; while (i < 10) { i += 1; if (i > 3) { continue; } n += 1 }; n", 3},
+
+		// 作为表达式的 if 里的 break、continue 和 return 不会被 let 语句或者赋值表达式绑定，而是继续向外传递
+		{"let i = 0; while (true) { i += 1; let x = if (i == 3) { break }; }; i", 3},
+		{"let n = 0; for (x in range(5)) { let y = if (x % 2 == 0) { continue } else { x }; n += y }; n", 4},
+		{"let i = 0; let x = 0; while (i < 10) { i += 1; x = if (i == 4) { break } else { i } }; x * 10 + i", 34},
+		{"let a = [0]; for (x in range(5)) { a[0] += match (x) { 2 => { break }, _ => x } }; a[0]", 1},
+		{"let f = fn() { let x = if (true) { return 5 }; 10 }; f()", 5},
+
+		// return 从循环里返回
+		{"let find = fn(arr, v) { for (x in arr) { if (x == v) { return true } } false }; find([1, 2, 3], 2)", true},
+		{"let find = fn(arr, v) { for (x in arr) { if (x == v) { return true } } false }; find([1, 2, 3], 4)", false},
+		{"let f = fn() { let i = 0; while (true) { i += 1; if (i == 3) { return i } } }; f()", 3},
+
+		// 每一次迭代绑定新的循环变量
+		{"let fs = []; for (x in range(3)) { fs = push(fs, fn() { x }) }; fs[0]() + fs[2]()", 2},
+
+		// 循环语句的值为 null
+		{"let f = fn() { while (false) {} }; f() == if (false) { 1 }", true},
+
+		// 大量迭代不会耗尽 Go 的调用栈
+		{"let n = 0; for (x in range(100000)) { n += 1 }; n", 100000},
+
+		{"for (x in 5) { x }", "INTEGER is not iterable"},
+		{"while (1 / 0) { }", "division by zero"},
+		{"for (x in [1, 2]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
+				}
+				continue
+			}
+
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: expected %q, actual %T %+v", test.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 字面量
+		{`match (1) { 1 => "one", 2 => "two" }`, "one"},
+		{`match (2) { 1 => "one", 2 => "two" }`, "two"},
+		{`match (-1) { 1 => "one", -1 => "minus one" }`, "minus one"},
+		{`match (2.0) { 2 => "two" }`, "two"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{`match (false) { true => 1, false => 0 }`, 0},
+		{`match ("1") { 1 => "int", _ => "other" }`, "other"},
+
+		// 通配符和绑定
+		{`match (3) { 1 => "one", _ => "other" }`, "other"},
+		{`match (3) { 1 => 0, n => n * 2 }`, 6},
+
+		// 数组
+		{`match ([1, 2]) { [a] => a, [a, b] => a + b }`, 3},
+		{`match ([1, 2, 3]) { [a, b] => 0, [first, ...rest] => len(rest) }`, 2},
+		{`match ([1]) { [first, ...rest] => len(rest) }`, 0},
+		{`match ([]) { [first, ...rest] => 1, [] => 2 }`, 2},
+		{`match ([1, [2, 3]]) { [1, [x, y]] => x * y }`, 6},
+		{`match ([1, 2]) { [2, _] => 1, [_, 2] => 2 }`, 2},
+		{`match ("ab") { [a, b] => 1, _ => 2 }`, 2},
+
+		// 映射表
+		{`match ({"name": "a", "age": 30}) { {"age": 20} => 1, {"age": 30, "name": n} => n }`, "a"},
+		{`match ({"x": 1, "y": 2}) { {x, y} => x + y }`, 3},
+		{`match ({"x": 1}) { {x, y} => 0, {x} => x }`, 1},
+		{`match ({1: [5]}) { {1: [v]} => v }`, 5},
+		{`match ([1]) { {x} => 1, _ => 2 }`, 2},
+
+		// 语句块形式的 body
+		{`match (4) { n => { let m = n + 1; m * 2 } }`, 10},
+
+		// 没有匹配的分支时返回 null
+		{`match (5) { 1 => 1 }`, nil},
+		{`match (5) { }`, nil},
+
+		// 分支绑定的变量不会泄漏到外层
+		{`let n = 1; match (2) { n => n }; n`, 1},
+		{`let x = 1; match ([2, 3]) { [x, 4] => 0, [_, y] => x + y }`, 4},
+
+		// return、break 可以穿过 match 表达式
+		{`let f = fn(x) { match (x) { 0 => { return "zero" } } "nonzero" }; f(0)`, "zero"},
+		{`let n = 0; while (true) { n += 1; match (n) { 3 => { break } } }; n`, 3},
+
+		{`match (1 / 0) { _ => 1 }`, "division by zero"},
+		{`match (1) { 1 => 1 + true }`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
+				}
+				continue
+			}
+
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: expected %q, actual %T %+v", test.input, expected, evaluated, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestRangeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"range(5)", "range(0, 5)"},
+		{"range(1, 5)", "range(1, 5)"},
+		{"range(5, 1, -2)", "range(5, 1, -2)"},
+		{"len(range(10))", "10"},
+		{"len(range(0, 10, 3))", "4"},
+		{"len(range(10, 0, -3))", "4"},
+		{"len(range(5, 1))", "0"},
+		{"len(range(-9223372036854775807 - 1, 9223372036854775807))", "18446744073709551615"},
+		{"range(1, 2, 0)", "ERROR: 1:6: step of `range` must not be zero"},
+		{`range("a")`, "ERROR: 1:6: argument type of `range` expected INTEGER, actual STRING"},
+		{"range()", "ERROR: 1:6: number of arguments for `range` expected 1 to 3, actual 0"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		if evaluated.Inspect() != test.expected {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+	evaluated := testEval(input)
+
+	// 其他执行引擎的函数在 *object.Function 的基础上附加各自的数据
+	function, ok := evaluated.(object.FunctionObject)
+	if !ok {
+		t.Fatalf("expected Function, actual %T %+v", evaluated, evaluated)
+	}
+	fn := function.Definition()
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("expected 1 parameter, actual %+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("expected parameter 'x', actual %q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("expected body %q, actual %q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+
+		// 默认参数
+		{"let inc = fn(x, step = 1) { x + step }; inc(5)", 6},
+		{"let inc = fn(x, step = 1) { x + step }; inc(5, 10)", 15},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1)", 3},
+		{"let n = 100; let f = fn(x = n) { x }; n = 1; f()", 1}, // 默认值在调用时求值
+
+		// 剩余参数
+		{"let count = fn(...args) { len(args) }; count()", 0},
+		{"let count = fn(...args) { len(args) }; count(1, 2, 3)", 3},
+		{"let f = fn(head, ...tail) { head + len(tail) }; f(10, 1, 2)", 12},
+		{"let f = fn(a, b = 2, ...rest) { a + b + len(rest) }; f(1)", 3},
+		{"let f = fn(a, b = 2, ...rest) { a + b + len(rest) }; f(1, 5, 0, 0)", 8},
+	}
+
+	for _, test := range tests {
+		testIntegerObject(t, testEval(test.input), test.expected)
+	}
+}
+
+// 函数体没有产生值时（函数体为空，或者最后一条语句是 let 语句），函数调用的结果为 null
+func TestFunctionWithoutValue(t *testing.T) {
+	tests := []string{
+		"fn() {}()",
+		"fn() { let a = 1; }()",
+		"let f = fn(x) { let y = x * 2 }; f(1)",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(input))
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+	let newAdder = fn(x) {
+		fn(y) { x + y };
+	};
+	let addTwo = newAdder(2);
+	addTwo(2);`
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+	evaluated := testEval(input)
+
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("expected String, actual %T, %+v", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("expected %q, actual %q", "Hello World!", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+	evaluated := testEval(input)
+
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("expected String, actual %T, %+v", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("expected %q, actual %q", "Hello World!", str.Value)
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"${1}"`, "1"},
+		{`let n = 5; "n = ${n}"`, "n = 5"},
+		{`let n = 5; "n = ${n}, 2n = ${n * 2}!"`, "n = 5, 2n = 10!"},
+		{`let name = "toy"; "hello, ${name}"`, "hello, toy"},
+		{`"${true} ${[1, 2]}"`, "true [1, 2]"},
+		{`let sum = fn(a) { a[0] + a[1] }; "sum = ${sum([3, 4])}"`, "sum = 7"},
+		{`let h = {"a": 1}; "a = ${h["a"]}, ${ {"b": 2}["b"] }"`, "a = 1, 2"},
+		{`let x = "in"; "out ${"mid ${x} mid"} out"`, "out mid in mid out"},
+		{`"\${1}"`, "${1}"},
+		{`"$ and {}"`, "$ and {}"},
+		{`let f = fn() { "a${1}" }; f() + "b"`, "a1b"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%q: expected String, actual %T, %+v", test.input, evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, str.Value)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len("你好，世界")`, 5},
+		{`len(bytes("你好"))`, 6},
+		{`bytes(1)`, "argument type of `bytes` expected STRING, actual INTEGER"},
+		{`len(1)`, "argument type of `len` expected STRING, ARRAY or RANGE, actual INTEGER"},
+		{`len("one", "two")`, "number of arguments for `len` expected 1, actual 2"},
+
+		{`int(3)`, 3},
+		{`int(3.99)`, 3},
+		{`int(-3.99)`, -3},
+		{`int("42")`, 42},
+		{`int(" -7 ")`, -7},
+		{`int("3.5")`, `could not parse "3.5" as integer`},
+		{`int(float("inf"))`, "cannot convert +Inf to INTEGER"},
+		{`int(float("nan"))`, "cannot convert NaN to INTEGER"},
+		{`int(true)`, "argument type of `int` expected INTEGER, FLOAT or STRING, actual BOOLEAN"},
+		{`float(3)`, 3.0},
+		{`float(2.5)`, 2.5},
+		{`float("1e-9")`, 1e-9},
+		{`float("abc")`, `could not parse "abc" as float`},
+		{`float()`, "number of arguments for `float` expected 1, actual 0"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("expected Error, actual %T %+v",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("error message expected %q, actual %q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+
+	if !ok {
+		t.Fatalf("expected Array, actual %T, %+v", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("expected 3 elements, actual %d",
+			len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"[1, 2, 3][0]",
+			1,
+		},
+		{
+			"[1, 2, 3][1]",
 			2,
 		},
 		{
@@ -462,25 +1312,162 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][3]",
-			nil,
+			"index out of range: 3 (array length 3)",
 		},
 		{
 			"[1, 2, 3][-1]",
-			nil,
+			"index out of range: -1 (array length 3)",
+		},
+		{
+			"[1, 2, 3][18446744073709551616]",
+			"index out of range: 18446744073709551616 (array length 3)",
+		},
+		{
+			"[][0]",
+			"index out of range: 0 (array length 0)",
 		},
 	}
 
 	for _, test := range tests {
 		evaluated := testEval(test.input)
-		integer, ok := test.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: expected Error, actual %T %+v", test.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a[0] + a[1]", 12},
+		{"let a = [1, 2, 3]; a[2] += 5; a[2]", 8},
+		{"let a = [1, 2, 3]; a[1] = a[2] = 0; a[1] + a[2]", 0},
+		{"let a = [[1, 2], [3, 4]]; a[1][0] = 9; a[1][0]", 9},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"]`, 2},
+		{`let h = {}; h["b"] = 3; h["b"]`, 3},
+		{`let h = {}; h[1] = 3; h[1.0]`, 3},
+		{`let h = {"n": 1}; h["n"] *= 10; h["n"]`, 10},
+		{`let h = {}; h.x = 5; h["x"]`, 5},
+		{`let h = {"x": 1}; h.x += 1; h.x`, 2},
+		{`let h = {"p": {"q": 1}}; h.p.q = 7; h["p"]["q"]`, 7},
+		{`let h = {}; h.missing`, nil},
+
+		// 下标表达式只求值一次
+		{"let n = 0; let next = fn() { n += 1; n - 1 }; let a = [1, 1]; a[next()] += 1; a[0] * 10 + n", 21},
+
+		// 数组和映射表是引用类型
+		{"let a = [1, 2]; let b = a; b[0] = 100; a[0]", 100},
+		{`let h = {}; let g = h; g.k = 1; h.k`, 1},
+		{"let a = [1, 2]; let f = fn(arr) { arr[1] = 5 }; f(a); a[1]", 5},
+		{"let a = [1, 2]; let b = push(a, 3); b[0] = 9; a[0]", 1}, // push 返回新的数组
+
+		{"let a = [1, 2]; a[2] = 3", "index out of range: 2 (array length 2)"},
+		{"let a = [1, 2]; a[-1] = 3", "index out of range: -1 (array length 2)"},
+		{`let a = [1, 2]; a["x"] = 3`, "index of ARRAY expected INTEGER, actual STRING"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{`let h = {}; h[[1]] = 1`, "unsupported type for hash key: ARRAY"},
+		{`let h = {}; h["a"] += 1`, "type mismatch: NULL + INTEGER"},
+		{"let a = [1]; a.x = 1", "member assignment not supported: ARRAY.x"},
+		{"let n = 1; n.x", "member access not supported: INTEGER.x"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: expected Error, actual %T %+v", test.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
+			}
+		default:
 			testNullObject(t, evaluated)
 		}
 	}
 }
 
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let person = {"name": "Ann"}; person.name`, "Ann"},
+		{`let p = {"name": "Ann", "greet": fn(greeting) { greeting + ", " + self.name }}; p.greet("Hi")`, "Hi, Ann"},
+		{
+			`let counter = {"count": 0, "inc": fn(step = 1) { self.count += step; self }};
+			counter.inc().inc(10).inc();
+			counter.count`,
+			12,
+		},
+		{
+			`let make = fn(n) { {"n": n, "double": fn() { self.n * 2 }} };
+			make(3).double() + make(4).double()`,
+			14,
+		},
+		// 方法可以调用同一个对象的其他方法
+		{
+			`let o = {"a": fn() { self.b() + 1 }, "b": fn() { 41 }}; o.a()`,
+			42,
+		},
+		// 不通过方法调用时，self 没有定义
+		{`let o = {"f": fn() { self }}; let f = o.f; f()`, "identifier not found: self"},
+		// 同名的参数遮蔽 self
+		{`let o = {"f": fn(self) { self }}; o.f(5)`, 5},
+		{`let o = {"f": fn(self) { if (true) { let y = 1; self + y } }}; o.f(5)`, 6},
+		// 内层函数使用外层方法的 self
+		{`let o = {"v": 3, "f": fn() { let g = fn() { self.v }; g() }}; o.f()`, 3},
+		// 映射表里的内置函数
+		{`let o = {"size": len}; o.size("abc")`, 3},
+		// 调用对象只求值一次
+		{
+			`let n = 0; let get = fn() { n += 1; {"f": fn() { n }} }; get().f()`,
+			1,
+		},
+
+		{`let o = {}; o.missing()`, "not a function: NULL"},
+		{`[1, 2].len()`, "member access not supported: ARRAY.len"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		switch expected := test.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("error message expected %q, actual %q", expected, errObj.Message)
+				}
+				continue
+			}
+
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: expected %q, actual %T %+v", test.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
 func TestMap(t *testing.T) {
 	input := `
 	let map = fn(arr, f) {
@@ -549,8 +1536,8 @@ func TestHashLiterals(t *testing.T) {
 		(&object.String{Value: "two"}).HashKey():   2,
 		(&object.String{Value: "three"}).HashKey(): 3,
 		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+		core.TRUE.HashKey():                        5,
+		core.FALSE.HashKey():                       6,
 	}
 
 	if len(result.Pairs) != len(expected) {
@@ -599,6 +1586,22 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.0: 5}[2]`,
+			5,
+		},
+		{
+			`{1.5: 5}[1.5]`,
+			5,
+		},
+		{
+			`{1.5: 5}[1]`,
+			nil,
+		},
 	}
 
 	for _, test := range tests {
@@ -611,3 +1614,393 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"5 + true;", 1, 3},
+		{"let a = 1;\nlet b = a - foobar;", 2, 13},
+		{"let f = fn(x) {\n  x * \"s\"\n};\nf(1);", 2, 5},
+		{`len(1)`, 1, 4},
+		{"let n = 1;\n\"n = ${n + true}\"", 2, 10},
+		{"let a = 1;\nlet b = a / 0;", 2, 11},
+		{"let [a, [b, c]] = [1, [2]];", 1, 9},
+		{"let {x, y} = {\"x\": 1};", 1, 9},
+		{"let f = fn(a, [b]) {\n  a\n};\nf(1, 2);", 1, 15},
+		{"let x = 1;\nlet [y, x] = [2, 3];", 2, 9},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		errorObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("expected error object, actual %T, %+v", evaluated, evaluated)
+			continue
+		}
+
+		if errorObj.Pos.Line != test.expectedLine || errorObj.Pos.Column != test.expectedColumn {
+			t.Errorf("error position for %q expected %d:%d, actual %s",
+				test.input, test.expectedLine, test.expectedColumn, errorObj.Pos)
+		}
+	}
+}
+
+func TestErrorLabels(t *testing.T) {
+	input := "let f = fn(x) {\n  x * \"s\"\n};\nf(1);"
+
+	evaluated := testEval(input)
+	errorObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected error object, actual %T, %+v", evaluated, evaluated)
+	}
+
+	if len(errorObj.Labels) != 1 {
+		t.Fatalf("expected 1 label, actual %d", len(errorObj.Labels))
+	}
+
+	label := errorObj.Labels[0]
+	if label.Pos.Line != 1 || label.Pos.Column != 9 {
+		t.Errorf("label position expected 1:9, actual %s", label.Pos)
+	}
+
+	if label.Message != "function defined here" {
+		t.Errorf("label message expected %q, actual %q", "function defined here", label.Message)
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	input := `let inner = fn(x) {
+	x + true
+};
+let outer = fn(x) {
+	inner(x)
+};
+let apply = fn(f, x) { f(x) };
+apply(outer, 1);`
+
+	evaluated := testEval(input)
+	errorObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected error object, actual %T, %+v", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		function string
+		line     int
+	}{
+		{"inner", 5},
+		{"outer", 7},
+		{"apply", 8},
+	}
+
+	if len(errorObj.Trace) != len(expected) {
+		t.Fatalf("expected %d frames, actual %d: %+v", len(expected), len(errorObj.Trace), errorObj.Trace)
+	}
+
+	for i, frame := range expected {
+		actual := errorObj.Trace[i]
+		if actual.Function != frame.function || actual.Pos.Line != frame.line {
+			t.Errorf("frame [%d] expected %s at line %d, actual %s at %s",
+				i, frame.function, frame.line, actual.Function, actual.Pos)
+		}
+	}
+}
+
+// 调用层数超出 core.MaxCallDepth 时，每一个执行引擎都报告可以捕获的 RecursionError，而不是令 Go 的调用栈溢出
+func TestMaxCallDepth(t *testing.T) {
+	sum := "let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } };"
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{sum + "sum(9000)", 40504500},
+		{sum + "sum(20000)", "maximum call depth of 10000 exceeded"},
+		{"let f = fn(n) { f(n + 1) + 1 }; f(0)", "maximum call depth of 10000 exceeded"},
+		{"let f = fn(n) { f(n + 1) + 1 }; try { f(0) } catch (e) { e.kind }", "RecursionError"},
+		{sum + "let f = fn(n) { f(n + 1) + 1 }; try { f(0) } catch (e) { 1 }; sum(9000)", 40504500}, // 捕获之后调用层数恢复
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if err, ok := evaluated.(*object.Error); ok {
+				if err.Kind != object.RECURSION_ERROR || err.Message != expected {
+					t.Errorf("expected RecursionError %q, actual %s %q", expected, err.Kind, err.Message)
+				}
+			} else if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("expected %q, actual %+v", expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"你好，世界"[1]`, "好"},
+		{`let s = "😀ab"; s[1]`, "a"},
+		{`"你好"[2]`, nil},
+		{`"你好"[-1]`, nil},
+	}
+
+	for _, test := range tests {
+		evaluated := testEval(test.input)
+		expected, ok := test.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("expected String, actual %T, %+v", evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != expected {
+			t.Errorf("expected %q, actual %q", expected, str.Value)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let 总和 = 1 + 2; let café = 总和 * 2; café`
+	testIntegerObject(t, testEval(input), 6)
+}
+
+// 在临时目录里写入若干模块文件，然后以该目录为当前目录对其中的 main.toy 求值
+func testEvalModules(t *testing.T, files map[string]string) object.Object {
+	return testEvalModulesWithRuntime(t, files, object.NewRuntime())
+}
+
+// 使用指定的运行配置对模块求值
+func testEvalModulesWithRuntime(t *testing.T, files map[string]string, runtime *object.Runtime) object.Object {
+	dir := t.TempDir()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := parser.New(lexer.NewWithFile("main.toy", files["main.toy"]))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	return testRun(program, runtime)
+}
+
+func TestImportStatements(t *testing.T) {
+	fold := `export let fold = fn(list, initial, f) {
+	let acc = initial;
+	for (x in list) { acc = f(acc, x) }
+	acc
+};
+let hidden = 1;`
+
+	tests := []struct {
+		files    map[string]string
+		expected int64
+	}{
+		{map[string]string{
+			"lib/fold.toy": fold,
+			"main.toy":     `import { fold } from "lib/fold.toy"; fold([1, 2, 3], 0, fn(a, b) { a + b })`,
+		}, 6},
+		{map[string]string{
+			"lib/fold.toy": fold,
+			"main.toy":     `import "lib/fold.toy" as f; f.fold([1, 2, 3], 1, fn(a, b) { a * b * 2 })`,
+		}, 48},
+		{map[string]string{
+			"lib/fold.toy": fold,
+			"main.toy":     `import { fold as reduce } from "lib/fold.toy"; reduce([4, 5], 0, fn(a, b) { a + b })`,
+		}, 9},
+		// 模块里的相对路径相对于模块本身所在的目录
+		{map[string]string{
+			"lib/a.toy": `import { b } from "b.toy"; export let a = b + 1;`,
+			"lib/b.toy": `export const b = 10;`,
+			"main.toy":  `import { a } from "lib/a.toy"; a`,
+		}, 11},
+		// 解构导出
+		{map[string]string{
+			"m.toy":    `export let [x, {y}] = [1, {"y": 2}];`,
+			"main.toy": `import { x, y } from "m.toy"; x + y`,
+		}, 3},
+		// 每个模块只求值一次
+		{map[string]string{
+			"counter.toy": `export let state = {"n": 0}; state.n += 1;`,
+			"a.toy":       `import { state } from "counter.toy";`,
+			"main.toy":    `import "a.toy" as a; import { state } from "counter.toy"; import "counter.toy" as c; state.n + c.state.n`,
+		}, 2},
+	}
+
+	for _, test := range tests {
+		evaluated := testEvalModules(t, test.files)
+		testIntegerObject(t, evaluated, test.expected)
+	}
+}
+
+func TestImportSearchPath(t *testing.T) {
+	lib := t.TempDir()
+	if err := os.WriteFile(filepath.Join(lib, "util.toy"), []byte("export let two = 2;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runtime := object.NewRuntime()
+	runtime.SearchPath = []string{lib}
+
+	evaluated := testEvalModulesWithRuntime(t, map[string]string{
+		"main.toy": `import { two } from "util.toy"; two * 21`,
+	}, runtime)
+	testIntegerObject(t, evaluated, 42)
+
+	// 查找路径只属于配置了它的运行
+	evaluated = testEvalModules(t, map[string]string{
+		"main.toy": `import { two } from "util.toy"; two * 21`,
+	})
+	if errorObj, ok := evaluated.(*object.Error); !ok || errorObj.Kind != object.IMPORT_ERROR {
+		t.Errorf("expected import error, actual %T, %+v", evaluated, evaluated)
+	}
+}
+
+// 模块的每一个语法错误都会报告，第一个以外的语法错误作为附加标签
+func TestImportSyntaxErrors(t *testing.T) {
+	evaluated := testEvalModules(t, map[string]string{
+		"m.toy":    "let a = ;\nlet b = ;",
+		"main.toy": `import "m.toy" as m;`,
+	})
+
+	errorObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected error object, actual %T, %+v", evaluated, evaluated)
+	}
+
+	if errorObj.Pos.File != "m.toy" || errorObj.Pos.Line != 1 {
+		t.Errorf("error position expected m.toy:1, actual %s", errorObj.Pos)
+	}
+
+	if len(errorObj.Labels) != 2 {
+		t.Fatalf("expected 2 labels, actual %d", len(errorObj.Labels))
+	}
+
+	label := errorObj.Labels[0]
+	if label.Pos.File != "m.toy" || label.Pos.Line != 2 || !strings.Contains(label.Message, "expected an expression") {
+		t.Errorf("expected syntax error label at m.toy:2, actual %s %q", label.Pos, label.Message)
+	}
+
+	if errorObj.Labels[1].Message != "imported here" {
+		t.Errorf("expected label %q, actual %q", "imported here", errorObj.Labels[1].Message)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		files           map[string]string
+		expectedKind    object.ErrorKind
+		expectedMessage string
+	}{
+		{map[string]string{
+			"main.toy": `import "missing.toy" as m;`,
+		}, object.IMPORT_ERROR, `module not found: "missing.toy"`},
+		{map[string]string{
+			"m.toy":    `export let a = 1; let b = 2;`,
+			"main.toy": `import { b } from "m.toy";`,
+		}, object.NAME_ERROR, "has no exported member b"},
+		{map[string]string{
+			"m.toy":    `let b = 2;`,
+			"main.toy": `import "m.toy" as m; m.b`,
+		}, object.NAME_ERROR, "has no exported member b"},
+		{map[string]string{
+			"m.toy":    `export let a = 1;`,
+			"main.toy": `let a = 0; import { a } from "m.toy";`,
+		}, object.NAME_ERROR, "identifier a has already been declared"},
+		{map[string]string{
+			"m.toy":    `let a = ;`,
+			"main.toy": `import "m.toy" as m;`,
+		}, object.IMPORT_ERROR, "expected an expression"},
+		{map[string]string{
+			"m.toy":    `export let a = 1 / 0;`,
+			"main.toy": `import "m.toy" as m;`,
+		}, object.ARITHMETIC_ERROR, "division by zero"},
+		// 模块引用了不存在的标识符时，在执行模块之前就报告错误
+		{map[string]string{
+			"m.toy":    `export let a = 1 / 0; let f = fn() { missing };`,
+			"main.toy": `import "m.toy" as m;`,
+		}, object.NAME_ERROR, "identifier not found: missing"},
+		{map[string]string{
+			"a.toy":    `import "b.toy" as b;`,
+			"b.toy":    `import "a.toy" as a;`,
+			"main.toy": `import "a.toy" as a;`,
+		}, object.IMPORT_ERROR, "circular import: a.toy -> b.toy -> a.toy"},
+		{map[string]string{
+			"a.toy":    `import "main.toy" as m;`,
+			"main.toy": `import "a.toy" as a;`,
+		}, object.IMPORT_ERROR, "circular import: main.toy -> a.toy -> main.toy"},
+	}
+
+	for _, test := range tests {
+		evaluated := testEvalModules(t, test.files)
+		errorObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("expected error object, actual %T, %+v", evaluated, evaluated)
+			continue
+		}
+
+		if errorObj.Kind != test.expectedKind {
+			t.Errorf("expected kind %s, actual %s", test.expectedKind, errorObj.Kind)
+		}
+
+		if !strings.Contains(errorObj.Message, test.expectedMessage) {
+			t.Errorf("expected message containing %q, actual %q", test.expectedMessage, errorObj.Message)
+		}
+	}
+}
+
+func TestImportErrorLocation(t *testing.T) {
+	evaluated := testEvalModules(t, map[string]string{
+		"m.toy":    "let a = 1;\nlet b = a + true;",
+		"main.toy": "let x = 1;\nimport \"m.toy\" as m;",
+	})
+
+	errorObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected error object, actual %T, %+v", evaluated, evaluated)
+	}
+
+	if errorObj.Pos.File != "m.toy" || errorObj.Pos.Line != 2 || errorObj.Pos.Column != 11 {
+		t.Errorf("error position expected m.toy:2:11, actual %s", errorObj.Pos)
+	}
+
+	if len(errorObj.Labels) != 1 {
+		t.Fatalf("expected 1 label, actual %d", len(errorObj.Labels))
+	}
+
+	label := errorObj.Labels[0]
+	if label.Message != "imported here" || label.Pos.File != "main.toy" || label.Pos.Line != 2 {
+		t.Errorf("expected label \"imported here\" at main.toy:2, actual %q at %s", label.Message, label.Pos)
+	}
+}
@@ -0,0 +1,11 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// 替换执行测试程序的方式，供外部测试包使用
+func SetTestRun(run func(program *ast.Program, runtime *object.Runtime) object.Object) {
+	testRun = run
+}
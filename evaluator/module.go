@@ -0,0 +1,41 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/core"
+	"interpreter/object"
+)
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	module, err := core.LoadModule(env.Runtime(), node, evalModule)
+	if err != nil {
+		return err
+	}
+
+	if node.Alias != nil && !declareVariable(node.Alias, module, env, false) {
+		return core.NewErrorAt(node.Alias, object.NAME_ERROR, "identifier %s has already been declared", node.Alias.Value)
+	}
+
+	for i, name := range node.Names {
+		value, ok := module.Export(name.Value)
+		if !ok {
+			return core.NewErrorAt(name, object.NAME_ERROR, "module %s has no exported member %s", module.Path, name.Value)
+		}
+
+		local := node.Locals[i]
+		if !declareVariable(local, value, env, false) {
+			return core.NewErrorAt(local, object.NAME_ERROR, "identifier %s has already been declared", local.Value)
+		}
+	}
+
+	return nil
+}
+
+// 执行模块，模块跟导入者使用同一个运行配置
+func evalModule(program *ast.Program, runtime *object.Runtime) (*object.Environment, *object.Error) {
+	env := object.NewEnvironmentWithRuntime(runtime)
+	if err, ok := Eval(program, env).(*object.Error); ok {
+		return nil, err
+	}
+	return env, nil
+}
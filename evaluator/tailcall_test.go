@@ -0,0 +1,90 @@
+package evaluator
+
+import (
+	"interpreter/core"
+	"interpreter/object"
+	"strings"
+	"testing"
+)
+
+// 尾递归不会增加调用栈的深度，即使递归上百万次也不会栈溢出
+func TestDeepTailRecursion(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping deep recursion")
+	}
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };
+			count(100000, 0)`,
+			100000,
+		},
+		{
+			// 两个互相调用的函数
+			`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+			let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+			if (even(1000000)) { 1 } else { 0 }`,
+			1,
+		},
+		{
+			`let count = fn(n) { if (n > 0) { return count(n - 1) }; 42 };
+			count(100000)`,
+			42,
+		},
+		{
+			`let counter = {"count": fn(n) { match (n) { 0 => self.total, _ => self.count(n - 1) } }, "total": 7};
+			counter.count(100000)`,
+			7,
+		},
+		{
+			// 折叠一百万个整数
+			`let fold = fn(items, initial, func) {
+				let iter = fn(index, accumulator) {
+					if (index == len(items)) {
+						accumulator
+					} else {
+						iter(index + 1, func(accumulator, index));
+					}
+				};
+				iter(0, initial);
+			};
+			fold(range(1000000), 0, fn(acc, x) { acc + x })`,
+			499999500000,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+// 尾调用发生错误时，调用栈跟没有尾调用优化时一样
+func TestTailCallStackTrace(t *testing.T) {
+	input := `let check = fn(n) { if (n == 0) { throw "done" } else { check(n - 1) } };
+let start = fn() { check(2) };
+start()`
+
+	evaluated := testEval(input)
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected error object, actual %T, %+v", evaluated, evaluated)
+	}
+
+	expected := []string{"check (1:62)", "check (1:62)", "check (2:25)", "start (3:6)"}
+	actual := []string{}
+	for _, frame := range err.Trace {
+		actual = append(actual, frame.Function+" ("+frame.Pos.String()+")")
+	}
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected trace %v, actual %v", expected, actual)
+	}
+
+	// 很深的尾递归只保留最内层的调用栈
+	evaluated = testEval(`let f = fn(n) { if (n == 0) { 1 / 0 } else { f(n - 1) } }; f(10000)`)
+	if err, ok := evaluated.(*object.Error); !ok || len(err.Trace) != core.MaxTailFrames+1 {
+		t.Errorf("expected %d frames, actual %+v", core.MaxTailFrames+1, evaluated)
+	}
+}
@@ -0,0 +1,127 @@
+package executor
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/closure"
+	"interpreter/compiler"
+	"interpreter/core"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"interpreter/vm"
+)
+
+// 执行引擎，执行解析得到的程序，返回最后一条语句的值（没有值时为 nil），或者未被捕获的错误。
+// 同一个引擎多次执行程序时（比如 REPL 的每一行输入），先前声明的全局变量仍然可见
+type Engine interface {
+	Run(program *ast.Program) object.Object
+
+	// 先前执行的程序是否已经声明了全局变量 name
+	Declared(name string) bool
+}
+
+// 可以选择的执行引擎的名称
+var EngineNames = []string{"eval", "vm", "closure"}
+
+// 按照名称创建执行引擎，引擎及其加载的模块使用 runtime 指定的运行配置：
+//
+//	eval     树遍历求值器
+//	vm       字节码编译器和虚拟机
+//	closure  把语法树预先编译为 Go 闭包的执行引擎
+func NewEngine(name string, runtime *object.Runtime) (Engine, error) {
+	switch name {
+	case "eval":
+		return &evalEngine{env: object.NewEnvironmentWithRuntime(runtime)}, nil
+	case "vm":
+		return &vmEngine{
+			symbols:   compiler.NewSymbolTable(),
+			constants: []object.Object{},
+			globals:   vm.NewGlobals(),
+			runtime:   runtime,
+		}, nil
+	case "closure":
+		return &closureEngine{globals: closure.NewGlobals(runtime), runtime: runtime}, nil
+	default:
+		return nil, fmt.Errorf("unknown engine: %s", name)
+	}
+}
+
+// 执行程序，并将执行过程中意外发生的 Go panic 转换为内部错误，
+// 以免整个进程（比如 REPL）因为执行引擎本身的缺陷而退出。
+// 程序引用了不存在的标识符时，在执行之前就报告错误，不执行任何语句
+func SafeRun(engine Engine, program *ast.Program) object.Object {
+	return safeRun(engine, program, core.Resolve)
+}
+
+// 执行 REPL 的一行输入，跟 SafeRun 一样，只是函数体里引用的全局变量可以在后面的输入里才声明，
+// 调用函数时才检查（见 core.ResolveInteractive）
+func SafeRunInteractive(engine Engine, program *ast.Program) object.Object {
+	return safeRun(engine, program, core.ResolveInteractive)
+}
+
+func safeRun(engine Engine, program *ast.Program, resolve func(*ast.Program, func(string) bool) *object.Error) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = &object.Error{Kind: object.INTERNAL_ERROR, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+
+	if err := resolve(program, engine.Declared); err != nil {
+		return err
+	}
+	return engine.Run(program)
+}
+
+type evalEngine struct {
+	env *object.Environment
+}
+
+func (e *evalEngine) Run(program *ast.Program) object.Object {
+	// 上一次执行发生 panic 时没有从函数调用返回，调用的层数从 0 开始重新计算
+	e.env.Runtime().CallDepth = 0
+	return evaluator.Eval(program, e.env)
+}
+
+func (e *evalEngine) Declared(name string) bool {
+	_, ok := e.env.Get(name)
+	return ok
+}
+
+// 字节码引擎，保留全局符号表、常量池和全局变量，供下一次编译和执行使用
+type vmEngine struct {
+	symbols   *compiler.SymbolTable
+	constants []object.Object
+	globals   *object.Globals
+	runtime   *object.Runtime
+}
+
+func (e *vmEngine) Run(program *ast.Program) object.Object {
+	c := compiler.NewWithState(e.symbols, e.constants)
+	if err := c.Compile(program); err != nil {
+		return &object.Error{Kind: object.INTERNAL_ERROR, Message: err.Error()}
+	}
+
+	bytecode := c.Bytecode()
+	e.constants = bytecode.Constants
+
+	return vm.NewWithGlobals(bytecode, e.globals, e.runtime).Run()
+}
+
+func (e *vmEngine) Declared(name string) bool {
+	return e.globals.Declared(name)
+}
+
+// 闭包编译引擎，保留全局变量，供下一次编译和执行使用
+type closureEngine struct {
+	globals *closure.Globals
+	runtime *object.Runtime
+}
+
+func (e *closureEngine) Run(program *ast.Program) object.Object {
+	e.runtime.CallDepth = 0 // 见 evalEngine.Run
+	return closure.Compile(program, e.globals).Run()
+}
+
+func (e *closureEngine) Declared(name string) bool {
+	return e.globals.Declared(name)
+}
@@ -0,0 +1,170 @@
+package executor
+
+import (
+	"interpreter/ast"
+	"interpreter/core"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"testing"
+)
+
+// 比较各个执行引擎的性能：
+//
+//	$ go test -bench . ./executor/
+func BenchmarkEngines(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		input string
+	}{
+		{
+			"fib",
+			`let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(20)`,
+		},
+		{
+			"loop",
+			`let sum = 0; for (i in range(100000)) { sum += i }; sum`,
+		},
+	}
+
+	for _, bb := range benchmarks {
+		program := parser.New(lexer.New(bb.input)).ParseProgram()
+
+		for _, name := range EngineNames {
+			b.Run(bb.name+"/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					engine, err := NewEngine(name, object.NewRuntime())
+					if err != nil {
+						b.Fatal(err)
+					}
+					if err, ok := engine.Run(program).(*object.Error); ok {
+						b.Fatal(err.Inspect())
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestEngines(t *testing.T) {
+	input := `
+let counter = fn() { let n = 0; fn() { n += 1 } };
+let c = counter();
+c(); c();
+let point = { "x": 1, "y": 2, "sum": fn() { self.x + self.y } };
+[c(), point.sum(), try { throw "boom" } catch (e) { e.message }]`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	for _, name := range EngineNames {
+		engine, err := NewEngine(name, object.NewRuntime())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := engine.Run(program)
+		if result == nil || result.Inspect() != "[3, 3, boom]" {
+			t.Errorf("engine %s: expected [3, 3, boom], actual %v", name, result)
+		}
+	}
+
+	if _, err := NewEngine("unknown", object.NewRuntime()); err == nil {
+		t.Errorf("expected error for unknown engine")
+	}
+}
+
+// 引用了不存在的标识符时，每一个执行引擎都在执行之前报告错误，程序里的任何语句都不会执行
+func TestUndefinedIdentifierBeforeExecution(t *testing.T) {
+	for _, name := range EngineNames {
+		engine, err := NewEngine(name, object.NewRuntime())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := SafeRun(engine, parser.New(lexer.New("let x = 1; let f = fn() { missing }")).ParseProgram())
+		errObj, ok := result.(*object.Error)
+		if !ok || errObj.Kind != object.NAME_ERROR || errObj.Message != "identifier not found: missing" {
+			t.Errorf("engine %s: expected undefined identifier error, actual %+v", name, result)
+			continue
+		}
+		if errObj.Pos.Line != 1 || errObj.Pos.Column != 27 {
+			t.Errorf("engine %s: expected error at 1:27, actual %s", name, errObj.Pos)
+		}
+		if engine.Declared("x") {
+			t.Errorf("engine %s: expected no statement to be executed", name)
+		}
+
+		// 先前执行的程序（比如 REPL 的上一行输入）声明的全局变量是可见的
+		SafeRun(engine, parser.New(lexer.New("let y = 2")).ParseProgram())
+		result = SafeRun(engine, parser.New(lexer.New("fn() { y }()")).ParseProgram())
+		if result == nil || result.Inspect() != "2" {
+			t.Errorf("engine %s: expected 2, actual %v", name, result)
+		}
+	}
+}
+
+// REPL 的输入里，函数可以引用后面的输入才声明的全局变量，调用时才检查
+func TestSafeRunInteractive(t *testing.T) {
+	for _, name := range EngineNames {
+		engine, err := NewEngine(name, object.NewRuntime())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inputs := []struct {
+			input    string
+			expected string
+		}{
+			{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }", ""},
+			{"let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }", ""},
+			{"even(10)", "true"},
+			{"let f = fn() { missing }", ""},
+			{"f()", "identifier not found: missing"},
+			{"missing", "identifier not found: missing"},
+		}
+
+		for _, tt := range inputs {
+			result := SafeRunInteractive(engine, parser.New(lexer.New(tt.input)).ParseProgram())
+
+			actual := ""
+			if errObj, ok := result.(*object.Error); ok {
+				actual = errObj.Message
+			} else if result != nil && result != core.NULL {
+				actual = result.Inspect()
+			}
+			if actual != tt.expected {
+				t.Errorf("engine %s: %q: expected %q, actual %q", name, tt.input, tt.expected, actual)
+			}
+		}
+	}
+}
+
+func TestSafeRun(t *testing.T) {
+	// 缺少操作数的表达式会令执行引擎发生 panic（字节码编译器则直接报告内部错误）
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.PrefixExpression{Operator: "-"}},
+	}}
+
+	for _, name := range EngineNames {
+		engine, err := NewEngine(name, object.NewRuntime())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := SafeRun(engine, program)
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("engine %s: expected Error, actual %T %+v", name, result, result)
+			continue
+		}
+		if errObj.Kind != object.INTERNAL_ERROR {
+			t.Errorf("engine %s: expected internal error, actual %s %q", name, errObj.Kind, errObj.Message)
+		}
+
+		// 引擎在 panic 之后仍然可以继续使用
+		result = SafeRun(engine, parser.New(lexer.New("1 + 2")).ParseProgram())
+		if result == nil || result.Inspect() != "3" {
+			t.Errorf("engine %s: expected 3, actual %v", name, result)
+		}
+	}
+}
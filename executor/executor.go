@@ -2,14 +2,14 @@ package executor
 
 import (
 	"fmt"
-	"interpreter/evaluator"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
 	"os"
 )
 
-func Exec(filePath string) {
+func Exec(filePath string, engine Engine) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
 		fmt.Printf("Read file error: %s\n", err)
@@ -18,25 +18,31 @@ func Exec(filePath string) {
 
 	text := string(content)
 
-	l := lexer.New(text)
+	renderer := diagnostic.NewRenderer(diagnostic.ColorEnabled(os.Stdout))
+	renderer.AddSource(filePath, text)
+
+	l := lexer.NewWithFile(filePath, text)
 	p := parser.New(l)
 	program := p.ParseProgram()
 
 	if len(p.Errors()) != 0 {
-		printParserErrors(p.Errors())
+		printParserErrors(renderer, p.Errors())
 		return
 	}
 
-	env := object.NewEnvironment()
-	evaluated := evaluator.Eval(program, env)
+	evaluated := SafeRun(engine, program)
 	if evaluated != nil {
+		if err, ok := evaluated.(*object.Error); ok {
+			renderer.Render(os.Stdout, diagnostic.FromError(err))
+			return
+		}
+
 		fmt.Println(evaluated.Inspect())
 	}
 }
 
-func printParserErrors(errors []string) {
-	fmt.Println("Parser errors:")
-	for _, msg := range errors {
-		fmt.Println("\t" + msg)
+func printParserErrors(renderer *diagnostic.Renderer, errors []diagnostic.Diagnostic) {
+	for _, d := range errors {
+		renderer.Render(os.Stdout, d)
 	}
 }
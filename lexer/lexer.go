@@ -2,31 +2,103 @@
 
 package lexer
 
-import "interpreter/token"
+import (
+	"fmt"
+	"interpreter/diagnostic"
+	"interpreter/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	input        string
-	position     int  // 当前字符的位置
+	position     int  // 当前字符的位置（字节偏移量）
 	readPosition int  // 输入字符串的读取位置（即当前字符的下一个字符的位置）
-	ch           byte // 当前字符（只支持 ascii）
+	ch           rune // 当前字符（Unicode 码点），0 表示到达末尾
+
+	file   string // 源码文件名，用于报告错误的位置
+	line   int    // 当前字符所在的行，从 1 开始
+	column int    // 当前字符所在的列（以字符而不是字节计算），从 1 开始
+
+	errors []diagnostic.Diagnostic // 词法错误，比如不明字符、未结束的字符串等
+
+	// 遇到了未结束的字符串，源码的其余部分都是字符串的内容，见 Unterminated
+	unterminated bool
+
+	// 插值字符串的嵌套栈，每一层对应一个尚未结束的 "${...}"
+	templates []template
+}
+
+// 尚未结束的插值表达式 "${...}"
+type template struct {
+	start  token.Position // 插值字符串开头的双引号的位置
+	braces int            // "${...}" 之内尚未闭合的花括号的数量，用于判断遇到的 '}' 是否是插值表达式的结束
 }
 
 func New(input string) *Lexer {
-	lx := &Lexer{input: input}
+	return NewWithFile("", input)
+}
+
+// 创建一个带有源码文件名的 Lexer，文件名会记录在每个 token 的位置信息里
+func NewWithFile(file string, input string) *Lexer {
+	lx := &Lexer{input: input, file: file, line: 1}
 	lx.readChar()
 	return lx
 }
 
+// 返回词法分析过程中发现的错误
+func (lx *Lexer) Errors() []diagnostic.Diagnostic {
+	return lx.errors
+}
+
+// 是否遇到了未结束的字符串（包括插值表达式没有结束的字符串）。
+// 此时已经报告了错误，语法分析在源码末尾发现的错误只是它的后果，不需要再报告
+func (lx *Lexer) Unterminated() bool {
+	return lx.unterminated
+}
+
+// 报告未结束的字符串，start 为字符串开始的位置
+func (lx *Lexer) unterminatedError(start token.Position, message string) {
+	lx.errorAt(start, lx.currentPosition(), "%s", message)
+	lx.unterminated = true
+	lx.templates = nil // 外层的插值字符串同样没有结束，只报告一次
+}
+
+func (lx *Lexer) errorAt(start token.Position, end token.Position, format string, a ...interface{}) {
+	lx.errors = append(lx.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     diagnostic.Span{Start: start, End: end},
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// 是否已经到达源码的末尾（源码中间的 NUL 字符不算）
+func (lx *Lexer) atEOF() bool {
+	return lx.ch == 0 && lx.position >= len(lx.input)
+}
+
 func (lx *Lexer) readChar() {
+	// 更新行号和列号（此时 lx.ch 仍然是即将离开的字符）
+	if lx.ch == '\n' {
+		lx.line += 1
+		lx.column = 1
+	} else {
+		lx.column += 1
+	}
+
+	// 按 UTF-8 解码下一个字符，width 为该字符所占的字节数。
+	// 无效的 UTF-8 字节会被解码为 utf8.RuneError（width 为 1），随后作为不明字符处理
+	width := 0
 	if lx.readPosition >= len(lx.input) {
 		lx.ch = 0
 	} else {
-		lx.ch = lx.input[lx.readPosition]
+		lx.ch, width = utf8.DecodeRuneInString(lx.input[lx.readPosition:])
 	}
 
 	// 移动光标到下一个字符
 	lx.position = lx.readPosition
-	lx.readPosition += 1
+	lx.readPosition += width
 }
 
 func (lx *Lexer) NextToken() token.Token {
@@ -36,12 +108,19 @@ func (lx *Lexer) NextToken() token.Token {
 		//
 	}
 
+	// 记录 token 的开始位置
+	pos := lx.currentPosition()
+
 	switch lx.ch {
 	case '=':
 		if lx.peekChar() == '=' {
 			lx.readChar() // 消耗下一个字符
 			tk = token.Token{Type: token.EQ, Literal: "=="}
 
+		} else if lx.peekChar() == '>' {
+			lx.readChar() // 消耗下一个字符
+			tk = token.Token{Type: token.ARROW, Literal: "=>"}
+
 		} else {
 			tk = newToken(token.ASSIGN, lx.ch)
 		}
@@ -56,13 +135,15 @@ func (lx *Lexer) NextToken() token.Token {
 		}
 
 	case '+':
-		tk = newToken(token.PLUS, lx.ch)
+		tk = lx.newOperatorToken(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tk = newToken(token.MINUS, lx.ch)
+		tk = lx.newOperatorToken(token.MINUS, token.MINUS_ASSIGN)
 	case '/':
-		tk = newToken(token.SLASH, lx.ch)
+		tk = lx.newOperatorToken(token.SLASH, token.SLASH_ASSIGN)
 	case '*':
-		tk = newToken(token.ASTERISK, lx.ch)
+		tk = lx.newOperatorToken(token.ASTERISK, token.ASTERISK_ASSIGN)
+	case '%':
+		tk = lx.newOperatorToken(token.PERCENT, token.PERCENT_ASSIGN)
 
 	case '<':
 		tk = newToken(token.LT, lx.ch)
@@ -76,15 +157,38 @@ func (lx *Lexer) NextToken() token.Token {
 	case ':':
 		tk = newToken(token.COLON, lx.ch)
 
+	case '.':
+		if lx.peekChar() == '.' && lx.peekCharAt(2) == '.' {
+			lx.readChar()
+			lx.readChar()
+			tk = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tk = newToken(token.DOT, lx.ch)
+		}
+
 	case '(':
 		tk = newToken(token.LPAREN, lx.ch)
 	case ')':
 		tk = newToken(token.RPAREN, lx.ch)
 
 	case '{':
+		if n := len(lx.templates); n > 0 {
+			lx.templates[n-1].braces += 1
+		}
 		tk = newToken(token.LBRACE, lx.ch)
+
 	case '}':
-		tk = newToken(token.RBRACE, lx.ch)
+		if n := len(lx.templates); n > 0 && lx.templates[n-1].braces == 0 {
+			// 插值表达式结束，继续读取字符串的剩余部分
+			quote := lx.templates[n-1].start
+			lx.templates = lx.templates[:n-1]
+			tk = lx.readTemplate(pos, quote, token.TEMPLATE_MIDDLE, token.TEMPLATE_TAIL)
+		} else {
+			if n > 0 {
+				lx.templates[n-1].braces -= 1
+			}
+			tk = newToken(token.RBRACE, lx.ch)
+		}
 
 	case '[':
 		tk = newToken(token.LBRACKET, lx.ch)
@@ -96,7 +200,7 @@ func (lx *Lexer) NextToken() token.Token {
 			lx.readChar()
 			tk = token.Token{Type: token.AND, Literal: "&&"}
 		} else {
-			tk = newToken(token.ILLEGAL, lx.ch) // 不明字符
+			tk = lx.illegalToken(pos) // 不明字符
 		}
 
 	case '|':
@@ -104,50 +208,112 @@ func (lx *Lexer) NextToken() token.Token {
 			lx.readChar()
 			tk = token.Token{Type: token.OR, Literal: "||"}
 		} else {
-			tk = newToken(token.ILLEGAL, lx.ch) // 不明字符
+			tk = lx.illegalToken(pos) // 不明字符
 		}
 
 	case '"':
+		tk = lx.readTemplate(pos, pos, token.TEMPLATE_HEAD, token.STRING)
+
+	case '`':
 		tk.Type = token.STRING
-		tk.Literal = lx.readString()
+		tk.Literal = lx.readRawString(pos)
 
 	case 0:
+		// 到达文件末尾时插值表达式仍然没有结束，即插值字符串没有结束
+		if len(lx.templates) > 0 {
+			lx.unterminatedError(lx.templates[0].start, "unterminated string literal")
+		}
+
 		// 到达文件末尾。
 		// 无法通过调用 newToken() 函数来构造 Literal 值为空字符串的 Token 对象，
 		// 所以手动指定 tk 的值。
-		tk = token.Token{Type: token.EOF, Literal: ""}
+		tk = token.Token{Type: token.EOF, Literal: "", Pos: pos, End: pos}
+		return tk // 到达末尾后不再移动光标
 
 	default:
 		if isAlphabet(lx.ch) {
 			s := lx.readIdentifier()
 
-			tk = token.Token{Type: token.LookupTokenType(s), Literal: s}
+			tk = token.Token{Type: token.LookupTokenType(s), Literal: s, Pos: pos, End: lx.currentPosition()}
 			return tk // 跳过后面的语句，因为 readIdentifier() 已经读了下一个字符
 
 		} else if isDigit(lx.ch) {
-			s := lx.readNumber()
+			s, tokenType := lx.readNumber()
 
-			tk = token.Token{Type: token.INT, Literal: s}
+			tk = token.Token{Type: tokenType, Literal: s, Pos: pos, End: lx.currentPosition()}
 			return tk // 跳过后面的语句，因为 readNumber() 已经读了下一个字符
 
 		} else {
-			tk = newToken(token.ILLEGAL, lx.ch) // 不明字符
+			tk = lx.illegalToken(pos) // 不明字符
 		}
 	}
 
 	lx.readChar() // 读下一个字符
+	tk.Pos = pos
+	tk.End = lx.currentPosition()
 	return tk
 }
 
-func (lx *Lexer) peekChar() byte {
+// 当前字符的位置
+func (lx *Lexer) currentPosition() token.Position {
+	return token.Position{
+		File:   lx.file,
+		Line:   lx.line,
+		Column: lx.column,
+		Offset: lx.position,
+	}
+}
+
+func (lx *Lexer) peekChar() rune {
 	if lx.readPosition >= len(lx.input) {
 		return 0
 	} else {
-		return lx.input[lx.readPosition]
+		ch, _ := utf8.DecodeRuneInString(lx.input[lx.readPosition:])
+		return ch
+	}
+}
+
+// 读取当前字符之后的第 n 个字符（n 为 1 时相当于 peekChar）
+func (lx *Lexer) peekCharAt(n int) rune {
+	offset := lx.readPosition
+	for ; n > 1 && offset < len(lx.input); n-- {
+		_, width := utf8.DecodeRuneInString(lx.input[offset:])
+		offset += width
+	}
+
+	if offset >= len(lx.input) {
+		return 0
 	}
+	ch, _ := utf8.DecodeRuneInString(lx.input[offset:])
+	return ch
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+// 构造不明字符的 token，同时记录一个词法错误
+func (lx *Lexer) illegalToken(pos token.Position) token.Token {
+	end := pos
+	end.Column += 1
+	end.Offset = lx.readPosition
+
+	if lx.ch == utf8.RuneError {
+		lx.errorAt(pos, end, "invalid UTF-8 encoding")
+	} else {
+		lx.errorAt(pos, end, "unexpected character %q", lx.ch)
+	}
+
+	return newToken(token.ILLEGAL, lx.ch)
+}
+
+// 构造算术运算符的 token，如果后面紧跟 '='，则构造对应的复合赋值运算符，比如 "+="
+func (lx *Lexer) newOperatorToken(tokenType token.TokenType, assignType token.TokenType) token.Token {
+	if lx.peekChar() == '=' {
+		ch := lx.ch
+		lx.readChar() // 消耗 '='
+		return token.Token{Type: assignType, Literal: string(ch) + "="}
+	}
+	return newToken(tokenType, lx.ch)
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{
 		Type:    tokenType,
 		Literal: string(ch),
@@ -156,7 +322,7 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 
 func (lx *Lexer) skipWhitespace() bool {
 	var found = false
-	for lx.ch == ' ' || lx.ch == '\t' || lx.ch == '\n' || lx.ch == '\r' {
+	for unicode.IsSpace(lx.ch) { // 包括全角空格等 Unicode 空白字符
 		found = true
 		lx.readChar()
 	}
@@ -184,39 +350,210 @@ func (lx *Lexer) readIdentifier() string {
 	return lx.input[startPosition:lx.position]
 }
 
-func (lx *Lexer) readNumber() string { // 以字符串的形式返回数字
+// 以字符串的形式返回数字，以及数字的类型（INT 或者 FLOAT）。
+// 浮点数由整数部分、可选的小数部分（".14"）和可选的指数部分（"e-9"）组成，
+// 小数点和指数符号后面必须紧跟数字，否则不算作数字的一部分
+func (lx *Lexer) readNumber() (string, token.TokenType) {
 	startPosition := lx.position
+	tokenType := token.TokenType(token.INT)
+
+	lx.readDigits()
+
+	// 小数部分
+	if lx.ch == '.' && isDigit(lx.peekChar()) {
+		tokenType = token.FLOAT
+		lx.readChar() // 跳过小数点
+		lx.readDigits()
+	}
+
+	// 指数部分
+	if lx.ch == 'e' || lx.ch == 'E' {
+		next := lx.peekChar()
+		if next == '+' || next == '-' {
+			next = lx.peekCharAt(2)
+		}
+
+		if isDigit(next) {
+			tokenType = token.FLOAT
+			lx.readChar() // 跳过 'e'
+			if lx.ch == '+' || lx.ch == '-' {
+				lx.readChar()
+			}
+			lx.readDigits()
+		}
+	}
+
+	// 返回从 startPosition 到 lx.position 之间的字符
+	return lx.input[startPosition:lx.position], tokenType
+}
+
+func (lx *Lexer) readDigits() {
 	for isDigit(lx.ch) {
 		lx.readChar() // 读下一个字符
 	}
+}
 
-	// 返回从 startPosition 到 lx.position 之间的字符
-	return lx.input[startPosition:lx.position]
+// 读取双引号字符串的一部分，如果遇到 "${" 则返回 interpolationType 类型的 token，
+// 否则（遇到结尾的双引号）返回 closingType 类型的 token。quote 为字符串开头的双引号的位置
+func (lx *Lexer) readTemplate(start token.Position, quote token.Position, interpolationType token.TokenType, closingType token.TokenType) token.Token {
+	s, interpolation := lx.readString(start)
+	if interpolation {
+		lx.templates = append(lx.templates, template{start: quote})
+		return token.Token{Type: interpolationType, Literal: s}
+	}
+	return token.Token{Type: closingType, Literal: s}
 }
 
-func (lx *Lexer) readString() string { // 返回的字符串值不包含前后双引号
-	startPosition := lx.position
+// 读取双引号字符串，返回的字符串值不包含前后双引号，并且已经处理了转义字符。
+// 开始时当前字符为开头的双引号（或者插值表达式结束的右花括号），
+// 结束时当前字符为结尾的双引号，或者插值表达式 "${" 的左花括号，此时 interpolation 为 true
+func (lx *Lexer) readString(start token.Position) (s string, interpolation bool) {
+	var out strings.Builder
+
 	for {
 		lx.readChar() // 读下一个字符
-		if lx.ch == '"' || lx.ch == 0 {
+
+		switch {
+		case lx.ch == '"':
+			return out.String(), false
+
+		case lx.ch == '$' && lx.peekChar() == '{':
+			lx.readChar() // 消耗 '{'
+			return out.String(), true
+
+		case lx.atEOF():
+			lx.unterminatedError(start, "unterminated string literal")
+			return out.String(), false
+
+		case lx.ch == '\\':
+			lx.readEscape(&out)
+
+		default:
+			out.WriteRune(lx.ch)
+		}
+	}
+}
+
+// 读取一个转义字符，并将其代表的字符写入 out。
+// 开始时当前字符为反斜杠，结束时当前字符为转义序列的最后一个字符
+func (lx *Lexer) readEscape(out *strings.Builder) {
+	start := lx.currentPosition()
+	lx.readChar() // 跳过反斜杠
+
+	switch lx.ch {
+	case 'n':
+		out.WriteRune('\n')
+	case 't':
+		out.WriteRune('\t')
+	case 'r':
+		out.WriteRune('\r')
+	case '0':
+		out.WriteRune(0)
+	case '\\', '"', '\'', '`', '$':
+		out.WriteRune(lx.ch)
+
+	case 'u':
+		// Unicode 码点，格式为 \u{XXXX}，XXXX 为 1 到 6 位十六进制数
+		if lx.peekChar() != '{' {
+			lx.errorAt(start, lx.nextPosition(), "expected '{' after \\u")
+			return
+		}
+		lx.readChar()
+
+		var value rune
+		digits := 0
+		for isHexDigit(lx.peekChar()) {
+			lx.readChar()
+			value = value*16 + hexValue(lx.ch)
+			digits += 1
+		}
+
+		if lx.peekChar() != '}' {
+			lx.errorAt(start, lx.nextPosition(), "expected '}' to close \\u{ escape")
+			return
+		}
+		lx.readChar()
+
+		if digits == 0 || digits > 6 || !utf8.ValidRune(value) {
+			lx.errorAt(start, lx.nextPosition(), "invalid Unicode code point in escape sequence")
+			return
+		}
+		out.WriteRune(value)
+
+	case 0:
+		if lx.atEOF() {
+			return // 由 readString 报告未结束的字符串
+		}
+		out.WriteRune(0)
+
+	default:
+		lx.errorAt(start, lx.nextPosition(), "unknown escape sequence \\%c", lx.ch)
+		out.WriteRune(lx.ch)
+	}
+}
+
+// 读取反引号字符串（原始字符串），原始字符串不处理转义字符，并且可以跨越多行。
+// 开始时当前字符为开头的反引号，结束时当前字符为结尾的反引号
+func (lx *Lexer) readRawString(start token.Position) string {
+	startPosition := lx.position + 1
+
+	for {
+		lx.readChar() // 读下一个字符
+
+		if lx.ch == '`' {
+			break
+		}
+
+		if lx.atEOF() {
+			lx.unterminatedError(start, "unterminated raw string literal")
 			break
 		}
 	}
 
-	// 返回从 startPosition + 1 到 lx.position 之间的字符
-	return lx.input[startPosition+1 : lx.position]
+	return lx.input[startPosition:lx.position]
+}
+
+// 当前字符的下一个字符的位置
+func (lx *Lexer) nextPosition() token.Position {
+	pos := lx.currentPosition()
+	if lx.position < len(lx.input) {
+		pos.Column += 1
+		pos.Offset = lx.readPosition
+	}
+	return pos
+}
+
+func isHexDigit(ch rune) bool {
+	return ch >= '0' && ch <= '9' ||
+		ch >= 'a' && ch <= 'f' ||
+		ch >= 'A' && ch <= 'F'
+}
+
+func hexValue(ch rune) rune {
+	switch {
+	case ch >= 'a':
+		return ch - 'a' + 10
+	case ch >= 'A':
+		return ch - 'A' + 10
+	default:
+		return ch - '0'
+	}
 }
 
-func isAlphabet(ch byte) bool {
+// 标识符的首字符：Unicode 字母（包括汉字等）或者下划线
+func isAlphabet(ch rune) bool {
 	return ch >= 'a' && ch <= 'z' ||
 		ch >= 'A' && ch <= 'Z' ||
-		ch == '_'
+		ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
-func isLetter(ch byte) bool {
-	return isAlphabet(ch) || isDigit(ch)
+// 标识符的后续字符：除了首字符允许的字符，还允许数字以及组合用字符（比如某些文字的元音符号）
+func isLetter(ch rune) bool {
+	return isAlphabet(ch) || isDigit(ch) ||
+		ch >= utf8.RuneSelf && (unicode.IsDigit(ch) || unicode.In(ch, unicode.Mn, unicode.Mc))
 }
@@ -236,3 +236,415 @@ func TestNextToken6(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPosition(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedOffset int
+		expectedEnd    int // 结束位置的列号
+	}{
+		{token.LET, 1, 1, 0, 4},
+		{token.IDENT, 1, 5, 4, 6},
+		{token.ASSIGN, 1, 7, 6, 8},
+		{token.INT, 1, 9, 8, 10},
+		{token.SEMICOLON, 1, 10, 9, 11},
+		{token.IDENT, 2, 3, 13, 4},
+		{token.PLUS, 2, 5, 15, 6},
+		{token.STRING, 2, 7, 17, 11},
+		{token.SEMICOLON, 2, 11, 21, 12},
+		{token.EOF, 2, 12, 22, 12},
+	}
+
+	lx := NewWithFile("test.toy", input)
+
+	for i, test := range tests {
+		tk := lx.NextToken()
+
+		if tk.Type != test.expectedType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, test.expectedType, tk.Type)
+		}
+
+		if tk.Pos.File != "test.toy" {
+			t.Fatalf("tests [%d] - file wrong. expected %q, actual %q",
+				i, "test.toy", tk.Pos.File)
+		}
+
+		if tk.Pos.Line != test.expectedLine || tk.Pos.Column != test.expectedColumn {
+			t.Fatalf("tests [%d] - position wrong. expected %d:%d, actual %d:%d",
+				i, test.expectedLine, test.expectedColumn, tk.Pos.Line, tk.Pos.Column)
+		}
+
+		if tk.Pos.Offset != test.expectedOffset {
+			t.Fatalf("tests [%d] - offset wrong. expected %d, actual %d",
+				i, test.expectedOffset, tk.Pos.Offset)
+		}
+
+		if tk.End.Column != test.expectedEnd {
+			t.Fatalf("tests [%d] - end column wrong. expected %d, actual %d",
+				i, test.expectedEnd, tk.End.Column)
+		}
+	}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := `let 总和 = "你好，世界"; // 注释
+	总和_2　+ café;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "总和", 5},
+		{token.ASSIGN, "=", 8},
+		{token.STRING, "你好，世界", 10},
+		{token.SEMICOLON, ";", 17},
+		{token.IDENT, "总和_2", 2}, // 第二行，以制表符开始
+		{token.PLUS, "+", 7},     // 全角空格视为空白字符
+		{token.IDENT, "café", 9},
+		{token.SEMICOLON, ";", 13},
+		{token.EOF, "", 14},
+	}
+
+	lx := New(input)
+
+	for i, test := range tests {
+		tk := lx.NextToken()
+
+		if tk.Type != test.expectedType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, test.expectedType, tk.Type)
+		}
+
+		if tk.Literal != test.expectedLiteral {
+			t.Fatalf("tests [%d] - token value wrong. expected %q, actual %q",
+				i, test.expectedLiteral, tk.Literal)
+		}
+
+		if tk.Pos.Column != test.expectedColumn {
+			t.Fatalf("tests [%d] - column wrong. expected %d, actual %d",
+				i, test.expectedColumn, tk.Pos.Column)
+		}
+	}
+}
+
+func TestNextTokenInvalidUTF8(t *testing.T) {
+	lx := New("a \xff b")
+
+	expected := []token.TokenType{token.IDENT, token.ILLEGAL, token.IDENT, token.EOF}
+	for i, tokenType := range expected {
+		tk := lx.NextToken()
+		if tk.Type != tokenType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, tokenType, tk.Type)
+		}
+	}
+}
+
+func TestNextTokenStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"\t\r\0"`, "\t\r\x00"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"a\\b"`, `a\b`},
+		{`"\'\$\` + "`" + `"`, "'$`"},
+		{`"\u{4F60}\u{597D}"`, "你好"},
+		{`"\u{1F600}"`, "😀"},
+		{"`a\\nb`", `a\nb`},
+		{"`line1\nline2`", "line1\nline2"},
+		{"``", ""},
+	}
+
+	for i, test := range tests {
+		lx := New(test.input)
+		tk := lx.NextToken()
+
+		if tk.Type != token.STRING {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, token.STRING, tk.Type)
+		}
+
+		if tk.Literal != test.expectedLiteral {
+			t.Fatalf("tests [%d] - literal wrong. expected %q, actual %q",
+				i, test.expectedLiteral, tk.Literal)
+		}
+
+		if len(lx.Errors()) != 0 {
+			t.Fatalf("tests [%d] - unexpected errors: %v", i, lx.Errors())
+		}
+
+		if next := lx.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests [%d] - expected EOF, actual %q", i, next.Type)
+		}
+	}
+}
+
+func TestNextTokenRawStringPosition(t *testing.T) {
+	lx := New("`a\nb` x")
+
+	tk := lx.NextToken()
+	if tk.Pos.Line != 1 || tk.End.Line != 2 || tk.End.Column != 3 {
+		t.Fatalf("raw string span wrong. actual %s - %s", tk.Pos, tk.End)
+	}
+
+	tk = lx.NextToken()
+	if tk.Type != token.IDENT || tk.Pos.Line != 2 || tk.Pos.Column != 4 {
+		t.Fatalf("token after raw string wrong. actual %q at %s", tk.Type, tk.Pos)
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedPos     string
+	}{
+		{`"abc`, "unterminated string literal", "1:1"},
+		{"let s = \"abc\nlet t = 1;", "unterminated string literal", "1:9"},
+		{"`abc", "unterminated raw string literal", "1:1"},
+		{`let s = "a${x`, "unterminated string literal", "1:9"},
+		{`"a${ {"k": "${`, "unterminated string literal", "1:1"},
+		{`"a${ "b`, "unterminated string literal", "1:6"},
+		{`"a\qb"`, "unknown escape sequence \\q", "1:3"},
+		{`"\u4F60"`, "expected '{' after \\u", "1:2"},
+		{`"\u{4F60"`, "expected '}' to close \\u{ escape", "1:2"},
+		{`"\u{110000}"`, "invalid Unicode code point in escape sequence", "1:2"},
+		{`a & b`, "unexpected character '&'", "1:3"},
+		{"a \xff b", "invalid UTF-8 encoding", "1:3"},
+	}
+
+	for i, test := range tests {
+		lx := New(test.input)
+		for tk := lx.NextToken(); tk.Type != token.EOF; tk = lx.NextToken() {
+		}
+
+		errors := lx.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("tests [%d] - expected 1 error, actual %d: %v", i, len(errors), errors)
+		}
+
+		if errors[0].Message != test.expectedMessage {
+			t.Fatalf("tests [%d] - message wrong. expected %q, actual %q",
+				i, test.expectedMessage, errors[0].Message)
+		}
+
+		if errors[0].Span.Start.String() != test.expectedPos {
+			t.Fatalf("tests [%d] - position wrong. expected %q, actual %q",
+				i, test.expectedPos, errors[0].Span.Start.String())
+		}
+	}
+}
+
+func TestNextTokenInterpolation(t *testing.T) {
+	input := `"a${x}b${ {"k": "${y}"}["k"] }c" "d"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEMPLATE_HEAD, "a"},
+		{token.IDENT, "x"},
+		{token.TEMPLATE_MIDDLE, "b"},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.TEMPLATE_HEAD, ""},
+		{token.IDENT, "y"},
+		{token.TEMPLATE_TAIL, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.TEMPLATE_TAIL, "c"},
+		{token.STRING, "d"},
+		{token.EOF, ""},
+	}
+
+	lx := New(input)
+
+	for i, test := range tests {
+		tk := lx.NextToken()
+
+		if tk.Type != test.expectedType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, test.expectedType, tk.Type)
+		}
+
+		if tk.Literal != test.expectedLiteral {
+			t.Fatalf("tests [%d] - literal wrong. expected %q, actual %q",
+				i, test.expectedLiteral, tk.Literal)
+		}
+	}
+
+	if len(lx.Errors()) != 0 {
+		t.Fatalf("unexpected errors: %v", lx.Errors())
+	}
+}
+
+func TestNextTokenNumbers(t *testing.T) {
+	input := `5 3.14 1e-9 2E+3 0.5e2 1e x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2E+3"},
+		{token.FLOAT, "0.5e2"},
+		{token.INT, "1"}, // 指数符号后面没有数字，"e" 是一个标识符
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	lx := New(input)
+
+	for i, test := range tests {
+		tk := lx.NextToken()
+
+		if tk.Type != test.expectedType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, test.expectedType, tk.Type)
+		}
+
+		if tk.Literal != test.expectedLiteral {
+			t.Fatalf("tests [%d] - literal wrong. expected %q, actual %q",
+				i, test.expectedLiteral, tk.Literal)
+		}
+	}
+}
+
+func TestNextTokenCompoundAssign(t *testing.T) {
+	input := `x += 1; x -= 2; x *= 3; x /= 4; x %= 5; x = x+1`
+
+	expected := []token.TokenType{
+		token.IDENT, token.PLUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.MINUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.PERCENT_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASSIGN, token.IDENT, token.PLUS, token.INT,
+		token.EOF,
+	}
+
+	lx := New(input)
+	for i, tokenType := range expected {
+		tk := lx.NextToken()
+		if tk.Type != tokenType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, tokenType, tk.Type)
+		}
+	}
+}
+
+func TestNextTokenDot(t *testing.T) {
+	input := `h.x ...rest 1.5.y`
+
+	expected := []token.TokenType{
+		token.IDENT, token.DOT, token.IDENT,
+		token.ELLIPSIS, token.IDENT,
+		token.FLOAT, token.DOT, token.IDENT,
+		token.EOF,
+	}
+
+	lx := New(input)
+	for i, tokenType := range expected {
+		tk := lx.NextToken()
+		if tk.Type != tokenType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, tokenType, tk.Type)
+		}
+	}
+}
+
+func TestNextTokenMatch(t *testing.T) {
+	input := `match (x) { 1 => a, _ => b } x == y`
+
+	expected := []token.TokenType{
+		token.MATCH, token.LPAREN, token.IDENT, token.RPAREN, token.LBRACE,
+		token.INT, token.ARROW, token.IDENT, token.COMMA,
+		token.IDENT, token.ARROW, token.IDENT, token.RBRACE,
+		token.IDENT, token.EQ, token.IDENT,
+		token.EOF,
+	}
+
+	lx := New(input)
+	for i, tokenType := range expected {
+		tk := lx.NextToken()
+		if tk.Type != tokenType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, tokenType, tk.Type)
+		}
+	}
+}
+
+func TestNextTokenConst(t *testing.T) {
+	input := `const x = 1; let constant = x;`
+
+	expected := []token.TokenType{
+		token.CONST, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.LET, token.IDENT, token.ASSIGN, token.IDENT, token.SEMICOLON,
+		token.EOF,
+	}
+
+	lx := New(input)
+	for i, tokenType := range expected {
+		tk := lx.NextToken()
+		if tk.Type != tokenType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, tokenType, tk.Type)
+		}
+	}
+}
+
+func TestNextTokenTryCatch(t *testing.T) {
+	input := `try { throw "x" } catch (e) { } finally { }`
+
+	expected := []token.TokenType{
+		token.TRY, token.LBRACE, token.THROW, token.STRING, token.RBRACE,
+		token.CATCH, token.LPAREN, token.IDENT, token.RPAREN, token.LBRACE, token.RBRACE,
+		token.FINALLY, token.LBRACE, token.RBRACE,
+		token.EOF,
+	}
+
+	lx := New(input)
+	for i, tokenType := range expected {
+		tk := lx.NextToken()
+		if tk.Type != tokenType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, tokenType, tk.Type)
+		}
+	}
+}
+
+func TestNextTokenImportExport(t *testing.T) {
+	input := `import { fold as f } from "lib/fold.toy"; export let x = 1;`
+
+	expected := []token.TokenType{
+		token.IMPORT, token.LBRACE, token.IDENT, token.IDENT, token.IDENT, token.RBRACE,
+		token.IDENT, token.STRING, token.SEMICOLON,
+		token.EXPORT, token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.EOF,
+	}
+
+	lx := New(input)
+	for i, tokenType := range expected {
+		tk := lx.NextToken()
+		if tk.Type != tokenType {
+			t.Fatalf("tests [%d] - token type wrong. expected %q, actual %q",
+				i, tokenType, tk.Type)
+		}
+	}
+}
@@ -3,33 +3,67 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"interpreter/executor"
+	"interpreter/object"
 	"interpreter/repl"
 	"os"
+	"path/filepath"
 )
 
 func main() {
-	args := os.Args
+	strict := flag.Bool("strict", false, "report integer overflow as an error instead of promoting to big integers")
+	path := flag.String("path", "", "list of directories to search for imported modules")
+	engineName := flag.String("engine", "eval", "execution engine: eval (tree-walking evaluator), vm (bytecode virtual machine) or closure (closure compiler)")
+	flag.Usage = usage
+	flag.Parse()
+
+	runtime := object.NewRuntime()
+	runtime.Strict = *strict
+	if *path != "" {
+		runtime.SearchPath = filepath.SplitList(*path)
+	}
+
+	engine, err := executor.NewEngine(*engineName, runtime)
+	if err != nil {
+		fmt.Println(err)
+		usage()
+		os.Exit(2)
+	}
+
+	args := flag.Args()
 	count := len(args)
 
-	if count == 1 {
+	if count == 0 {
 		// 进入 REPL 交互模式
 		fmt.Println("Toy lang REPL")
-		repl.Start(os.Stdin, os.Stdout)
+		repl.Start(os.Stdin, os.Stdout, engine)
 
-	} else if count == 2 {
+	} else if count == 1 {
 		// 解析脚本
-		executor.Exec(args[1])
+		executor.Exec(args[0], engine)
 
 	} else {
-		fmt.Println(`Toy language interpreter
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Println(`Toy language interpreter
 Usage:
 
 1. Launch REPL mode
-$ ./toy
+$ ./toy [-strict] [-path dirs] [-engine name]
 
 2. Execute toy lang script source code file
-$ ./toy path_to_script_file`)
-	}
+$ ./toy [-strict] [-path dirs] [-engine name] path_to_script_file
+
+Options:
+  -strict  report integer overflow as an error instead of promoting to big integers
+  -path    list of directories to search for imported modules,
+           separated by the OS path list separator (":" on Unix)
+  -engine  execution engine, "eval" (tree-walking evaluator, default),
+           "vm" (bytecode compiler and virtual machine)
+           or "closure" (compiles the syntax tree into Go closures)`)
 }
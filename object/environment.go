@@ -3,19 +3,103 @@
 package object
 
 type Environment struct {
-	store map[string]Object // records
-	outer *Environment      // 上一层环境
+	store     map[string]Object // records
+	constants map[string]bool   // 使用 const 声明的标识符，不能重新赋值
+	outer     *Environment      // 上一层环境
+	global    *Environment      // 最外层的环境，即全局环境，对于全局环境本身为 nil
+
+	// 局部变量按照解析时分配的槽位存放在 slots 里，尚未声明的槽位为 nil，
+	// 只用于 NewSlotEnvironment 创建的环境
+	slots    []Object
+	receiver Object // 方法调用的接收者 self，只用于函数调用的环境
+
+	runtime *Runtime // 本次运行的配置，只用于全局环境
 }
 
 func NewEnvironment() *Environment {
+	return NewEnvironmentWithRuntime(NewRuntime())
+}
+
+// 使用指定的运行配置创建全局环境，模块的全局环境跟导入者使用同一个配置
+func NewEnvironmentWithRuntime(runtime *Runtime) *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, runtime: runtime}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: outer, global: outer.Global()}
+}
+
+// 创建以槽位存放局部变量的环境，size 为槽位的数量
+func NewSlotEnvironment(outer *Environment, size int) *Environment {
+	return &Environment{outer: outer, global: outer.Global(), slots: make([]Object, size)}
+}
+
+// 最外层的环境
+func (e *Environment) Global() *Environment {
+	if e.global != nil {
+		return e.global
+	}
+	return e
+}
+
+// 本次运行的配置
+func (e *Environment) Runtime() *Runtime {
+	return e.Global().runtime
+}
+
+// 往外第 depth 层环境
+func (e *Environment) Outer(depth int) *Environment {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	return e
+}
+
+// 获取往外第 depth 层环境的第 index 个槽位的值
+func (e *Environment) GetAt(depth int, index int) (Object, bool) {
+	obj := e.Outer(depth).slots[index]
+	return obj, obj != nil
+}
+
+// 在当前环境的第 index 个槽位声明标识符，如果该槽位已经声明过则返回 false
+func (e *Environment) DeclareAt(index int, value Object) bool {
+	if e.slots[index] != nil {
+		return false
+	}
+	e.slots[index] = value
+	return true
+}
+
+// 更新往外第 depth 层环境的第 index 个槽位的值，如果该槽位尚未声明则返回 false
+func (e *Environment) AssignAt(depth int, index int, value Object) bool {
+	env := e.Outer(depth)
+	if env.slots[index] == nil {
+		return false
+	}
+	env.slots[index] = value
+	return true
+}
+
+// 设置第 index 个槽位的值，不论是否已经声明
+func (e *Environment) SetAt(index int, value Object) {
+	e.slots[index] = value
+}
+
+// 设置方法调用的接收者
+func (e *Environment) SetReceiver(receiver Object) {
+	e.receiver = receiver
+}
+
+// 从当前环境开始向外查找方法调用的接收者，只查找 depth 层环境（depth 为负数时查找所有的环境）
+func (e *Environment) Receiver(depth int) (Object, bool) {
+	for ; e != nil && depth != 0; e, depth = e.outer, depth-1 {
+		if e.receiver != nil {
+			return e.receiver, true
+		}
+	}
+	return nil, false
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -31,6 +115,58 @@ func (e *Environment) Get(name string) (Object, bool) {
 
 // 定义标识符
 func (e *Environment) Set(name string, value Object) Object {
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = value
 	return value
 }
+
+// 在当前环境里声明标识符（let 和 const 语句），
+// 如果当前环境已经声明过同名的标识符，则返回 false。
+// 外层环境的同名标识符不受影响，即内层的声明会遮蔽外层的声明
+func (e *Environment) Declare(name string, value Object, constant bool) bool {
+	if _, ok := e.store[name]; ok {
+		return false
+	}
+
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
+	e.store[name] = value
+	if constant {
+		if e.constants == nil {
+			e.constants = make(map[string]bool)
+		}
+		e.constants[name] = true
+	}
+	return true
+}
+
+// 判断标识符是否常量，从当前环境开始向外层查找声明该标识符的环境
+func (e *Environment) IsConstant(name string) bool {
+	if _, ok := e.store[name]; ok {
+		return e.constants[name]
+	}
+
+	if e.outer != nil {
+		return e.outer.IsConstant(name)
+	}
+
+	return false
+}
+
+// 更新标识符的值，从当前环境开始向外层查找已经定义的标识符，
+// 如果标识符不存在，则返回 false
+func (e *Environment) Assign(name string, value Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = value
+		return true
+	}
+
+	if e.outer != nil {
+		return e.outer.Assign(name, value)
+	}
+
+	return false
+}
@@ -7,6 +7,10 @@ import (
 	"fmt"
 	"hash/fnv"
 	"interpreter/ast"
+	"interpreter/token"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
@@ -15,15 +19,21 @@ type ObjectType string
 // ObjectType 可能的值
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE" // 包裹其他 Object 的 Object，用于 return 语句
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
-	BUILTIN_OBJ      = "BUILTIN" // 内置函数
-	ARRAY_OBJ        = "ARRAY"   // 数组
-	HASH_OBJ         = "HASH"    // 映射表/Map
+	BUILTIN_OBJ      = "BUILTIN"   // 内置函数
+	ARRAY_OBJ        = "ARRAY"     // 数组
+	HASH_OBJ         = "HASH"      // 映射表/Map
+	RANGE_OBJ        = "RANGE"     // 整数区间，由内置函数 range() 创建
+	BREAK_OBJ        = "BREAK"     // 用于 break 语句，向外传递直到所在的循环
+	CONTINUE_OBJ     = "CONTINUE"  // 用于 continue 语句，向外传递直到所在的循环
+	MODULE_OBJ       = "MODULE"    // 由 import 语句导入的模块
+	TAIL_CALL_OBJ    = "TAIL_CALL" // 处于尾部位置的函数调用，向外传递直到所在函数的调用者
 )
 
 type Object interface {
@@ -31,8 +41,19 @@ type Object interface {
 	Inspect() string
 }
 
+// 整数。通常使用 int64 表示，当值超出 int64 的范围时自动改用大整数（big.Int）表示
 type Integer struct {
 	Value int64
+	Big   *big.Int // 超出 int64 范围的值，此时 Value 字段无意义；值在 int64 范围之内时为 nil
+}
+
+// 由 big.Int 构造整数，如果值在 int64 的范围之内，则改用 int64 表示。
+// 注意参数 b 会被整数对象引用，调用者之后不能再修改它
+func NewBigInteger(b *big.Int) *Integer {
+	if b.IsInt64() {
+		return &Integer{Value: b.Int64()}
+	}
+	return &Integer{Big: b}
 }
 
 func (i *Integer) Type() ObjectType {
@@ -40,9 +61,37 @@ func (i *Integer) Type() ObjectType {
 }
 
 func (i *Integer) Inspect() string {
+	if i.Big != nil {
+		return i.Big.String()
+	}
 	return fmt.Sprintf("%d", i.Value)
 }
 
+// 以 big.Int 的形式返回整数的值，返回值不能被修改
+func (i *Integer) BigValue() *big.Int {
+	if i.Big != nil {
+		return i.Big
+	}
+	return big.NewInt(i.Value)
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return ObjectType(FLOAT_OBJ)
+}
+
+// 浮点数总是带有小数点或者指数，以便跟整数区分，比如 3.0、1e+21
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") { // 排除 +Inf、-Inf 和 NaN
+		s += ".0"
+	}
+	return s
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -82,31 +131,119 @@ type ReturnValue struct {
 func (r *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (r *ReturnValue) Inspect() string  { return r.Value.Inspect() }
 
+// break 语句的求值结果，跟 ReturnValue 一样沿着语句块向外传递，直到所在的循环
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+// continue 语句的求值结果，沿着语句块向外传递，直到所在的循环
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// 处于尾部位置的函数调用的求值结果：此时并不调用函数，而是跟 ReturnValue 一样向外传递到
+// 所在函数的调用者，由调用者在同一层 Go 调用里循环地执行（trampoline），所以尾递归不会增加调用栈的深度
+type TailCall struct {
+	Function  Object
+	Arguments []Object
+	Self      Object // 方法调用的接收者，不是方法调用时为 nil
+	Call      *ast.CallExpression
+}
+
+func (t *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (t *TailCall) Inspect() string  { return "tail call " + t.Call.String() }
+
+// 错误的种类，脚本可以在 catch 里根据种类区分不同的错误
+type ErrorKind string
+
+const (
+	ERROR            ErrorKind = "Error"           // throw 抛出的一般错误
+	TYPE_ERROR       ErrorKind = "TypeError"       // 类型不匹配、参数数量不对等
+	NAME_ERROR       ErrorKind = "NameError"       // 标识符不存在、重复声明、给常量赋值等
+	INDEX_ERROR      ErrorKind = "IndexError"      // 索引超出范围
+	KEY_ERROR        ErrorKind = "KeyError"        // 映射表缺少 key
+	VALUE_ERROR      ErrorKind = "ValueError"      // 类型正确但是值不合适，比如无法转换为数字的字符串
+	ARITHMETIC_ERROR ErrorKind = "ArithmeticError" // 除以零、整数溢出
+	IMPORT_ERROR     ErrorKind = "ImportError"     // 找不到模块、模块有语法错误、循环导入等
+	RECURSION_ERROR  ErrorKind = "RecursionError"  // 函数调用的层数超出限制
+	INTERNAL_ERROR   ErrorKind = "InternalError"   // 解释器内部错误
+)
+
 type Error struct {
+	Kind    ErrorKind
+	Message string
+	Pos     token.Position // 出错的位置，由求值器在错误向上传递时填入
+	End     token.Position
+	Labels  []ErrorLabel // 跟错误相关的其他位置，比如被调用函数的定义位置
+	Trace   []StackFrame // 发生错误时的调用栈，最内层的调用在前
+}
+
+// 调用栈中的一帧
+type StackFrame struct {
+	Function string         // 被调用的函数的名称
+	Pos      token.Position // 调用的位置
+}
+
+// 错误的附加标签，用于指出跟错误相关的其他位置
+type ErrorLabel struct {
+	Pos     token.Position
+	End     token.Position
 	Message string
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
 
 type Function struct {
-	Parameters []*ast.Identifier
+	Parameters []ast.Pattern
+	Defaults   []ast.Expression // 参数的默认值，在调用函数时求值
+	Rest       *ast.Identifier  // 剩余参数，多出来的实参以数组的形式赋值给它
 	Body       *ast.BlockStatement
 	Env        *Environment // 记录定义函数时的 `环境`，执行 Body 时使用这个 `环境`，实现静态范围 static scope
+	Name       string       // 函数名称，匿名函数为空字符串
+
+	Pos token.Position // 函数字面量（即 fn 关键字）的位置，用于报告错误
+	End token.Position
+}
+
+// 函数对象。除了树遍历求值器直接使用 *Function 以外，其他执行引擎在 *Function 的基础上
+// 附加各自执行函数所需的数据（比如字节码虚拟机的闭包），Definition 返回函数的定义
+type FunctionObject interface {
+	Object
+	Definition() *Function
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
-func (f *Function) Inspect() string {
-	var out bytes.Buffer
-	params := []string{}
 
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+func (f *Function) Definition() *Function { return f }
+
+// 函数接受的实参数量范围，对于带有剩余参数的函数，max 为 -1
+func (f *Function) Arity() (min int, max int) {
+	for i := range f.Parameters {
+		if i >= len(f.Defaults) || f.Defaults[i] == nil {
+			min = i + 1
+		}
 	}
 
+	if f.Rest != nil {
+		return min, -1
+	}
+	return min, len(f.Parameters)
+}
+
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
 	out.WriteString("fn")
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.FormatParameters(f.Parameters, f.Defaults, f.Rest))
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
@@ -114,6 +251,23 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// 字节码虚拟机的全局变量，以槽位为下标，由同一个程序（主程序或者模块）里创建的函数共享
+type Globals struct {
+	Values    []Object // 尚未声明的全局变量为 nil
+	Constants []bool   // 使用 const 声明的全局变量
+	Names     []string // 全局变量的名称，用于错误信息以及导出模块的标识符
+}
+
+// 全局变量 name 是否已经声明
+func (g *Globals) Declared(name string) bool {
+	for i, n := range g.Names {
+		if n == name {
+			return g.Values[i] != nil
+		}
+	}
+	return false
+}
+
 // 内置函数
 type BuiltinFunction func(args ...Object) Object
 
@@ -141,7 +295,66 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
-// Map 的 Key，当前只支持 Boolean/Integer/String 作为 Key 的值
+// 模块，即被导入的脚本文件。模块只在第一次被导入时求值，
+// 它的顶层环境里只有使用 export 导出的标识符可以被外部访问
+type Module struct {
+	Path    string          // 模块文件的路径
+	Env     *Environment    // 模块的顶层环境
+	Exports map[string]bool // 导出的标识符
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module(" + m.Path + ")" }
+
+// 获取模块导出的标识符的值
+func (m *Module) Export(name string) (Object, bool) {
+	if !m.Exports[name] {
+		return nil, false
+	}
+	return m.Env.Get(name)
+}
+
+// 整数区间 [Start, End)，步长为 Step（不为 0，可以是负数）。
+// 区间不会预先生成所有元素，所以可以表示很大的区间
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", r.Start, r.End)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+// 区间的元素个数。使用无符号整数计算，以免区间跨度超出 int64 的范围时溢出
+func (r *Range) Len() uint64 {
+	var span, step uint64
+	switch {
+	case r.Step > 0 && r.Start < r.End:
+		span, step = uint64(r.End-r.Start), uint64(r.Step)
+	case r.Step < 0 && r.Start > r.End:
+		span, step = uint64(r.Start-r.End), -uint64(r.Step)
+	default:
+		return 0
+	}
+
+	n := span / step
+	if span%step != 0 {
+		n += 1
+	}
+	return n
+}
+
+// 区间的第 i 个元素
+func (r *Range) At(i uint64) int64 {
+	return int64(uint64(r.Start) + i*uint64(r.Step))
+}
+
+// Map 的 Key，当前只支持 Boolean/Integer/Float/String 作为 Key 的值
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
@@ -151,6 +364,9 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// 超出 int64 范围的整数的 key 的类型，它的值是哈希值，使用单独的类型以免跟 int64 范围内的整数的 key 相同
+const bigIntegerKey ObjectType = "BIG_INTEGER"
+
 func (b *Boolean) HashKey() HashKey {
 	var value uint64
 	if b.Value {
@@ -162,9 +378,28 @@ func (b *Boolean) HashKey() HashKey {
 }
 
 func (i *Integer) HashKey() HashKey {
+	if i.Big != nil {
+		h := fnv.New64a()
+		if i.Big.Sign() < 0 {
+			h.Write([]byte{'-'})
+		}
+		h.Write(i.Big.Bytes())
+		return HashKey{Type: bigIntegerKey, Value: h.Sum64()}
+	}
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// 值为整数的浮点数（比如 1.0）跟对应的整数（1）是同一个 key，
+// 其他浮点数按照其二进制表示作为 key。
+// 注意 NaN 不等于任何值（包括自身），所以不能作为 key，由求值器检查。
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		b, _ := big.NewFloat(f.Value).Int(nil)
+		return NewBigInteger(b).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -1,7 +1,10 @@
 // original from https://interpreterbook.com/
 package object
 
-import "testing"
+import (
+	"math/big"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -18,3 +21,90 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	if (&Float{Value: 2.0}).HashKey() != (&Integer{Value: 2}).HashKey() {
+		t.Errorf("integral float and integer with same value have different hash keys")
+	}
+	if (&Float{Value: 0.0}).HashKey() != (&Float{Value: -0.0}).HashKey() {
+		t.Errorf("0.0 and -0.0 have different hash keys")
+	}
+	if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+	if (&Float{Value: 1.5}).HashKey() == (&Float{Value: 2.5}).HashKey() {
+		t.Errorf("floats with different value have same hash keys")
+	}
+	if (&Float{Value: 1e300}).HashKey() == (&Integer{Value: 0}).HashKey() {
+		t.Errorf("large float collides with integer hash key")
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	b1, _ := new(big.Int).SetString("99999999999999999999", 10)
+	b2, _ := new(big.Int).SetString("99999999999999999999", 10)
+	neg := new(big.Int).Neg(b1)
+
+	if NewBigInteger(b1).HashKey() != NewBigInteger(b2).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if NewBigInteger(b1).HashKey() == NewBigInteger(neg).HashKey() {
+		t.Errorf("big integers with different sign have same hash keys")
+	}
+	if NewBigInteger(big.NewInt(42)).HashKey() != (&Integer{Value: 42}).HashKey() {
+		t.Errorf("small big.Int is not demoted to int64")
+	}
+
+	// 大整数的哈希值不能跟数值相同的 int64 整数的 key 相同
+	collision := &Integer{Value: int64(NewBigInteger(b1).HashKey().Value)}
+	if NewBigInteger(b1).HashKey() == collision.HashKey() {
+		t.Errorf("big integer collides with integer %d", collision.Value)
+	}
+	if (&Float{Value: 1e20}).HashKey() != NewBigInteger(new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil)).HashKey() {
+		t.Errorf("integral float and big integer with same value have different hash keys")
+	}
+}
+
+func TestSlotEnvironment(t *testing.T) {
+	global := NewEnvironment()
+	global.Declare("g", &Integer{Value: 0}, false)
+
+	outer := NewSlotEnvironment(global, 2)
+	outer.SetReceiver(&String{Value: "receiver"})
+	inner := NewSlotEnvironment(outer, 1)
+
+	if !outer.DeclareAt(1, &Integer{Value: 1}) {
+		t.Fatalf("expected slot 1 to be declared")
+	}
+	if outer.DeclareAt(1, &Integer{Value: 2}) {
+		t.Errorf("expected redeclaration of slot 1 to fail")
+	}
+
+	if obj, ok := inner.GetAt(1, 1); !ok || obj.(*Integer).Value != 1 {
+		t.Errorf("expected slot 1 of outer environment to be 1, actual %v", obj)
+	}
+	if _, ok := inner.GetAt(1, 0); ok {
+		t.Errorf("expected slot 0 of outer environment to be undeclared")
+	}
+
+	if !inner.AssignAt(1, 1, &Integer{Value: 3}) {
+		t.Errorf("expected assignment to slot 1 of outer environment to succeed")
+	}
+	if inner.AssignAt(0, 0, &Integer{Value: 3}) {
+		t.Errorf("expected assignment to undeclared slot to fail")
+	}
+
+	if inner.Global() != global {
+		t.Errorf("expected global environment to be the outermost one")
+	}
+	if _, ok := inner.Global().Get("g"); !ok {
+		t.Errorf("expected global variable g")
+	}
+
+	if _, ok := inner.Receiver(1); ok {
+		t.Errorf("expected no receiver in the innermost environment")
+	}
+	if receiver, ok := inner.Receiver(-1); !ok || receiver.Inspect() != "receiver" {
+		t.Errorf("expected receiver of outer environment, actual %v", receiver)
+	}
+}
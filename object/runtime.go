@@ -0,0 +1,20 @@
+package object
+
+// 一次运行（执行一个脚本，或者一个 REPL 会话）的配置和状态，由执行引擎以及它加载的所有模块共用。
+// 不同的执行引擎创建的函数不能混用，所以每个执行引擎使用各自的 Runtime
+type Runtime struct {
+	Strict bool // 严格模式：整数运算溢出 int64 范围时报告错误，而不是自动转换为大整数
+
+	// 模块的查找路径。import 语句里的相对路径首先相对于导入者所在的目录查找，
+	// 找不到时再依次在这些目录里查找
+	SearchPath []string
+
+	Modules map[string]*Module // 已经加载的模块，以模块文件的绝对路径为 key，每个模块只执行一次
+	Loading []string           // 正在加载的模块（绝对路径）组成的导入链，用于检测循环导入
+
+	CallDepth int // 正在执行的函数调用的层数（不包括尾调用），见 core.EnterCall
+}
+
+func NewRuntime() *Runtime {
+	return &Runtime{Modules: map[string]*Module{}}
+}
@@ -5,8 +5,11 @@ package parser
 import (
 	"fmt"
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
 	"interpreter/token"
+	"math/big"
+	"sort"
 	"strconv"
 )
 
@@ -14,6 +17,7 @@ import (
 const (
 	_           int = iota
 	LOWEST          // 最低优先级，比如从 “语句” 进来的 "表达式" 解析阶段。
+	ASSIGN          // =, +=, -=, ...
 	LOGICOR         // ||
 	LOGICAND        // &&
 	EQUALS          // ==
@@ -28,6 +32,13 @@ const (
 
 // 各个运算符 token 对应的优先级
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:          ASSIGN, // =
+	token.PLUS_ASSIGN:     ASSIGN, // +=
+	token.MINUS_ASSIGN:    ASSIGN, // -=
+	token.ASTERISK_ASSIGN: ASSIGN, // *=
+	token.SLASH_ASSIGN:    ASSIGN, // /=
+	token.PERCENT_ASSIGN:  ASSIGN, // %=
+
 	token.AND: LOGICAND, // &&
 	token.OR:  LOGICOR,  // ||
 
@@ -40,6 +51,7 @@ var precedences = map[token.TokenType]int{
 	token.PLUS:     SUM,     // +
 	token.MINUS:    SUM,     // -
 	token.SLASH:    PRODUCT, // /
+	token.PERCENT:  PRODUCT, // %
 	token.ASTERISK: PRODUCT, // *
 
 	token.LPAREN:   CALL,  // (
@@ -85,7 +97,16 @@ type Parser struct {
 	curToken  token.Token // current token
 	peekToken token.Token // next token
 
-	errors []string
+	errors []diagnostic.Diagnostic
+
+	// 恐慌模式（panic mode），遇到语法错误之后进入此模式，在此模式中
+	// 不再记录新的错误，直到跳到下一条语句的开始位置（见 synchronize 方法），
+	// 以避免一个错误引起一连串莫名其妙的后续错误。
+	panicMode bool
+
+	braceDepth int // 到当前 token 为止（包括当前 token）的花括号嵌套深度，用于错误恢复
+
+	loopDepth int // 当前所在的循环的嵌套深度，用于检查 break/continue 是否位于循环之内
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -102,7 +123,7 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []diagnostic.Diagnostic{},
 	}
 
 	// 读两次，让 current token 和 peek token 都赋予值
@@ -115,9 +136,13 @@ func New(l *lexer.Lexer) *Parser {
 	// 注册 primary 表达式（字面量、标识符等）解析过程
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_HEAD, p.parseInterpolatedString) // 插值字符串 "...${...}..."
+
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal) // 不明字符，由 lexer 报告错误
 
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression) // 表达式括号 (...)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)    // 数组字面量中括号 [...]
@@ -125,6 +150,8 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefix(token.IF, p.parseIfExpression)             // 当前 toy lang 里，if 是表达式（而不是语句）
 	p.registerPrefix(token.FUNCTION, p.parseFunctionExpression) // 当前 toy lang 里，fn 是表达式
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)       // match 也是表达式
+	p.registerPrefix(token.TRY, p.parseTryExpression)           // try 也是表达式
 
 	// 注册一元操作符解析过程
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)  // !
@@ -136,6 +163,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)    // -
 	p.registerInfix(token.SLASH, p.parseInfixExpression)    // /
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression) // *
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)  // %
 	p.registerInfix(token.EQ, p.parseInfixExpression)       // ==
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)   // "!="
 	p.registerInfix(token.LT, p.parseInfixExpression)       // <
@@ -144,6 +172,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.AND, p.parseInfixExpression) // &&
 	p.registerInfix(token.OR, p.parseInfixExpression)  // ||
 
+	// 注册赋值运算符解析过程
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)          // =
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)     // +=
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)    // -=
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression) // *=
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)    // /=
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)  // %=
+
 	// 解析函数调用和索引
 	//p.registerInfix(token.LPAREN, p.parseCallExpression // "(...)"
 	//p.registerInfix(token.LBRACKET, p.parseIndexExpression) // "[...]"
@@ -151,20 +187,84 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
-func (p *Parser) Errors() []string {
-	return p.errors
+// 返回词法分析和语法分析过程中发现的错误，按照出现的位置排序
+func (p *Parser) Errors() []diagnostic.Diagnostic {
+	errors := []diagnostic.Diagnostic{}
+	errors = append(errors, p.l.Errors()...)
+	errors = append(errors, p.errors...)
+
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Span.Start.Offset < errors[j].Span.Start.Offset
+	})
+	return errors
+}
+
+// 记录一个位于 token tk 的语法错误，并进入恐慌模式
+func (p *Parser) errorAt(tk token.Token, expected []token.TokenType, format string, a ...interface{}) {
+	if p.panicMode {
+		return // 忽略同一条语句里的后续错误
+	}
+	p.panicMode = true
+
+	// 未结束的字符串（比如插值表达式 "${x 没有结束）已经由 lexer 报告了错误，不再报告由它引起的错误
+	if tk.Type == token.EOF && p.l.Unterminated() {
+		return
+	}
+
+	p.errors = append(p.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     diagnostic.TokenSpan(tk),
+		Message:  fmt.Sprintf(format, a...),
+		Expected: expected,
+	})
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token type %q, actual %q",
+	p.errorAt(p.peekToken, []token.TokenType{t},
+		"expected next token type %q, actual %q",
 		t,
 		p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+}
+
+// 从语法错误中恢复：跳过 token 直到出错语句的末尾，即当前 token 为 ";"，
+// 或者下一个 token 是 "}"、"let"、"return" 等可以结束语句块或者开始新语句的 token。
+//
+// depth 是出错语句开始时的花括号嵌套深度，只有回到这个深度时才停止，
+// 以免停在出错语句内部（比如映射表字面量里）的 "}" 或者 "let" 等 token 上。
+func (p *Parser) synchronize(depth int) {
+	p.panicMode = false
+
+	for !p.curTokenIs(token.EOF) {
+		if p.braceDepth < depth {
+			return // 当前 token 是包含出错语句的语句块的 "}"
+		}
+
+		if p.braceDepth == depth {
+			if p.curTokenIs(token.SEMICOLON) {
+				return
+			}
+
+			switch p.peekToken.Type {
+			case token.LET, token.CONST, token.RETURN, token.THROW, token.IMPORT, token.EXPORT, token.WHILE, token.FOR, token.BREAK, token.CONTINUE,
+				token.RBRACE, token.EOF:
+				return
+			}
+		}
+
+		p.nextToken()
+	}
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braceDepth += 1
+	case token.RBRACE:
+		p.braceDepth -= 1
+	}
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -191,8 +291,11 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
+		depth := p.braceDepth
 		statement := p.parseStatement()
-		if statement != nil {
+		if p.panicMode {
+			p.synchronize(depth) // 丢弃出错的语句
+		} else if statement != nil {
 			program.Statements = append(program.Statements, statement)
 		}
 
@@ -207,24 +310,140 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
-	statement := &ast.LetStatement{Token: p.curToken}
+// while (<condition>) { <body> }
+func (p *Parser) parseWhileStatement() ast.Statement {
+	statement := &ast.WhileStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
+	// 移动到 "("
+	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	statement.Name = &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
+	p.nextToken()
+
+	statement.Condition = p.parseExpression(LOWEST)
+	if statement.Condition == nil {
+		return nil
+	}
+
+	// 移动到 ")"，然后移动到 "{"
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	statement.Body = p.parseLoopBody()
+
+	// 循环语句之后的 ";" 是可省的
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	// 当前 token 处于 "}" 或者 ";" 符号上
+	return statement
+}
+
+// for (<variable> in <iterable>) { <body> }
+func (p *Parser) parseForStatement() ast.Statement {
+	statement := &ast.ForStatement{Token: p.curToken}
+
+	// 移动到 "("，然后移动到循环变量
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	statement.Variable = p.parseIdentifier().(*ast.Identifier)
+
+	// 移动到 "in"
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+
+	statement.Iterable = p.parseExpression(LOWEST)
+	if statement.Iterable == nil {
+		return nil
+	}
+
+	// 移动到 ")"，然后移动到 "{"
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	statement.Body = p.parseLoopBody()
+
+	// 循环语句之后的 ";" 是可省的
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	// 当前 token 处于 "}" 或者 ";" 符号上
+	return statement
+}
+
+// 解析循环体，当前 token 为 "{"
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth += 1
+	defer func() { p.loopDepth -= 1 }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+	statement := &ast.BreakStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.errorAt(p.curToken, nil, "break statement outside of loop")
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	statement := &ast.ContinueStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.errorAt(p.curToken, nil, "continue statement outside of loop")
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseLetStatement() *ast.LetStatement {
+	statement := &ast.LetStatement{
+		Token:    p.curToken,
+		Constant: p.curTokenIs(token.CONST),
+	}
+
+	statement.Name = p.parseBindingPattern()
+	if statement.Name == nil {
+		return nil
 	}
 
 	if !p.expectPeek(token.ASSIGN) {
@@ -241,6 +460,13 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	statement.Value = p.parseExpression(LOWEST)
 
+	// 记录函数的名称，用于调用栈等
+	if fl, ok := statement.Value.(*ast.FunctionLiteral); ok {
+		if name, ok := statement.Name.(*ast.Identifier); ok {
+			fl.Name = name.Value
+		}
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -270,6 +496,137 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return statement
 }
 
+// import "<path>" as <alias>;
+// import { <name>, <name> as <local>, ... } from "<path>";
+// import "<path>";
+//
+// 其中 "as" 和 "from" 只在 import 语句里有特殊含义，在其他地方仍然可以作为标识符
+func (p *Parser) parseImportStatement() ast.Statement {
+	statement := &ast.ImportStatement{Token: p.curToken}
+
+	switch p.peekToken.Type {
+	case token.STRING:
+		p.nextToken()
+		statement.Path = p.parseStringLiteral().(*ast.StringLiteral)
+
+		if p.peekIdentifierIs("as") {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			statement.Alias = p.parseIdentifier().(*ast.Identifier)
+		}
+
+	case token.LBRACE:
+		p.nextToken()
+
+		for !p.peekTokenIs(token.RBRACE) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			name := p.parseIdentifier().(*ast.Identifier)
+			local := name
+
+			if p.peekIdentifierIs("as") {
+				p.nextToken()
+				if !p.expectPeek(token.IDENT) {
+					return nil
+				}
+				local = p.parseIdentifier().(*ast.Identifier)
+			}
+
+			statement.Names = append(statement.Names, name)
+			statement.Locals = append(statement.Locals, local)
+
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+
+		// 移动到 "}"
+		p.nextToken()
+
+		if len(statement.Names) == 0 {
+			p.errorAt(p.curToken, []token.TokenType{token.IDENT}, "expected at least one name to import")
+			return nil
+		}
+
+		if !p.peekIdentifierIs("from") {
+			p.errorAt(p.peekToken, nil, "expected \"from\" after import list, actual %q", p.peekToken.Literal)
+			return nil
+		}
+		p.nextToken()
+
+		if !p.expectPeek(token.STRING) {
+			return nil
+		}
+		statement.Path = p.parseStringLiteral().(*ast.StringLiteral)
+
+	default:
+		p.errorAt(p.peekToken, []token.TokenType{token.STRING, token.LBRACE},
+			"expected a module path or an import list, actual %q", p.peekToken.Type)
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	// 当前 token 停留在 ';' 位置
+	return statement
+}
+
+// export let <name> = <expression>;
+// export const <name> = <expression>;
+func (p *Parser) parseExportStatement() ast.Statement {
+	statement := &ast.ExportStatement{Token: p.curToken}
+
+	// 只能导出模块顶层的标识符
+	if p.braceDepth != 0 {
+		p.errorAt(p.curToken, nil, "export statement must be at the top level")
+		return nil
+	}
+
+	if !p.peekTokenIs(token.LET) && !p.peekTokenIs(token.CONST) {
+		p.errorAt(p.peekToken, []token.TokenType{token.LET, token.CONST},
+			"expected let or const after export, actual %q", p.peekToken.Type)
+		return nil
+	}
+	p.nextToken()
+
+	statement.Statement = p.parseLetStatement()
+	if statement.Statement == nil {
+		return nil
+	}
+
+	// 当前 token 停留在 ';' 位置
+	return statement
+}
+
+// 判断下一个 token 是否指定名称的标识符，用于 "as"、"from" 等上下文关键字
+func (p *Parser) peekIdentifierIs(name string) bool {
+	return p.peekTokenIs(token.IDENT) && p.peekToken.Literal == name
+}
+
+// throw <expression>;
+func (p *Parser) parseThrowStatement() ast.Statement {
+	statement := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	statement.Value = p.parseExpression(LOWEST)
+	if statement.Value == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	// 当前 token 停留在 ';' 位置
+	return statement
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	statement := &ast.ExpressionStatement{
 		Token: p.curToken,
@@ -317,6 +674,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		} else if p.peekTokenIs(token.LBRACKET) {
 			p.nextToken()
 			leftExp = p.parseIndexExpression(leftExp)
+		} else if p.peekTokenIs(token.DOT) {
+			p.nextToken()
+			leftExp = p.parseMemberExpression(leftExp)
 		} else {
 			break
 		}
@@ -409,9 +769,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if err == nil {
+		literal.Value = value
+		return literal
+	}
+
+	// 超出 int64 范围的整数，使用大整数表示
+	if b, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+		literal.Big = b
+		return literal
+	}
+
+	p.errorAt(p.curToken, nil, "could not parse %q as integer", p.curToken.Literal)
+	return nil
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{
+		Token: p.curToken,
+	}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, nil, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 
@@ -419,6 +799,33 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return literal
 }
 
+// 解析插值字符串，当前 token 为 TEMPLATE_HEAD，结束时当前 token 为 TEMPLATE_TAIL
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	expr := &ast.InterpolatedString{Token: p.curToken}
+	expr.Parts = append(expr.Parts, p.parseStringLiteral())
+
+	for {
+		p.nextToken() // 跳过字符串片段
+		part := p.parseExpression(LOWEST)
+		if part == nil {
+			return nil
+		}
+		expr.Parts = append(expr.Parts, part)
+
+		if p.peekTokenIs(token.TEMPLATE_MIDDLE) {
+			p.nextToken()
+			expr.Parts = append(expr.Parts, p.parseStringLiteral())
+			continue
+		}
+
+		if !p.expectPeek(token.TEMPLATE_TAIL) {
+			return nil
+		}
+		expr.Parts = append(expr.Parts, p.parseStringLiteral())
+		return expr
+	}
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	literal := &ast.Boolean{
 		Token: p.curToken,
@@ -483,6 +890,13 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 		value := p.parseExpression(LOWEST)
 
+		// 以字符串为 key 的函数（即方法）使用 key 作为函数的名称，用于调用栈等
+		if fl, ok := value.(*ast.FunctionLiteral); ok {
+			if name, ok := key.(*ast.StringLiteral); ok {
+				fl.Name = name.Value
+			}
+		}
+
 		hash.Pairs[key] = value
 
 		// 下一个应该是 "," 或者 "}"
@@ -498,9 +912,14 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+// 不明字符已经由 lexer 记录了错误，这里只需进入恐慌模式以跳过当前语句
+func (p *Parser) parseIllegal() ast.Expression {
+	p.panicMode = true
+	return nil
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %q found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, nil, "expected an expression, actual %q", t)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -530,12 +949,38 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// 赋值表达式，赋值运算符是右结合的，即 "a = b = 1" 等同于 "a = (b = 1)"
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression, *ast.MemberExpression:
+	default:
+		p.errorAt(p.curToken, nil, "invalid assignment target: %s", target.String())
+		return nil
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+
+	expression.Value = p.parseExpression(precedence - 1)
+	if expression.Value == nil {
+		return nil
+	}
+	return expression
+}
+
 // if (<condition>) <consequence> else <alternative>
 // <consequence> = <block statement>
-// <alternative> = <block statement>
+// <alternative> = <block statement> | <if expression>
 //
 // e.g.
 // "if (x > y) { x } else { y };"
+// "if (x > 0) { 1 } else if (x < 0) { -1 } else { 0 };"
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 
@@ -565,6 +1010,25 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		// 移动到 ELSE
 		p.nextToken()
 
+		// else if 链，把后面的 if 表达式包装成只有一条语句的语句块
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			ifToken := p.curToken
+
+			alternative := p.parseIfExpression()
+			if alternative == nil {
+				return nil
+			}
+
+			expression.Alternative = &ast.BlockStatement{
+				Token: ifToken,
+				Statements: []ast.Statement{
+					&ast.ExpressionStatement{Token: ifToken, Expression: alternative},
+				},
+			}
+			return expression
+		}
+
 		// 移动到 "{"
 		if !p.expectPeek(token.LBRACE) {
 			return nil
@@ -577,6 +1041,291 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// try <block statement> catch (<pattern>) <block statement> finally <block statement>
+//
+// catch 的参数可以省略，即 "catch { ... }"，catch 和 finally 至少要有一个
+// e.g.
+// "try { risky() } catch (e) { e.message }"
+// "try { risky() } finally { cleanup() }"
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	// 移动到 "{"
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			expression.Parameter = p.parseBindingPattern()
+			if expression.Parameter == nil || !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+
+		// 移动到 "{"
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		// 移动到 "{"
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.errorAt(p.peekToken, []token.TokenType{token.CATCH, token.FINALLY},
+			"expected catch or finally after try block, actual %q", p.peekToken.Type)
+		return nil
+	}
+
+	// 当前 token 处于 "}" 符号上
+	return expression
+}
+
+// match (<subject>) { <pattern> => <body>, ... }
+// <body> = <block statement> | <expression>
+//
+// e.g.
+// "match (x) { 0 => "zero", [a, ...rest] => { a }, _ => "other" }"
+//
+// 注意分支的 body 以 "{" 开始时视为语句块，如果要返回映射表字面量，需要加上括号。
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	// 移动到 "("
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	expression.Subject = p.parseExpression(LOWEST)
+	if expression.Subject == nil {
+		return nil
+	}
+
+	// 移动到 ")"，然后移动到 "{"
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		// 移动到 "=>"，然后移动到 body 的第一个 token
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.nextToken()
+
+		if p.curTokenIs(token.LBRACE) {
+			arm.Body = p.parseBlockStatement()
+		} else {
+			bodyToken := p.curToken
+			body := p.parseExpression(LOWEST)
+			if body == nil {
+				return nil
+			}
+			arm.Body = &ast.BlockStatement{
+				Token: bodyToken,
+				Statements: []ast.Statement{
+					&ast.ExpressionStatement{Token: bodyToken, Expression: body},
+				},
+			}
+		}
+
+		expression.Arms = append(expression.Arms, arm)
+
+		// 分支之间使用 "," 分隔，语句块形式的 body 之后的 "," 可以省略
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !p.curTokenIs(token.RBRACE) && !p.peekTokenIs(token.RBRACE) {
+			p.peekError(token.COMMA)
+			return nil
+		}
+	}
+
+	// 移动到 "}"
+	p.nextToken()
+
+	return expression
+}
+
+// 解析 let 语句和函数参数里的绑定模式，即标识符、数组模式或者映射表模式，
+// 当前 token 为模式之前的 token，结束时当前 token 为模式的最后一个 token
+func (p *Parser) parseBindingPattern() ast.Pattern {
+	switch p.peekToken.Type {
+	case token.IDENT, token.LBRACKET, token.LBRACE:
+		p.nextToken()
+		return p.parsePattern()
+	default:
+		p.errorAt(p.peekToken, []token.TokenType{token.IDENT, token.LBRACKET, token.LBRACE},
+			"expected an identifier or a destructuring pattern, actual %q", p.peekToken.Type)
+		return nil
+	}
+}
+
+// 解析模式，当前 token 为模式的第一个 token
+//
+//	x, _                       标识符（绑定）和通配符
+//	1, -2.5, "a", true         字面量
+//	[a, b, ...rest]            数组
+//	{"key": pattern, name}     映射表
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return p.parseIdentifier().(*ast.Identifier)
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.MINUS:
+		return p.parseLiteralPattern()
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		p.errorAt(p.curToken, nil, "expected a pattern, actual %q", p.curToken.Type)
+		return nil
+	}
+}
+
+func (p *Parser) parseLiteralPattern() ast.Pattern {
+	pattern := &ast.LiteralPattern{Token: p.curToken}
+
+	// 负数 -1 和 -2.5
+	if p.curTokenIs(token.MINUS) {
+		if !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.FLOAT) {
+			p.errorAt(p.peekToken, []token.TokenType{token.INT, token.FLOAT},
+				"expected a number after \"-\" in pattern, actual %q", p.peekToken.Type)
+			return nil
+		}
+
+		expression := &ast.PrefixExpression{Token: p.curToken, Operator: "-"}
+		p.nextToken()
+		expression.Right = p.prefixParseFns[p.curToken.Type]()
+		if expression.Right == nil {
+			return nil
+		}
+		pattern.Value = expression
+		return pattern
+	}
+
+	// 只解析字面量本身，不解析后面的运算符
+	pattern.Value = p.prefixParseFns[p.curToken.Type]()
+	if pattern.Value == nil {
+		return nil
+	}
+	return pattern
+}
+
+// [<pattern>, <pattern>, ...<identifier>]
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	// 当前位于 token "["
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = p.parseIdentifier().(*ast.Identifier)
+
+			if !p.peekTokenIs(token.RBRACKET) {
+				p.errorAt(p.peekToken, []token.TokenType{token.RBRACKET},
+					"rest element must be the last element")
+				return nil
+			}
+			break
+		}
+
+		p.nextToken()
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	// 移动到 "]"
+	p.nextToken()
+
+	return pattern
+}
+
+// {<key>: <pattern>, <identifier>, ...}
+// 简写形式 {name} 等同于 {"name": name}
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	// 当前位于 token "{"
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		if p.curTokenIs(token.IDENT) && !p.peekTokenIs(token.COLON) {
+			identifier := p.parseIdentifier().(*ast.Identifier)
+			pattern.Keys = append(pattern.Keys, &ast.StringLiteral{Token: p.curToken, Value: identifier.Value})
+			pattern.Values = append(pattern.Values, identifier)
+
+		} else {
+			switch p.curToken.Type {
+			case token.STRING, token.INT, token.FLOAT, token.TRUE, token.FALSE:
+			default:
+				p.errorAt(p.curToken, nil, "expected a literal hash pattern key, actual %q", p.curToken.Type)
+				return nil
+			}
+
+			key := p.prefixParseFns[p.curToken.Type]()
+			if key == nil {
+				return nil
+			}
+
+			// 移动到 ":"，然后移动到值的模式
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+
+			value := p.parsePattern()
+			if value == nil {
+				return nil
+			}
+
+			pattern.Keys = append(pattern.Keys, key)
+			pattern.Values = append(pattern.Values, value)
+		}
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	// 移动到 "}"
+	p.nextToken()
+
+	return pattern
+}
+
 // {<statements>}
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken} // "{"
@@ -585,8 +1334,16 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		depth := p.braceDepth
 		statement := p.parseStatement()
-		if statement != nil {
+		if p.panicMode {
+			p.synchronize(depth)
+
+			// 出错的语句停在了 "}" 上，视为语句块的结束
+			if p.curTokenIs(token.RBRACE) {
+				break
+			}
+		} else if statement != nil {
 			block.Statements = append(block.Statements, statement)
 		}
 		p.nextToken()
@@ -611,7 +1368,9 @@ func (p *Parser) parseFunctionExpression() ast.Expression {
 	}
 
 	// 解析参数列表
-	expression.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(expression) {
+		return nil
+	}
 
 	// 当前处于 ")"，下一个 token 应该是 "{"
 
@@ -620,37 +1379,80 @@ func (p *Parser) parseFunctionExpression() ast.Expression {
 		return nil
 	}
 
+	// 函数体不属于外层的循环，即不能在函数体里 break 外层的循环
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	expression.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	// 当前 token 处于 "}" 符号上
 	return expression
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// 解析参数列表，参数有三种形式：
+//
+//	x         普通参数，也可以是解构模式，比如 [a, b] 和 {name, age}
+//	x = 1     带有默认值的参数，之后的普通参数也必须带有默认值
+//	...rest   剩余参数，只能是最后一个参数
+func (p *Parser) parseFunctionParameters(fl *ast.FunctionLiteral) bool {
+	fl.Parameters = []ast.Pattern{}
 
 	// 当前处于 "("
 
-	p.nextToken()
+	hasDefault := false
 
 	// 参数列表有可能为空
-	for !p.curTokenIs(token.RPAREN) {
-		identifier, ok := p.parseIdentifier().(*ast.Identifier)
-		if !ok {
-			return nil
+	for !p.peekTokenIs(token.RPAREN) {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			fl.Rest = p.parseIdentifier().(*ast.Identifier)
+
+			if !p.peekTokenIs(token.RPAREN) {
+				p.errorAt(p.peekToken, []token.TokenType{token.RPAREN},
+					"rest parameter must be the last parameter")
+				return false
+			}
+			break
 		}
 
-		identifiers = append(identifiers, identifier)
-
-		p.nextToken()
+		paramToken := p.peekToken
+		param := p.parseBindingPattern()
+		if param == nil {
+			return false
+		}
 
-		if p.curTokenIs(token.COMMA) {
+		var defaultValue ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
 			p.nextToken()
+			defaultValue = p.parseExpression(LOWEST)
+			if defaultValue == nil {
+				return false
+			}
+			hasDefault = true
+
+		} else if hasDefault {
+			p.errorAt(paramToken, nil,
+				"parameter %q without default value follows a parameter with default value",
+				param.String())
+			return false
+		}
+
+		fl.Parameters = append(fl.Parameters, param)
+		fl.Defaults = append(fl.Defaults, defaultValue)
+
+		if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+			return false
 		}
 	}
 
+	p.nextToken()
+
 	// 当前处于 ")"
-	return identifiers
+	return true
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
@@ -670,6 +1472,21 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return indexExpression
 }
 
+// <expression>.<identifier>
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	expression := &ast.MemberExpression{
+		Token:  p.curToken, // "."
+		Object: left,
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Property = p.parseIdentifier().(*ast.Identifier)
+
+	return expression
+}
+
 // <expression>(<comma separated expressions>)
 // e.g.
 // "add(2, 3)"
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"interpreter/ast"
 	"interpreter/lexer"
+	"interpreter/token"
 	"testing"
 )
 
@@ -81,13 +82,19 @@ func testLetStatement(t *testing.T, statement ast.Statement, identifierName stri
 		return false
 	}
 
-	if letStatement.Name.Value != identifierName { // .Name 是 *Identifier
+	name, ok := letStatement.Name.(*ast.Identifier) // .Name 是 Pattern，这里应该是 *Identifier
+	if !ok {
+		t.Errorf("letStatement.Name expected *ast.Identifier, actual %T", letStatement.Name)
+		return false
+	}
+
+	if name.Value != identifierName {
 		t.Errorf("letStatement.Name.Value expected %q, actual %q",
-			identifierName, letStatement.Name.Value)
+			identifierName, name.Value)
 		return false
 	}
 
-	if letStatement.Name.TokenLiteral() != identifierName { // .Name 是 *Identifier
+	if letStatement.Name.TokenLiteral() != identifierName {
 		t.Errorf("letStatement.Name expected %q, actual %q",
 			identifierName, letStatement.Name)
 		return false
@@ -96,6 +103,52 @@ func testLetStatement(t *testing.T, statement ast.Statement, identifierName stri
 	return true
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		constant bool
+		expected string
+	}{
+		{"const x = 5;", "x", true, "const x = 5;"},
+		{"let y = true;", "y", false, "let y = true;"},
+		{"const [a, b] = arr;", "[a, b]", true, "const [a, b] = arr;"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, actual %d", test.input, len(program.Statements))
+		}
+
+		statement, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("expected *ast.LetStatement, actual %T", program.Statements[0])
+		}
+
+		if statement.Name.String() != test.name {
+			t.Errorf("name expected %q, actual %q", test.name, statement.Name.String())
+		}
+
+		if statement.Constant != test.constant {
+			t.Errorf("%q: constant expected %t, actual %t", test.input, test.constant, statement.Constant)
+		}
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("const 1 = 2;"))
+	p.ParseProgram()
+	if len(p.Errors()) != 1 {
+		t.Errorf("expected 1 error, actual %d", len(p.Errors()))
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	// input := `
 	// 	return 1;
@@ -243,6 +296,55 @@ func TestIntegerLiteralExpression(t *testing.T) {
 
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "123456789012345678901234567890;"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := statement.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.IntegerLiteral, actual %T", statement.Expression)
+	}
+
+	if literal.Big == nil || literal.Big.String() != "123456789012345678901234567890" {
+		t.Errorf("literal.Big expected %s, actual %v", "123456789012345678901234567890", literal.Big)
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E3;", 2500},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := statement.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("expected *ast.FloatLiteral, actual %T", statement.Expression)
+		}
+
+		if literal.Value != test.expectedValue {
+			t.Errorf("literal.Value expected %g, actual %g", test.expectedValue, literal.Value)
+		}
+	}
+}
+
 func TestBooleanLiteralExpression(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -489,6 +591,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * b / c",
 			"((a * b) / c)",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
 		{
 			"a + b / c",
 			"(a + (b / c))",
@@ -692,6 +798,175 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (a) { 1 } else if (b) { 2 }", "if a 1 else if b 2"},
+		{"if (a) { 1 } else if (b) { 2 } else { 3 }", "if a 1 else if b 2 else 3"},
+		{"if (a) { 1 } else if (b) { 2 } else if (c) { 3 } else { 4 }", "if a 1 else if b 2 else if c 3 else 4"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, actual %d", test.input, len(program.Statements))
+		}
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("if (a) { 1 } else if (b) { 2 }")).ParseProgram()
+	expression := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	nested, ok := expression.Alternative.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative expected *ast.IfExpression, actual %T", expression.Alternative.Statements[0])
+	}
+	testIdentifier(t, nested.Condition, "b")
+	if nested.Alternative != nil {
+		t.Errorf("nested alternative expected nil, actual %v", nested.Alternative)
+	}
+}
+
+func TestTryExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { a } catch (e) { b }", "try a catch (e) b"},
+		{"try { a } catch { b }", "try a catch b"},
+		{"try { a } finally { c }", "try a finally c"},
+		{"try { a } catch (e) { b } finally { c }", "try a catch (e) b finally c"},
+		{"try { a } catch ({message, kind}) { message }", "try a catch ({message:message, kind:kind}) message"},
+		{"let x = try { a } catch (e) { b };", "let x = try a catch (e) b;"},
+		{`throw "boom";`, "throw boom;"},
+		{"throw {1: 2}", "throw {1:2};"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, actual %d", test.input, len(program.Statements))
+		}
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"try { a }", `expected catch or finally after try block, actual "EOF"`},
+		{"try a catch (e) { b }", `expected next token type "{", actual "IDENT"`},
+		{"try { a } catch (1) { b }", `expected an identifier or a destructuring pattern, actual "INT"`},
+		{"try { a } catch (e { b }", `expected next token type ")", actual "{"`},
+		{"try { a } finally b", `expected next token type "{", actual "IDENT"`},
+		{"throw;", `expected an expression, actual ";"`},
+	}
+
+	for _, test := range errorTests {
+		p := New(lexer.New(test.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, actual %d: %v", test.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Message != test.expectedMessage {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expectedMessage, errors[0].Message)
+		}
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 1 => "one", _ => "other" }`, "match x {1 => one, _ => other}"},
+		{"match (x) { -1 => a, 2.5 => b, true => c }", "match x {(-1) => a, 2.5 => b, true => c}"},
+		{"match (x) { [a, b] => a + b, [head, ...tail] => tail, [] => 0 }", "match x {[a, b] => (a + b), [head, ...tail] => tail, [] => 0}"},
+		{`match (x) { {"k": [v, _]} => v, {name, age} => name }`, "match x {{k:[v, _]} => v, {name:name, age:age} => name}"},
+		{"match (x) { n => { let y = n; y } _ => 0 }", "match x {n => let y = n;y, _ => 0}"},
+		{"match (f(x)) { 1 => 2, }", "match f(x) {1 => 2}"},
+		{"match (x) { }", "match x {}"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, actual %d", test.input, len(program.Statements))
+		}
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("match (x) { [a, ...rest] => a }")).ParseProgram()
+	expression, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("expected *ast.MatchExpression, actual %T", program.Statements[0])
+	}
+	testIdentifier(t, expression.Subject, "x")
+
+	pattern, ok := expression.Arms[0].Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("expected *ast.ArrayPattern, actual %T", expression.Arms[0].Pattern)
+	}
+	if len(pattern.Elements) != 1 || pattern.Rest == nil || pattern.Rest.Value != "rest" {
+		t.Errorf("unexpected array pattern %s", pattern.String())
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"match x { 1 => 2 }", `expected next token type "(", actual "IDENT"`},
+		{"match (x) { 1 2 }", `expected next token type "=>", actual "INT"`},
+		{"match (x) { 1 => 2 3 => 4 }", `expected next token type ",", actual "INT"`},
+		{"match (x) { a + 1 => 2 }", `expected next token type "=>", actual "+"`},
+		{"match (x) { (a) => 2 }", `expected a pattern, actual "("`},
+		{"match (x) { -a => 2 }", `expected a number after "-" in pattern, actual "IDENT"`},
+		{"match (x) { [...a, b] => 2 }", "rest element must be the last element"},
+		{"match (x) { {k: v} => 2 }", `expected a literal hash pattern key, actual "IDENT"`},
+		{"if (a) { 1 } else b", `expected next token type "{", actual "IDENT"`},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, actual %d: %v", test.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Message != test.expectedMessage {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expectedMessage, errors[0].Message)
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -723,8 +998,8 @@ func TestFunctionLiteralParsing(t *testing.T) {
 			len(functionLiteral.Parameters))
 	}
 
-	testLiteralExpression(t, functionLiteral.Parameters[0], "x")
-	testLiteralExpression(t, functionLiteral.Parameters[1], "y")
+	testLiteralExpression(t, functionLiteral.Parameters[0].(*ast.Identifier), "x")
+	testLiteralExpression(t, functionLiteral.Parameters[1].(*ast.Identifier), "y")
 
 	if len(functionLiteral.Body.Statements) != 1 {
 		t.Fatalf("expected function literal body 1 statement, actual %d\n",
@@ -765,11 +1040,365 @@ func TestFunctionParameterParsing(t *testing.T) {
 		}
 
 		for i, identifierName := range test.expectedParams {
-			testLiteralExpression(t, functionLiteral.Parameters[i], identifierName)
+			testLiteralExpression(t, functionLiteral.Parameters[i].(*ast.Identifier), identifierName)
+		}
+	}
+}
+
+func TestFunctionDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		rest     string
+	}{
+		{"fn(x, step = 1) {};", "fn(x, step = 1) ", ""},
+		{"fn(a = 1, b = a * 2) {};", "fn(a = 1, b = (a * 2)) ", ""},
+		{"fn(head, ...tail) {};", "fn(head, ...tail) ", "tail"},
+		{"fn(...all) {};", "fn(...all) ", "all"},
+		{"fn(x, y = 2, ...more) {};", "fn(x, y = 2, ...more) ", "more"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		functionLiteral := statement.Expression.(*ast.FunctionLiteral)
+
+		if functionLiteral.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, functionLiteral.String())
+		}
+
+		if test.rest == "" && functionLiteral.Rest != nil {
+			t.Errorf("expected no rest parameter, actual %q", functionLiteral.Rest.Value)
+		} else if test.rest != "" {
+			testIdentifier(t, functionLiteral.Rest, test.rest)
 		}
 	}
 }
 
+func TestDestructuringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = arr;", "let [a, b] = arr;"},
+		{"let [a, ...rest] = arr;", "let [a, ...rest] = arr;"},
+		{"let [[a, b], _] = arr;", "let [[a, b], _] = arr;"},
+		{"let {name, age} = person;", "let {name:name, age:age} = person;"},
+		{`let {"first": [x, y]} = h;`, "let {first:[x, y]} = h;"},
+		{"let [] = arr;", "let [] = arr;"},
+		{"fn([a, b], {c}) { a }", "fn([a, b], {c:c}) a"},
+		{"fn([a, b] = [1, 2], ...rest) { a }", "fn([a, b] = [1, 2], ...rest) a"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, actual %d", test.input, len(program.Statements))
+		}
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let 1 = 2;", `expected an identifier or a destructuring pattern, actual "INT"`},
+		{"let [a b] = arr;", `expected next token type ",", actual "IDENT"`},
+		{"let [...a, b] = arr;", "rest element must be the last element"},
+		{`let {"a": } = h;`, `expected a pattern, actual "}"`},
+	}
+
+	for _, test := range errorTests {
+		p := New(lexer.New(test.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, actual %d: %v", test.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Message != test.expectedMessage {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expectedMessage, errors[0].Message)
+		}
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fn(...rest, x) {}", "rest parameter must be the last parameter"},
+		{"fn(a = 1, b) {}", `parameter "b" without default value follows a parameter with default value`},
+		{"fn(a b) {}", `expected next token type ",", actual "IDENT"`},
+		{"fn(...) {}", `expected next token type "IDENT", actual ")"`},
+		{"fn(a = ) {}", `expected an expression, actual ")"`},
+		{"fn(1) {}", `expected an identifier or a destructuring pattern, actual "INT"`},
+		{"fn(a = 1, [b]) {}", `parameter "[b]" without default value follows a parameter with default value`},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, actual %d: %v", test.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Message != test.expectedMessage {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expectedMessage, errors[0].Message)
+		}
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "x = 5"},
+		{"x = y = 1;", "x = y = 1"},
+		{"x += 1 * 2;", "x += (1 * 2)"},
+		{"x -= y || z;", "x -= (y || z)"},
+		{"x *= f(1);", "x *= f(1)"},
+		{"x /= 2; x %= 3;", "x /= 2x %= 3"},
+		{"let f = fn() { count = count + 1 };", "let f = fn() count = (count + 1);"},
+		{"a[0] = 1;", "(a[0]) = 1"},
+		{"h.x += a[i + 1];", "(h.x) += (a[(i + 1)])"},
+		{"h.p.q = 1;", "((h.p).q) = 1"},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	// 赋值是右结合的
+	program := New(lexer.New("a = b = 1")).ParseProgram()
+	outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.AssignExpression)
+	testIdentifier(t, outer.Target, "a")
+	inner, ok := outer.Value.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("expected *ast.AssignExpression, actual %T", outer.Value)
+	}
+	testIdentifier(t, inner.Target, "b")
+	testLiteralExpression(t, inner.Value, 1)
+}
+
+func TestAssignExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 = 2", "invalid assignment target: 1"},
+		{"a + b = 2", "invalid assignment target: (a + b)"},
+		{"f() += 1", "invalid assignment target: f()"},
+		{"x = ;", `expected an expression, actual ";"`},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, actual %d: %v", test.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Message != test.expectedMessage {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expectedMessage, errors[0].Message)
+		}
+	}
+}
+
+func TestLoopStatementParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x += 1 }", "while (x < 10) x += 1"},
+		{"for (x in [1, 2]) { puts(x); }", "for x in [1, 2] puts(x)"},
+		{"for (i in range(10)) { if (i > 5) { break; } continue }", "for i in range(10) if (i > 5) break;continue;"},
+		{"while (true) { let f = fn() { 1 }; break }", "while true let f = fn() 1;break;"},
+		{"while (x) { y };", "while x y"},
+		{"for (x in xs) { x };", "for x in xs x"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, actual %d", test.input, len(program.Statements))
+		}
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("for (item in items) { item }")).ParseProgram()
+	statement, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ForStatement, actual %T", program.Statements[0])
+	}
+	testIdentifier(t, statement.Variable, "item")
+	testIdentifier(t, statement.Iterable, "items")
+}
+
+func TestLoopStatementErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break;", "break statement outside of loop"},
+		{"if (true) { continue }", "continue statement outside of loop"},
+		{"while (true) { let f = fn() { break }; }", "break statement outside of loop"},
+		{"for (x of xs) { }", `expected next token type "IN", actual "IDENT"`},
+		{"for (1 in xs) { }", `expected next token type "IDENT", actual "INT"`},
+		{"while true { }", `expected next token type "(", actual "TRUE"`},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, actual %d: %v", test.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Message != test.expectedMessage {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expectedMessage, errors[0].Message)
+		}
+	}
+}
+
+func TestImportExportParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/fold.toy"`, `import "lib/fold.toy";`},
+		{`import "lib/fold.toy" as f;`, `import "lib/fold.toy" as f;`},
+		{`import { fold } from "lib/fold.toy";`, `import {fold} from "lib/fold.toy";`},
+		{`import { fold as f, sum, } from "lib/fold.toy"`, `import {fold as f, sum} from "lib/fold.toy";`},
+		{"export let x = 1;", "export let x = 1;"},
+		{"export const [a, b] = [1, 2];", "export const [a, b] = [1, 2];"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, actual %d", test.input, len(program.Statements))
+		}
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New(`import { a as b } from "m.toy";`)).ParseProgram()
+	statement, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ImportStatement, actual %T", program.Statements[0])
+	}
+	if statement.Path.Value != "m.toy" {
+		t.Errorf("expected path %q, actual %q", "m.toy", statement.Path.Value)
+	}
+	testIdentifier(t, statement.Names[0], "a")
+	testIdentifier(t, statement.Locals[0], "b")
+}
+
+func TestImportExportErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"import fold;", `expected a module path or an import list, actual "IDENT"`},
+		{`import {} from "m.toy";`, "expected at least one name to import"},
+		{`import { a } "m.toy";`, `expected "from" after import list, actual "m.toy"`},
+		{`import { a } from m;`, `expected next token type "STRING", actual "IDENT"`},
+		{`import "m.toy" as 1;`, `expected next token type "IDENT", actual "INT"`},
+		{"export fn() { 1 };", `expected let or const after export, actual "FUNCTION"`},
+		{"let f = fn() { export let x = 1; };", "export statement must be at the top level"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, actual %d: %v", test.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Message != test.expectedMessage {
+			t.Errorf("%q: expected %q, actual %q", test.input, test.expectedMessage, errors[0].Message)
+		}
+	}
+}
+
+func TestMemberExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a.b", "(a.b)"},
+		{"a.b.c", "((a.b).c)"},
+		{"a.b[0]", "((a.b)[0])"},
+		{"a[0].b", "((a[0]).b)"},
+		{"-a.b", "(-(a.b))"},
+		{"a.b * 2", "((a.b) * 2)"},
+		{"f(x).y", "(f(x).y)"},
+	}
+
+	for _, test := range tests {
+		p := New(lexer.New(test.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("a.1"))
+	p.ParseProgram()
+	if len(p.Errors()) != 1 {
+		t.Errorf("expected 1 error, actual %d", len(p.Errors()))
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -858,6 +1487,39 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringParsing(t *testing.T) {
+	input := `"n = ${n + 1}, ${f(x)}!"`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := statement.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("expected *ast.InterpolatedString, actual %T", statement.Expression)
+	}
+
+	if len(str.Parts) != 5 {
+		t.Fatalf("expected 5 parts, actual %d", len(str.Parts))
+	}
+
+	if !testInfixExpression(t, str.Parts[1], "n", "+", 1) {
+		return
+	}
+
+	expected := "n = ${(n + 1)}, ${f(x)}!"
+	if str.String() != expected {
+		t.Errorf("expected %q, actual %q", expected, str.String())
+	}
+
+	if str.End().Offset != len(input) {
+		t.Errorf("expected end offset %d, actual %d", len(input), str.End().Offset)
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	l := lexer.New(input)
@@ -1041,3 +1703,162 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestParserErrorPosition(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"let x 5;",
+			`demo.toy:1:7: error: expected next token type "=", actual "INT"`,
+		},
+		{
+			"let x = 1;\nlet y = ;",
+			`demo.toy:2:9: error: expected an expression, actual ";"`,
+		},
+	}
+
+	for _, test := range tests {
+		l := lexer.NewWithFile("demo.toy", test.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", test.input)
+		}
+
+		if errors[0].String() != test.expectedMessage {
+			t.Errorf("error message expected %q, actual %q", test.expectedMessage, errors[0])
+		}
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     int
+		expectedStatements int // 正确解析的语句数量
+	}{
+		{"let x = ; let y = 2;", 1, 1},
+		{"let = 5; let y = 2; y;", 1, 2},
+		{"let x = (1 + ; let y = 2;", 1, 1},
+		{"let f = fn(x) { x + ; y; }; let y = 2;", 1, 2},
+		{"if (x) { 1 + } let y = 1;", 1, 2},
+		{"let a = [1, 2; let c = ; let d = 4;", 2, 1},
+		{"foo(1, 2; bar(3);", 1, 1},
+		{"let h = {1: 2, 3 4}; h;", 1, 1},
+		{"let f = fn() { let h = {1: 2, 3 4}; h }; f();", 1, 2},
+		{"if (x +) { a } let y = 1;", 1, 1},
+		{"let a = 1 & 2; let b = 3;", 1, 2},
+		{"let s = \"abc", 1, 1},
+		{"let s = \"a\\qb\"; s;", 1, 2},
+		{"let s = \"a${}b\"; let t = 1;", 1, 1},
+		{"let s = \"a${x +}b\"; let t = 1;", 1, 1},
+		// 插值表达式没有结束时只报告 lexer 发现的未结束的字符串
+		{"let t = 1; let s = \"${", 1, 1},
+		{"let t = 1; let s = \"a${x + ", 1, 1},
+		{"let t = 1; let s = \"a${\"b", 1, 1},
+		{"let x = ; const y = 2; y;", 1, 2},
+		{"let x = 1 +; throw x;", 1, 1},
+	}
+
+	for _, test := range tests {
+		l := lexer.New(test.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != test.expectedErrors {
+			t.Errorf("%q: expected %d errors, actual %d: %v",
+				test.input, test.expectedErrors, len(errors), errors)
+		}
+
+		if len(program.Statements) != test.expectedStatements {
+			t.Errorf("%q: expected %d statements, actual %d: %q",
+				test.input, test.expectedStatements, len(program.Statements), program.String())
+		}
+	}
+}
+
+// 插值表达式没有结束时，源码末尾的语法错误只是未结束的字符串的后果，只报告 lexer 发现的错误
+func TestUnterminatedTemplateError(t *testing.T) {
+	inputs := []string{`"${`, `"${x`, `"a${x}b${f(`, `"${ "b`}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0].Message != "unterminated string literal" {
+			t.Errorf("%q: expected only unterminated string literal, actual %v", input, errors)
+		}
+	}
+}
+
+func TestParserErrorExpectedTokens(t *testing.T) {
+	l := lexer.New("let x 5;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, actual %d", len(errors))
+	}
+
+	d := errors[0]
+	if len(d.Expected) != 1 || d.Expected[0] != token.ASSIGN {
+		t.Errorf("expected token set [%q], actual %v", token.ASSIGN, d.Expected)
+	}
+
+	if d.Span.Start.Column != 7 || d.Span.End.Column != 8 {
+		t.Errorf("expected span 7..8, actual %d..%d", d.Span.Start.Column, d.Span.End.Column)
+	}
+}
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	statement, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("expected *ast.LetStatement, actual %T", program.Statements[0])
+	}
+
+	function, ok := statement.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.FunctionLiteral, actual %T", statement.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Errorf("function literal name expected %q, actual %q", "myFunction", function.Name)
+	}
+}
+
+func TestMethodLiteralWithName(t *testing.T) {
+	input := `{"greet": fn() { }, 1: fn() { }}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	hash := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	for key, value := range hash.Pairs {
+		function := value.(*ast.FunctionLiteral)
+
+		expected := ""
+		if _, ok := key.(*ast.StringLiteral); ok {
+			expected = "greet"
+		}
+
+		if function.Name != expected {
+			t.Errorf("function literal name expected %q, actual %q", expected, function.Name)
+		}
+	}
+}
@@ -5,28 +5,39 @@ package repl
 import (
 	"bufio"
 	"fmt"
-	"interpreter/evaluator"
+	"interpreter/diagnostic"
+	"interpreter/executor"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
 	"io"
+	"os"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+func Start(in io.Reader, out io.Writer, engine executor.Engine) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
 
-	for {
+	color := false
+	if f, ok := out.(*os.File); ok {
+		color = diagnostic.ColorEnabled(f)
+	}
+	renderer := diagnostic.NewRenderer(color)
+
+	for count := 1; ; count++ {
 		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return // exit for
 		}
 
+		// 每一行输入都作为一个单独的伪文件，比如 "<repl:3>"。
+		// 先前输入的源码仍然保留在 renderer 里，以便诊断信息能够指向先前输入里定义的函数
 		line := scanner.Text()
-		l := lexer.New(line)
+		file := fmt.Sprintf("<repl:%d>", count)
+		renderer.AddSource(file, line)
+		l := lexer.NewWithFile(file, line)
 
 		// for tk := l.NextToken(); tk.Type != token.EOF; tk = l.NextToken() {
 		// 	fmt.Printf("%+v\n", tk) // %+v 比 %v 多显示结构体的字段名称
@@ -36,15 +47,20 @@ func Start(in io.Reader, out io.Writer) {
 		program := p.ParseProgram()
 
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, renderer, p.Errors())
 			continue
 		}
 
 		// io.WriteString(out, program.String())
 		// io.WriteString(out, "\n")
 
-		evaluated := evaluator.Eval(program, env)
+		evaluated := executor.SafeRunInteractive(engine, program)
 		if evaluated != nil {
+			if err, ok := evaluated.(*object.Error); ok {
+				renderer.Render(out, diagnostic.FromError(err))
+				continue
+			}
+
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
@@ -54,9 +70,8 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, "parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printParserErrors(out io.Writer, renderer *diagnostic.Renderer, errors []diagnostic.Diagnostic) {
+	for _, d := range errors {
+		renderer.Render(out, d)
 	}
 }
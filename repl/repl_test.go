@@ -0,0 +1,34 @@
+package repl
+
+import (
+	"bytes"
+	"interpreter/executor"
+	"interpreter/object"
+	"strings"
+	"testing"
+)
+
+// 每一行输入都是单独的伪文件，诊断信息可以指向先前输入里的源码
+func TestSourcePerInput(t *testing.T) {
+	engine, err := executor.NewEngine("eval", object.NewRuntime())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := "let f = fn(x) { x + \"s\" };\nlet g = fn() { f(1) }\ng()\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, engine)
+
+	expected := []string{
+		" --> <repl:1>:1:19",
+		"1 | let f = fn(x) { x + \"s\" };",
+		"  |         -- function defined here",
+		"  at f (<repl:2>:1:17)",
+		"  at g (<repl:3>:1:2)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected output to contain %q, actual:\n%s", line, out.String())
+		}
+	}
+}
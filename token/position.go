@@ -0,0 +1,32 @@
+package token
+
+import "fmt"
+
+// 源码中的位置
+type Position struct {
+	File   string // 源码文件名，从 REPL 等输入的源码没有文件名，此时为空字符串
+	Line   int    // 行号，从 1 开始
+	Column int    // 列号，从 1 开始
+	Offset int    // 字节偏移量，从 0 开始
+}
+
+// 行号从 1 开始，所以零值 Position{} 表示 "未知位置"
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// 返回 "file:line:col" 格式的字符串，没有文件名时返回 "line:col"
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.File != "" {
+			return p.File
+		}
+		return "-"
+	}
+
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.File != "" {
+		s = p.File + ":" + s
+	}
+	return s
+}
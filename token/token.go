@@ -7,6 +7,8 @@ type TokenType string
 type Token struct {
 	Type    TokenType // token 的类型
 	Literal string    // token 的值
+	Pos     Position  // token 的开始位置
+	End     Position  // token 的结束位置（即 token 之后的第一个字符的位置）
 }
 
 // token 的类型
@@ -17,14 +19,22 @@ const (
 	// 标识符和字面值
 	IDENT  = "IDENT"  // add, foobar, x, y, ...
 	INT    = "INT"    // 1343456
+	FLOAT  = "FLOAT"  // 3.14, 1e-9
 	STRING = "STRING" // "foobar"
 
+	// 插值字符串 "a${x}b${y}c" 被切分为：
+	// TEMPLATE_HEAD "a${"、表达式 x、TEMPLATE_MIDDLE "}b${"、表达式 y、TEMPLATE_TAIL "}c"
+	TEMPLATE_HEAD   = "TEMPLATE_HEAD"
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	TEMPLATE_TAIL   = "TEMPLATE_TAIL"
+
 	// 操作符
 	ASSIGN   = "="
 	PLUS     = "+"
 	MINUS    = "-"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 
 	BANG = "!"
 
@@ -34,13 +44,24 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	// 复合赋值
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+
 	AND = "&&"
 	OR  = "||"
 
+	ARROW = "=>" // match 分支 pattern => expr
+
 	// 分隔符
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."   // 成员访问 h.key
+	ELLIPSIS  = "..." // 剩余参数 fn(head, ...tail)
 
 	// 括号
 	LPAREN   = "("
@@ -53,10 +74,26 @@ const (
 	// 关键字
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 
 	IF     = "IF"
 	ELSE   = "ELSE"
 	RETURN = "RETURN"
+	MATCH  = "MATCH"
+
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+
+	IMPORT = "IMPORT"
+	EXPORT = "EXPORT"
+
+	THROW   = "THROW"
+	TRY     = "TRY"
+	CATCH   = "CATCH"
+	FINALLY = "FINALLY"
 
 	TRUE  = "TRUE"
 	FALSE = "FALSE"
@@ -65,9 +102,25 @@ const (
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
+	"const":  CONST,
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"match":  MATCH,
+
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+
+	"import": IMPORT,
+	"export": EXPORT,
+
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
 
 	"true":  TRUE,
 	"false": FALSE,
@@ -0,0 +1,30 @@
+package vm
+
+import (
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/object"
+)
+
+// 编译并执行模块，模块有自己的常量池和全局变量。
+// 模块的顶层环境由执行完毕之后的全局变量构成，模块跟导入者使用同一个运行配置
+func runModule(program *ast.Program, runtime *object.Runtime) (*object.Environment, *object.Error) {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return nil, &object.Error{Kind: object.INTERNAL_ERROR, Message: err.Error()}
+	}
+
+	machine := NewWithGlobals(c.Bytecode(), NewGlobals(), runtime)
+	if err, ok := machine.Run().(*object.Error); ok {
+		return nil, err
+	}
+
+	globals := machine.Globals()
+	env := object.NewEnvironment()
+	for i, name := range globals.Names {
+		if value := globals.Values[i]; value != nil {
+			env.Declare(name, value, globals.Constants[i])
+		}
+	}
+	return env, nil
+}
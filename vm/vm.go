@@ -0,0 +1,741 @@
+// original from https://compilerbook.com/
+
+package vm
+
+import (
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/core"
+	"interpreter/object"
+	"strings"
+)
+
+const StackSize = 2048
+
+// 栈帧，对应一次函数调用（或者主程序）
+type Frame struct {
+	fn       *Closure
+	cf       *compiler.CompiledFunction
+	ip       int           // 当前指令的偏移量
+	bp       int           // 局部变量（包括形参）在栈上的起始位置
+	base     int           // 调用之前的栈顶位置，即被调用的函数（以及方法调用的接收者）所在的位置
+	receiver object.Object // 方法调用的接收者，不是方法调用时为 nil
+
+	// 调用者调用的函数，以及复用这个栈帧的各层尾调用（发生尾调用之后 fn 是最后被尾调用的函数）
+	called *Closure
+	tails  []object.StackFrame
+}
+
+// 循环或者 try 语句块
+type block struct {
+	loop    bool
+	handler int // try 语句块发生错误时跳转的位置
+	sp      int // 进入语句块时的栈顶位置
+	frame   int // 所在的栈帧的数量，即语句块属于第 frame 层栈帧
+}
+
+type VM struct {
+	globals *object.Globals
+	runtime *object.Runtime
+
+	stack []object.Object
+	sp    int // 总是指向下一个空闲的位置，栈顶的值为 stack[sp-1]
+
+	frames []Frame
+	blocks []block
+}
+
+// 字节码虚拟机创建的函数（即闭包），在函数的定义之外附上编译好的字节码、捕获的外层变量，
+// 以及定义函数的程序（主程序或者模块）的全局变量
+type Closure struct {
+	*object.Function
+	compiled *compiler.CompiledFunction
+	free     []object.Object
+	globals  *object.Globals
+}
+
+// 被闭包捕获的局部变量，存放在局部变量的槽位里，由闭包共享
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return "cell" }
+
+// for-in 循环的迭代器，循环期间位于栈上
+type iterator struct {
+	*core.Iterator
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+func NewGlobals() *object.Globals {
+	return &object.Globals{}
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobals(bytecode, NewGlobals(), object.NewRuntime())
+}
+
+// 使用已有的全局变量（用于 REPL）以及指定的运行配置
+func NewWithGlobals(bytecode *compiler.Bytecode, globals *object.Globals, runtime *object.Runtime) *VM {
+	globals.Names = bytecode.GlobalNames
+	for len(globals.Values) < len(globals.Names) {
+		globals.Values = append(globals.Values, nil)
+		globals.Constants = append(globals.Constants, false)
+	}
+
+	main := &Closure{Function: &object.Function{}, compiled: bytecode.Main, globals: globals}
+	vm := &VM{
+		globals: globals,
+		runtime: runtime,
+		stack:   make([]object.Object, StackSize),
+	}
+
+	// 主程序的局部变量用于语句块里声明的标识符
+	vm.sp = bytecode.Main.NumLocals
+	vm.frames = append(vm.frames, Frame{fn: main, cf: bytecode.Main, ip: -1})
+	return vm
+}
+
+func (vm *VM) Globals() *object.Globals {
+	return vm.globals
+}
+
+// 执行主程序，返回最后一条语句的值（没有值时为 nil），或者未被捕获的错误
+func (vm *VM) Run() object.Object {
+	for {
+		frame := &vm.frames[len(vm.frames)-1]
+		frame.ip++
+		ins := frame.cf.Instructions
+		op := code.Opcode(ins[frame.ip])
+
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			err = vm.pushResult(core.CheckOverflow(frame.cf.Constants[index], vm.runtime.Strict))
+
+		case code.OpNull:
+			vm.push(core.NULL)
+
+		case code.OpTrue:
+			vm.push(core.TRUE)
+
+		case code.OpFalse:
+			vm.push(core.FALSE)
+
+		case code.OpPop:
+			vm.sp--
+
+		case code.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case code.OpSwap:
+			vm.stack[vm.sp-1], vm.stack[vm.sp-2] = vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+
+		case code.OpPick:
+			n := int(code.ReadUint8(ins[frame.ip+1:]))
+			frame.ip += 1
+			vm.push(vm.stack[vm.sp-1-n])
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(core.CheckOverflow(core.InfixOperation(infixOperators[op], left, right), vm.runtime.Strict))
+
+		case code.OpMinus, code.OpPlus, code.OpBang:
+			right := vm.pop()
+			err = vm.pushResult(core.CheckOverflow(core.PrefixOperation(prefixOperators[op], right), vm.runtime.Strict))
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[frame.ip+1:])) - 1
+
+		case code.OpJumpNotTruthy, code.OpJumpTruthy:
+			target := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			if core.IsTruthy(vm.pop()) == (op == code.OpJumpTruthy) {
+				frame.ip = target - 1
+			}
+
+		case code.OpJumpNotMissing:
+			target := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			if vm.stack[vm.sp-1] != nil {
+				frame.ip = target - 1
+			} else {
+				vm.sp--
+			}
+
+		case code.OpError:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			e := *frame.cf.Constants[index].(*object.Error)
+			err = &e
+
+		case code.OpThrow:
+			err = core.ThrowValue(vm.pop()).(*object.Error)
+
+		case code.OpRethrow:
+			err = vm.pop().(*object.Error)
+
+		case code.OpErrorValue:
+			vm.stack[vm.sp-1] = core.ErrorValue(vm.stack[vm.sp-1].(*object.Error))
+
+		case code.OpSetupLoop:
+			vm.blocks = append(vm.blocks, block{loop: true, sp: vm.sp, frame: len(vm.frames)})
+
+		case code.OpSetupTry:
+			handler := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.blocks = append(vm.blocks, block{handler: handler, sp: vm.sp, frame: len(vm.frames)})
+
+		case code.OpPopBlock:
+			vm.blocks = vm.blocks[:len(vm.blocks)-1]
+
+		case code.OpBreak, code.OpContinue:
+			target := int(code.ReadUint16(ins[frame.ip+1:]))
+			vm.sp = vm.blocks[len(vm.blocks)-1].sp
+			frame.ip = target - 1
+
+		case code.OpGetIterator:
+			it, iterErr := core.NewIterator(vm.pop())
+			if iterErr != nil {
+				err = iterErr
+				break
+			}
+			vm.push(&iterator{it})
+
+		case code.OpIterNext:
+			target := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			if value, ok := vm.stack[vm.sp-1].(*iterator).Next(); ok {
+				vm.push(value)
+			} else {
+				frame.ip = target - 1
+			}
+
+		case code.OpGetGlobal:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			err = vm.getGlobal(frame.fn.globals, index)
+
+		case code.OpDefineGlobal:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			constant := code.ReadUint8(ins[frame.ip+3:]) == 1
+			frame.ip += 3
+			err = defineGlobal(frame.fn.globals, index, vm.pop(), constant)
+
+		case code.OpSetGlobal:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			err = setGlobal(frame.fn.globals, index, vm.pop())
+
+		case code.OpGetLocal:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.push(vm.stack[frame.bp+index])
+
+		case code.OpSetLocal:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.stack[frame.bp+index] = vm.pop()
+
+		case code.OpNewCell:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.stack[frame.bp+index] = &cell{}
+
+		case code.OpMakeCell:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.stack[frame.bp+index] = &cell{value: vm.stack[frame.bp+index]}
+
+		case code.OpGetCell:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.push(vm.stack[frame.bp+index].(*cell).value)
+
+		case code.OpSetCell:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.stack[frame.bp+index].(*cell).value = vm.pop()
+
+		case code.OpCheckDefined:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			if vm.stack[vm.sp-1] == nil {
+				name := frame.cf.Constants[index].(*object.String).Value
+				err = core.NewError(object.NAME_ERROR, "identifier not found: %s", name)
+			}
+
+		case code.OpGetFree:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			vm.push(frame.fn.free[index].(*cell).value)
+
+		case code.OpSetFree:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			frame.fn.free[index].(*cell).value = vm.pop()
+
+		case code.OpCaptureLocal:
+			index := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.push(vm.stack[frame.bp+index])
+
+		case code.OpCaptureFree:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			vm.push(frame.fn.free[index])
+
+		case code.OpClosure:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			numFree := int(code.ReadUint16(ins[frame.ip+3:]))
+			frame.ip += 4
+			vm.pushClosure(frame, frame.cf.Constants[index].(*compiler.CompiledFunction), numFree)
+
+		case code.OpReceiver:
+			vm.push(frame.receiver)
+
+		case code.OpDestructure:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			pattern := frame.cf.Constants[index].(*compiler.Pattern)
+			err = vm.bindPattern(frame, pattern, vm.pop())
+
+		case code.OpMatch:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			target := int(code.ReadUint16(ins[frame.ip+3:]))
+			frame.ip += 4
+			pattern := frame.cf.Constants[index].(*compiler.Pattern)
+			if vm.bindPattern(frame, pattern, vm.stack[vm.sp-1]) != nil {
+				frame.ip = target - 1
+			}
+
+		case code.OpArray:
+			n := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			n := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			err = vm.buildHash(n)
+
+		case code.OpInterpolate:
+			n := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-n : vm.sp] {
+				out.WriteString(part.Inspect())
+			}
+			vm.sp -= n
+			vm.push(&object.String{Value: out.String()})
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(core.Index(left, index))
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(core.AssignIndex(left, index, value))
+
+		case code.OpMember:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			name := frame.cf.Constants[index].(*object.String).Value
+			err = vm.pushResult(core.Member(vm.pop(), name))
+
+		case code.OpMemberTarget:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			if obj := vm.stack[vm.sp-1]; obj.Type() != object.HASH_OBJ {
+				name := frame.cf.Constants[index].(*object.String).Value
+				err = core.NewError(object.TYPE_ERROR, "member assignment not supported: %s.%s", obj.Type(), name)
+			}
+
+		case code.OpCall:
+			argc := int(code.ReadUint8(ins[frame.ip+1:]))
+			frame.ip += 1
+			base := vm.sp - 1 - argc
+			err = vm.call(vm.stack[base], argc, nil, base)
+
+		case code.OpCallMethod:
+			argc := int(code.ReadUint8(ins[frame.ip+1:]))
+			frame.ip += 1
+			base := vm.sp - 2 - argc
+			receiver := vm.stack[base]
+			// 模块的成员函数 m.fn(args) 只是普通的函数调用
+			if _, ok := receiver.(*object.Module); ok {
+				receiver = nil
+			}
+			err = vm.call(vm.stack[base+1], argc, receiver, base)
+
+		case code.OpTailCall:
+			argc := int(code.ReadUint8(ins[frame.ip+1:]))
+			frame.ip += 1
+			base := vm.sp - 1 - argc
+			err = vm.tailCall(vm.stack[base], argc, nil, base)
+
+		case code.OpTailCallMethod:
+			argc := int(code.ReadUint8(ins[frame.ip+1:]))
+			frame.ip += 1
+			base := vm.sp - 2 - argc
+			receiver := vm.stack[base]
+			if _, ok := receiver.(*object.Module); ok {
+				receiver = nil
+			}
+			err = vm.tailCall(vm.stack[base+1], argc, receiver, base)
+
+		case code.OpReturnValue:
+			value := vm.pop()
+			if len(vm.frames) == 1 {
+				return value
+			}
+			vm.popFrame()
+			vm.push(value)
+
+		case code.OpReturn:
+			return nil
+
+		case code.OpImport:
+			node := frame.cf.NodeAt(frame.ip).(*ast.ImportStatement)
+			module, importErr := core.LoadModule(vm.runtime, node, runModule)
+			if importErr != nil {
+				err = importErr
+				break
+			}
+			vm.push(module)
+
+		case code.OpImportName:
+			index := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			name := frame.cf.Constants[index].(*object.String).Value
+			module := vm.pop().(*object.Module)
+			value, ok := module.Export(name)
+			if !ok {
+				err = core.NewError(object.NAME_ERROR, "module %s has no exported member %s", module.Path, name)
+				break
+			}
+			vm.push(value)
+
+		default:
+			err = core.NewError(object.INTERNAL_ERROR, "unknown opcode: %d", op)
+		}
+
+		if err != nil {
+			if uncaught := vm.raise(err); uncaught != nil {
+				return uncaught
+			}
+		}
+	}
+}
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpMod:         "%",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+var prefixOperators = map[code.Opcode]string{
+	code.OpMinus: "-",
+	code.OpPlus:  "+",
+	code.OpBang:  "!",
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// 压入运算的结果，如果结果是错误则返回错误
+func (vm *VM) pushResult(result object.Object) *object.Error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	vm.push(result)
+	return nil
+}
+
+func (vm *VM) getGlobal(globals *object.Globals, index int) *object.Error {
+	if value := globals.Values[index]; value != nil {
+		vm.push(value)
+		return nil
+	}
+
+	name := globals.Names[index]
+	if builtin, ok := core.Builtins[name]; ok {
+		vm.push(builtin)
+		return nil
+	}
+	return core.NewError(object.NAME_ERROR, "identifier not found: %s", name)
+}
+
+func defineGlobal(globals *object.Globals, index int, value object.Object, constant bool) *object.Error {
+	if globals.Values[index] != nil {
+		return core.NewError(object.NAME_ERROR, "identifier %s has already been declared", globals.Names[index])
+	}
+	globals.Values[index] = value
+	globals.Constants[index] = constant
+	return nil
+}
+
+func setGlobal(globals *object.Globals, index int, value object.Object) *object.Error {
+	name := globals.Names[index]
+	if globals.Constants[index] {
+		return core.NewError(object.NAME_ERROR, "cannot assign to constant: %s", name)
+	}
+	if globals.Values[index] == nil {
+		return core.NewError(object.NAME_ERROR, "cannot assign to undefined variable: %s", name)
+	}
+	globals.Values[index] = value
+	return nil
+}
+
+// 由函数和栈顶的 numFree 个 cell 创建闭包
+func (vm *VM) pushClosure(frame *Frame, cf *compiler.CompiledFunction, numFree int) {
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	literal := cf.Literal
+	vm.push(&Closure{
+		Function: &object.Function{
+			Parameters: literal.Parameters,
+			Defaults:   literal.Defaults,
+			Rest:       literal.Rest,
+			Body:       literal.Body,
+			Name:       literal.Name,
+			Pos:        literal.Pos(),
+			End:        literal.End(),
+		},
+		compiled: cf,
+		free:     free,
+		globals:  frame.fn.globals,
+	})
+}
+
+// 按照模式解构 value，并绑定模式里的标识符
+func (vm *VM) bindPattern(frame *Frame, pattern *compiler.Pattern, value object.Object) *object.Error {
+	return core.MatchPattern(pattern.Pattern, value, func(name *ast.Identifier, value object.Object) *object.Error {
+		binding := pattern.Bindings[name]
+		if binding.Redeclared {
+			err := core.NewError(object.NAME_ERROR, "identifier %s has already been declared", name.Value)
+			err.Pos = name.Pos()
+			err.End = name.End()
+			return err
+		}
+
+		symbol := binding.Symbol
+		switch {
+		case symbol.Scope == compiler.GlobalScope:
+			if err := defineGlobal(frame.fn.globals, symbol.Index, value, symbol.Constant); err != nil {
+				err.Pos = name.Pos()
+				err.End = name.End()
+				return err
+			}
+		case symbol.Cell:
+			vm.stack[frame.bp+symbol.Index].(*cell).value = value
+		default:
+			vm.stack[frame.bp+symbol.Index] = value
+		}
+		return nil
+	})
+}
+
+func (vm *VM) buildHash(n int) *object.Error {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := vm.sp - 2*n; i < vm.sp; i += 2 {
+		key, value := vm.stack[i], vm.stack[i+1]
+		hashKey, err := core.HashKey(key)
+		if err != nil {
+			return err
+		}
+		pairs[hashKey] = object.HashPair{Key: key, Value: value}
+	}
+
+	vm.sp -= 2 * n
+	vm.push(&object.Hash{Pairs: pairs})
+	return nil
+}
+
+// 调用函数，栈上从 base 开始依次为（方法调用的接收者、）被调用的函数和 argc 个实参
+func (vm *VM) call(callee object.Object, argc int, receiver object.Object, base int) *object.Error {
+	switch fn := callee.(type) {
+	case *Closure:
+		if err := core.CheckArity(fn.Function, argc); err != nil {
+			core.DefinedHere(err, fn.Function)
+			return vm.callError(err, callee)
+		}
+
+		// 栈帧的数量即函数调用的层数（主程序占用一个栈帧），超出时报告 RecursionError，以免无限递归耗尽内存
+		if len(vm.frames) > core.MaxCallDepth {
+			return vm.callError(core.NewError(object.RECURSION_ERROR, "maximum call depth of %d exceeded", core.MaxCallDepth), callee)
+		}
+
+		vm.pushFrame(fn, argc, receiver, base)
+		return nil
+
+	case *object.Builtin:
+		args := make([]object.Object, argc)
+		copy(args, vm.stack[vm.sp-argc:vm.sp])
+
+		result := core.CheckOverflow(fn.Fn(args...), vm.runtime.Strict)
+		if err, ok := result.(*object.Error); ok {
+			return vm.callError(err, callee)
+		}
+
+		vm.sp = base
+		vm.push(result)
+		return nil
+
+	default:
+		return vm.callError(core.NewError(object.TYPE_ERROR, "not a function: %s", callee.Type()), callee)
+	}
+}
+
+// 尾调用：被调用的函数复用当前函数的栈帧，返回时直接返回到当前函数的调用者，
+// 因此尾递归（包括互相调用的函数）不会增加栈帧的数量。被调用的不是函数（比如内置函数）时跟普通的调用一样
+func (vm *VM) tailCall(callee object.Object, argc int, receiver object.Object, base int) *object.Error {
+	fn, ok := callee.(*Closure)
+	if !ok || len(vm.frames) == 1 {
+		return vm.call(callee, argc, receiver, base)
+	}
+	if err := core.CheckArity(fn.Function, argc); err != nil {
+		core.DefinedHere(err, fn.Function)
+		return vm.callError(err, callee)
+	}
+
+	// 记录这次尾调用，然后把被调用的函数（以及方法调用的接收者）和实参移到当前函数所在的位置
+	current := &vm.frames[len(vm.frames)-1]
+	called, tails := current.called, current.tails
+	if call, ok := current.cf.NodeAt(current.ip).(*ast.CallExpression); ok {
+		tails = core.AppendTailFrame(tails, call, callee)
+	}
+
+	top := vm.sp
+	caller := vm.popFrame()
+	vm.sp = caller.base + copy(vm.stack[caller.base:], vm.stack[base:top])
+	vm.pushFrame(fn, argc, receiver, caller.base)
+
+	frame := &vm.frames[len(vm.frames)-1]
+	frame.called, frame.tails = called, tails
+	return nil
+}
+
+// 创建函数的栈帧：实参已经位于形参的槽位里，没有对应实参的形参为 nil（即 "不存在"，使用默认值），
+// 多出来的实参收集到剩余参数里
+func (vm *VM) pushFrame(fn *Closure, argc int, receiver object.Object, base int) {
+	cf := fn.compiled
+	bp := vm.sp - argc
+	for vm.sp+cf.NumLocals >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+
+	params := len(fn.Parameters)
+	var rest *object.Array
+	if fn.Rest != nil {
+		rest = &object.Array{Elements: []object.Object{}}
+		if argc > params {
+			rest.Elements = append(rest.Elements, vm.stack[bp+params:bp+argc]...)
+		}
+	}
+
+	start := argc
+	if start > params {
+		start = params
+	}
+	for i := start; i < cf.NumLocals; i++ {
+		vm.stack[bp+i] = nil
+	}
+	if rest != nil {
+		vm.stack[bp+params] = rest
+	}
+
+	vm.sp = bp + cf.NumLocals
+	vm.frames = append(vm.frames, Frame{fn: fn, cf: cf, ip: -1, bp: bp, base: base, receiver: receiver, called: fn})
+}
+
+// 从函数返回，丢弃它的栈帧以及它里面的循环和 try 语句块
+func (vm *VM) popFrame() Frame {
+	frame := vm.frames[len(vm.frames)-1]
+	for len(vm.blocks) > 0 && vm.blocks[len(vm.blocks)-1].frame == len(vm.frames) {
+		vm.blocks = vm.blocks[:len(vm.blocks)-1]
+	}
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.sp = frame.base
+	return frame
+}
+
+// 调用失败（包括内置函数返回的错误），在调用栈里记录这次调用
+func (vm *VM) callError(err *object.Error, callee object.Object) *object.Error {
+	frame := &vm.frames[len(vm.frames)-1]
+	if call, ok := frame.cf.NodeAt(frame.ip).(*ast.CallExpression); ok {
+		core.Located(call, err)
+		err.Trace = append(err.Trace, object.StackFrame{
+			Function: core.FunctionName(call, callee),
+			Pos:      call.Pos(),
+		})
+	}
+	return err
+}
+
+// 抛出错误：跳到最内层的 try 语句块的错误处理代码，如果当前函数里没有 try 语句块，
+// 则从函数返回并在调用者里继续抛出。返回未被捕获的错误
+func (vm *VM) raise(err *object.Error) *object.Error {
+	for {
+		frame := &vm.frames[len(vm.frames)-1]
+
+		// 错误的位置是产生错误的指令对应的节点
+		if node := frame.cf.NodeAt(frame.ip); node != nil {
+			core.Located(node, err)
+		}
+
+		for len(vm.blocks) > 0 && vm.blocks[len(vm.blocks)-1].frame == len(vm.frames) {
+			b := vm.blocks[len(vm.blocks)-1]
+			vm.blocks = vm.blocks[:len(vm.blocks)-1]
+			if !b.loop {
+				vm.sp = b.sp
+				vm.push(err)
+				frame.ip = b.handler - 1
+				return nil
+			}
+		}
+
+		if len(vm.frames) == 1 {
+			return err
+		}
+
+		callee := vm.popFrame()
+		core.DefinedHere(err, callee.fn.Function)
+		core.AppendTailTrace(err, callee.tails)
+		vm.callError(err, callee.called)
+	}
+}
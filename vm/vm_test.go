@@ -0,0 +1,146 @@
+// original from https://compilerbook.com/
+
+package vm
+
+import (
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"testing"
+)
+
+// 运算规则由树遍历求值器的测试覆盖（evaluator 包的测试会用虚拟机再运行一遍），
+// 这里只测试虚拟机本身的机制
+func TestCallFrames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn(a, b) { let c = a + b; c * 2 }; f(1, 2) + f(3, 4)", 20},
+		{"let f = fn(a, b = a + 1) { a * b }; f(2) + f(2, 5)", 16},
+		{"let f = fn(a, ...rest) { a + len(rest) }; f(1) + f(1, 2, 3)", 4},
+		{"let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(5000)", 12502500},
+		{"let h = {\"v\": 3, \"get\": fn(n) { self.v * n }}; h.get(2)", 6},
+		{"let adder = fn(a) { fn(b) { a + b } }; adder(1)(2)", 3},
+		{"let f = fn() { let n = 0; let inc = fn() { n += 1 }; inc(); inc(); n }; f()", 2},
+		{"let f = fn() { let r = 0; for (i in range(0, 10)) { if (i == 5) { break; } r += i; } r }; f()", 10},
+		{"let f = fn() { try { return 1; } finally { 2 } }; f()", 1},
+		{"let f = fn() { 1 / 0 }; try { f() } catch (e) { 7 }", 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, tt.input, run(parse(tt.input)), tt.expected)
+	}
+}
+
+// 调用层数超出 core.MaxCallDepth 时报告可以捕获的 RecursionError，而不是无限地占用内存
+func TestMaxFrames(t *testing.T) {
+	input := `let f = fn(n) { f(n + 1) + 1 };
+f(0)`
+
+	err, ok := run(parse(input)).(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error")
+	}
+
+	if err.Kind != object.RECURSION_ERROR {
+		t.Errorf("expected %s, actual %s", object.RECURSION_ERROR, err.Kind)
+	}
+	if err.Pos.Line != 1 || err.Pos.Column != 18 {
+		t.Errorf("expected error at 1:18, actual %s", err.Pos)
+	}
+
+	input = `let f = fn(n) { f(n + 1) + 1 };
+try { f(0) } catch (e) { e.kind }`
+
+	result := run(parse(input))
+	if result.Inspect() != string(object.RECURSION_ERROR) {
+		t.Errorf("expected %s, actual %s", object.RECURSION_ERROR, result.Inspect())
+	}
+}
+
+func TestErrorTrace(t *testing.T) {
+	input := `let inner = fn() { 1 / 0 };
+let outer = fn() { inner() };
+outer()`
+
+	err, ok := run(parse(input)).(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error")
+	}
+
+	if err.Pos.Line != 1 || err.Pos.Column != 22 {
+		t.Errorf("expected error at 1:22, actual %s", err.Pos)
+	}
+
+	expected := []string{"inner", "outer"}
+	if len(err.Trace) != len(expected) {
+		t.Fatalf("expected trace length %d, actual %d", len(expected), len(err.Trace))
+	}
+	for i, name := range expected {
+		if err.Trace[i].Function != name {
+			t.Errorf("trace[%d]: expected %s, actual %s", i, name, err.Trace[i].Function)
+		}
+	}
+
+	if len(err.Labels) != 1 || err.Labels[0].Pos.Line != 1 {
+		t.Errorf("wrong labels: %+v", err.Labels)
+	}
+}
+
+// 跟 REPL 一样，使用同一个全局符号表、常量池和全局变量多次编译、执行
+func TestGlobalsAcrossRuns(t *testing.T) {
+	symbols := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := NewGlobals()
+
+	inputs := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 1; let f = fn() { a + b }; a", 1},
+		{"let b = 10; f()", 11},
+		{"a = 5; f()", 15},
+	}
+
+	for _, tt := range inputs {
+		c := compiler.NewWithState(symbols, constants)
+		if err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+
+		testIntegerObject(t, tt.input, NewWithGlobals(bytecode, globals, object.NewRuntime()).Run(), tt.expected)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func run(program *ast.Program) object.Object {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return New(c.Bytecode()).Run()
+}
+
+func testIntegerObject(t *testing.T, input string, obj object.Object, expected int64) {
+	t.Helper()
+
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("%q: expected Integer, actual %T (%+v)", input, obj, obj)
+		return
+	}
+	if result.Value != expected {
+		t.Errorf("%q: expected %d, actual %d", input, expected, result.Value)
+	}
+}